@@ -12,11 +12,12 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"zerosrealm.xyz/tergum/internal/agent"
 	"zerosrealm.xyz/tergum/internal/agent/config"
+	"zerosrealm.xyz/tergum/internal/agent/manager"
 	"zerosrealm.xyz/tergum/internal/entity"
 	"zerosrealm.xyz/tergum/internal/log"
 )
 
-func registerAgent(log *log.Logger, conf *config.Config) error {
+func registerAgent(log *log.Logger, conf *config.Config, man *manager.Manager) error {
 	if conf.Registration == "" {
 		log.WithFields("function", "registerAgent").Debug("No registration token, skipping.")
 		return nil
@@ -25,19 +26,43 @@ func registerAgent(log *log.Logger, conf *config.Config) error {
 	log.WithFields("function", "registerAgent").Debug("Registering agent")
 
 	type registrationData struct {
-		Hostname string `json:"hostname"`
-		Port     int    `json:"port"`
-		Token    string `json:"token"`
+		MachineID string `json:"machine_id"`
+		Hostname  string `json:"hostname"`
+		Address   string `json:"address,omitempty"`
+		Port      int    `json:"port"`
+		Token     string `json:"token"`
+
+		Labels map[string]string `json:"labels"`
+		Tunnel bool              `json:"tunnel"`
+		TLS    bool              `json:"tls"`
+		CSR    string            `json:"csr,omitempty"`
+
+		entity.AgentInfo
 	}
 	hostname, err := os.Hostname()
 	if err != nil {
 		return fmt.Errorf("registerAgent(): error getting hostname: %w", err)
 	}
 
+	// A certificate is requested on first registration and when the one the
+	// agent has is about to expire.
+	csr, err := man.CertificateRequest()
+	if err != nil {
+		return fmt.Errorf("registerAgent(): error creating certificate request: %w", err)
+	}
+
 	msg, err := json.Marshal(registrationData{
-		Hostname: hostname,
-		Port:     conf.Listen.Port,
-		Token:    conf.Registration,
+		MachineID: man.MachineID(),
+		Hostname:  hostname,
+		Address:   conf.Address,
+		Port:      conf.Listen.Port,
+		Token:     conf.Registration,
+
+		Labels:    conf.Labels,
+		Tunnel:    conf.Tunnel,
+		TLS:       conf.TLS.Cert != "" || csr != nil || man.HasCertificate(),
+		CSR:       string(csr),
+		AgentInfo: man.Info(),
 	})
 	if err != nil {
 		return fmt.Errorf("registerAgent(): error marshalling registration data: %w", err)
@@ -48,7 +73,13 @@ func registerAgent(log *log.Logger, conf *config.Config) error {
 		return fmt.Errorf("registerAgent(): error creating request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	// An agent that is registered already proves it with its PSK, or with its
+	// certificate which the client presents.
+	if psk := man.PSK(); psk != "" {
+		req.Header.Set("authorization", fmt.Sprintf("PSK %s", psk))
+	}
+
+	resp, err := man.Client().Do(req)
 	if err != nil {
 		return fmt.Errorf("registerAgent(): error sending request: %w", err)
 	}
@@ -69,16 +100,32 @@ func registerAgent(log *log.Logger, conf *config.Config) error {
 		return fmt.Errorf("registerAgent(): error reading response body: %w", err)
 	}
 
-	var agent *entity.Agent
+	var agent struct {
+		*entity.Agent
+
+		Certificate string `json:"certificate"`
+		CA          string `json:"ca"`
+	}
 	err = json.Unmarshal(body, &agent)
 	if err != nil {
 		return fmt.Errorf("registerAgent(): error unmarshalling response body: %w", err)
 	}
 	log.WithFields("function", "registerAgent").Debug("Body returned:", spew.Sdump(string(body)))
 
-	conf.PSK = agent.PSK
+	err = man.SetPSK(agent.PSK)
+	if err != nil {
+		return fmt.Errorf("registerAgent(): error saving PSK: %w", err)
+	}
+
+	if agent.Certificate != "" {
+		err = man.SetCertificate([]byte(agent.Certificate), []byte(agent.CA))
+		if err != nil {
+			return fmt.Errorf("registerAgent(): error storing certificate: %w", err)
+		}
+		log.WithFields("function", "registerAgent").Info("Received certificate from server")
+	}
 
-	log.WithFields("function", "registerAgent").Debug("Agent registered:", spew.Sdump(agent))
+	log.WithFields("function", "registerAgent").Debug("Agent registered:", spew.Sdump(agent.Agent))
 
 	return nil
 }
@@ -97,11 +144,6 @@ func main() {
 
 	log.Info("Starting agent")
 
-	if conf.PSK == "" && conf.Registration == "" {
-		log.Info("no PSK defined - exiting")
-		return
-	}
-
 	if conf.Restic == "" {
 		log.Info("no path to restic defined - exiting")
 		return
@@ -112,17 +154,29 @@ func main() {
 		return
 	}
 
-	err = registerAgent(log, conf)
+	server, err := agent.NewServer(conf)
 	if err != nil {
-		log.Error("error registering agent:", err)
+		log.Error("error creating server:", err)
 		return
 	}
 
-	server, err := agent.NewServer(conf)
-	if err != nil {
-		log.Error("error creating server:", err)
+	// The PSK is either configured, saved from an earlier run or handed out on
+	// registration.
+	if server.Manager().PSK() == "" && conf.Registration == "" {
+		log.Info("no PSK defined - exiting")
 		return
 	}
 
+	// An agent registered before carries on with its saved credentials, as it
+	// may no longer be allowed to register, such as once its token expired.
+	err = registerAgent(log, conf, server.Manager())
+	if err != nil {
+		if server.Manager().PSK() == "" {
+			log.Error("error registering agent:", err)
+			return
+		}
+		log.Warn("error registering agent, continuing with saved credentials:", err)
+	}
+
 	server.Start()
 }
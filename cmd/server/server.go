@@ -2,6 +2,8 @@ package main
 
 import (
 	"log"
+	// Embed the time zone database so schedule time zones resolve on hosts without one.
+	_ "time/tzdata"
 
 	"zerosrealm.xyz/tergum/internal/server"
 	"zerosrealm.xyz/tergum/internal/server/config"
@@ -9,10 +11,14 @@ import (
 	"zerosrealm.xyz/tergum/internal/server/service/adapter/agent"
 	"zerosrealm.xyz/tergum/internal/server/service/adapter/backup"
 	"zerosrealm.xyz/tergum/internal/server/service/adapter/backupSubscribers"
+	"zerosrealm.xyz/tergum/internal/server/service/adapter/blackout"
 	"zerosrealm.xyz/tergum/internal/server/service/adapter/forget"
 	"zerosrealm.xyz/tergum/internal/server/service/adapter/job"
+	"zerosrealm.xyz/tergum/internal/server/service/adapter/registrationToken"
 	"zerosrealm.xyz/tergum/internal/server/service/adapter/repo"
 	"zerosrealm.xyz/tergum/internal/server/service/adapter/setting"
+	"zerosrealm.xyz/tergum/internal/server/service/adapter/template"
+	"zerosrealm.xyz/tergum/internal/server/service/adapter/user"
 )
 
 func main() {
@@ -36,12 +42,24 @@ func main() {
 	var forgetCache service.ForgetCache
 	var forgetStorage service.ForgetStorage
 
+	var blackoutCache service.BlackoutCache
+	var blackoutStorage service.BlackoutStorage
+
+	var templateCache service.TemplateCache
+	var templateStorage service.TemplateStorage
+
 	var jobCache service.JobCache
 	var jobStorage service.JobStorage
 
 	var settingCache service.SettingCache
 	var settingStorage service.SettingStorage
 
+	var tokenCache service.RegistrationTokenCache
+	var tokenStorage service.RegistrationTokenStorage
+
+	var userCache service.UserCache
+	var userStorage service.UserStorage
+
 	switch conf.Database.Driver {
 	case "memory":
 		repoStorage = repo.NewMemoryStorage()
@@ -49,8 +67,12 @@ func main() {
 		backupStorage = backup.NewMemoryStorage()
 		backupSubStorage = backupSubscribers.NewMemoryStorage()
 		forgetStorage = forget.NewMemoryStorage()
+		blackoutStorage = blackout.NewMemoryStorage()
+		templateStorage = template.NewMemoryStorage()
 		jobStorage = job.NewMemoryStorage()
 		settingStorage = setting.NewMemoryStorage()
+		tokenStorage = registrationToken.NewMemoryStorage()
+		userStorage = user.NewMemoryStorage()
 	case "postgres":
 		log.Fatal("postgres storage not implemented")
 	case "sqlite":
@@ -84,6 +106,18 @@ func main() {
 		}
 		defer forgetSQL.Close()
 
+		blackoutSQL, err := blackout.NewSQLiteStorage(conf.Database.DataSourceName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer blackoutSQL.Close()
+
+		templateSQL, err := template.NewSQLiteStorage(conf.Database.DataSourceName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer templateSQL.Close()
+
 		jobSQL, err := job.NewSQLiteStorage(conf.Database.DataSourceName)
 		if err != nil {
 			log.Fatal(err)
@@ -96,13 +130,29 @@ func main() {
 		}
 		defer settingSQL.Close()
 
+		tokenSQL, err := registrationToken.NewSQLiteStorage(conf.Database.DataSourceName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer tokenSQL.Close()
+
+		userSQL, err := user.NewSQLiteStorage(conf.Database.DataSourceName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer userSQL.Close()
+
 		repoStorage = repoSQL
 		agentStorage = agentSQL
 		backupStorage = backupSQL
 		backupSubStorage = backupSubSQL
 		forgetStorage = forgetSQL
+		blackoutStorage = blackoutSQL
+		templateStorage = templateSQL
 		jobStorage = jobSQL
 		settingStorage = settingSQL
+		tokenStorage = tokenSQL
+		userStorage = userSQL
 	default:
 		log.Fatal("unsupported database driver")
 	}
@@ -117,8 +167,12 @@ func main() {
 		backupSubCache = backupSubscribers.NewMemoryCache()
 		backupCache = backup.NewMemoryCache()
 		forgetCache = forget.NewMemoryCache()
+		blackoutCache = blackout.NewMemoryCache()
+		templateCache = template.NewMemoryCache()
 		jobCache = job.NewMemoryCache()
 		settingCache = setting.NewMemoryCache()
+		tokenCache = registrationToken.NewMemoryCache()
+		userCache = user.NewMemoryCache()
 	default:
 		log.Println("continuing without cache")
 	}
@@ -128,10 +182,14 @@ func main() {
 	backupSvc := service.NewBackupService(&backupCache, &backupStorage)
 	backupSubSvc := service.NewBackupSubscriberService(&backupSubCache, &backupSubStorage)
 	forgetSvc := service.NewForgetService(&forgetCache, &forgetStorage)
+	blackoutSvc := service.NewBlackoutService(&blackoutCache, &blackoutStorage)
+	templateSvc := service.NewTemplateService(&templateCache, &templateStorage)
 	jobSvc := service.NewJobService(&jobCache, &jobStorage)
 	settingSvc := service.NewSettingService(&settingCache, &settingStorage)
+	tokenSvc := service.NewRegistrationTokenService(&tokenCache, &tokenStorage)
+	userSvc := service.NewUserService(&userCache, &userStorage)
 
-	services := service.NewServices(repoSvc, agentSvc, backupSvc, backupSubSvc, forgetSvc, jobSvc, settingSvc)
+	services := service.NewServices(repoSvc, agentSvc, backupSvc, backupSubSvc, forgetSvc, blackoutSvc, templateSvc, jobSvc, settingSvc, tokenSvc, userSvc)
 
 	log.Println("starting server")
 	server, err := server.New(conf, services)
@@ -15,6 +15,7 @@ require (
 	github.com/BurntSushi/toml v1.0.0 // indirect
 	github.com/mattn/go-sqlite3 v1.14.10
 	go.uber.org/zap v1.21.0
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
 
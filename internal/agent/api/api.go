@@ -7,6 +7,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"zerosrealm.xyz/tergum/internal/agent/manager"
+	"zerosrealm.xyz/tergum/internal/ca"
 	"zerosrealm.xyz/tergum/internal/log"
 	"zerosrealm.xyz/tergum/internal/restic"
 )
@@ -17,15 +18,13 @@ type API struct {
 	log     *log.Logger
 	restic  *restic.Restic
 	manager *manager.Manager
-	PSK     string
 }
 
-func New(logger *log.Logger, restic *restic.Restic, man *manager.Manager, PSK string) *API {
+func New(logger *log.Logger, restic *restic.Restic, man *manager.Manager) *API {
 	return &API{
 		log:     logger,
 		restic:  restic,
 		manager: man,
-		PSK:     PSK,
 	}
 }
 
@@ -78,7 +77,25 @@ func (api *API) decode(w http.ResponseWriter, r *http.Request, v interface{}) er
 func (api *API) Authenticate() mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Header.Get("X-PSK") != api.PSK {
+			// The listener only lets through client certificates from the server's CA.
+			if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+				if r.TLS.VerifiedChains[0][0].Subject.CommonName != ca.ServerName {
+					api.error(w, r, "Forbidden", fmt.Errorf("certificate does not belong to the server"), http.StatusUnauthorized)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Once the agent has a certificate, the server must use its own when it
+			// connects directly. Requests over the tunnel have no TLS state.
+			if r.TLS != nil && api.manager.HasCertificate() {
+				api.error(w, r, "Forbidden", fmt.Errorf("no client certificate"), http.StatusUnauthorized)
+				return
+			}
+
+			if !api.manager.AcceptsPSK(r.Header.Get("X-PSK")) {
 				api.error(w, r, "Forbidden", fmt.Errorf("incorrect PSK"), http.StatusUnauthorized)
 				return
 			}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"zerosrealm.xyz/tergum/internal/agent/api/request"
+)
+
+// ForgetJob runs a forget policy in the background and reports the result as job
+// progress, like backups do.
+func (api *API) ForgetJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req request.Forget
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		if req.Job.ID == "" {
+			api.error(w, r, "No job given.", fmt.Errorf("no job given"), http.StatusBadRequest)
+			return
+		}
+
+		if req.Repo == nil {
+			api.error(w, r, "No repository given.", fmt.Errorf("no repository given"), http.StatusBadRequest)
+			return
+		}
+
+		if req.Policy == nil {
+			api.error(w, r, "No forget policy given.", fmt.Errorf("no forget policy given"), http.StatusBadRequest)
+			return
+		}
+
+		go api.manager.ForgetJob(req.Job.ID, req.Repo, req.Options())
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"zerosrealm.xyz/tergum/internal/agent/api/request"
+)
+
+// PreparePSK is the first phase of a PSK rotation by the server.
+func (api *API) PreparePSK() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req *request.PSK
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		err = api.manager.PreparePSK(req.PSK)
+		if err != nil {
+			api.error(w, r, "Could not prepare PSK.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
+
+// CommitPSK is the second phase of a PSK rotation by the server.
+func (api *API) CommitPSK() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req *request.PSK
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		err = api.manager.CommitPSK(req.PSK)
+		if err != nil {
+			api.error(w, r, "Could not commit PSK.", err, http.StatusConflict)
+			return
+		}
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"zerosrealm.xyz/tergum/internal/queue"
+)
+
+func (api *API) GetQueues() http.HandlerFunc {
+	type response struct {
+		Queues []queue.Stats `json:"queues"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		api.respond(w, r, response{Queues: api.manager.QueueStats()}, http.StatusOK)
+	}
+}
@@ -4,6 +4,7 @@ import "zerosrealm.xyz/tergum/internal/entity"
 
 type Backup struct {
 	Job
-	Repo   *entity.Repo   `json:"repo"`
-	Backup *entity.Backup `json:"backup"`
+	Repo     *entity.Repo     `json:"repo"`
+	Backup   *entity.Backup   `json:"backup"`
+	Schedule *entity.Schedule `json:"schedule"`
 }
@@ -0,0 +1,6 @@
+package request
+
+// PSK to prepare or commit during a rotation.
+type PSK struct {
+	PSK string `json:"psk"`
+}
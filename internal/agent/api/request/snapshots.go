@@ -1,14 +1,38 @@
 package request
 
-import "zerosrealm.xyz/tergum/internal/entity"
+import (
+	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/restic"
+)
 
 type GetSnapshots struct {
 	Repo *entity.Repo `json:"repo"`
 }
 
 type Forget struct {
+	Job
 	Repo   *entity.Repo   `json:"repo"`
 	Policy *entity.Forget `json:"policy"`
+	DryRun bool           `json:"dry_run"`
+}
+
+// Options for running the forget policy with restic.
+func (req *Forget) Options() *restic.ForgetOptions {
+	return &restic.ForgetOptions{
+		LastX:    req.Policy.LastX,
+		Hourly:   req.Policy.Hourly,
+		Daily:    req.Policy.Daily,
+		Weekly:   req.Policy.Weekly,
+		Monthly:  req.Policy.Monthly,
+		Yearly:   req.Policy.Yearly,
+		Within:   req.Policy.Within,
+		KeepTags: req.Policy.KeepTags,
+		GroupBy:  req.Policy.GroupBy,
+		Hosts:    req.Policy.Hosts,
+		Paths:    req.Policy.Paths,
+		DryRun:   req.DryRun,
+		JSON:     req.DryRun,
+	}
 }
 
 type DeleteSnapshot struct {
@@ -65,16 +65,12 @@ func (api *API) Forget() http.HandlerFunc {
 			return
 		}
 
-		options := &restic.ForgetOptions{
-			LastX:   req.Policy.LastX,
-			Hourly:  req.Policy.Hourly,
-			Daily:   req.Policy.Daily,
-			Weekly:  req.Policy.Weekly,
-			Monthly: req.Policy.Monthly,
-			Yearly:  req.Policy.Yearly,
+		if req.Policy == nil {
+			api.error(w, r, "No forget policy given.", fmt.Errorf("no forget policy given"), http.StatusBadRequest)
+			return
 		}
 
-		out, err := api.manager.Forget(req.Repo, nil, options)
+		out, err := api.manager.Forget(req.Repo, nil, req.Options())
 		if err != nil {
 			api.error(w, r, "Could not forget snapshots.", fmt.Errorf("%s: %s", err, out), http.StatusInternalServerError)
 			return
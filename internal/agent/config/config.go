@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/jinzhu/configor"
 	"zerosrealm.xyz/tergum/internal/log"
@@ -20,6 +21,48 @@ type Config struct {
 	Restic       string
 	Server       string
 	Log          log.Config
+
+	// Labels sent to the server when registering, such as env: prod.
+	Labels map[string]string
+
+	// ProgressInterval is the least time in milliseconds between two status
+	// updates of a job sent to the server.
+	ProgressInterval int
+
+	// Outbox is the directory where messages for the server are kept until they
+	// are delivered.
+	Outbox string
+
+	// Tunnel makes the agent keep a connection open to the server and take jobs
+	// over it, for agents the server can't reach.
+	Tunnel bool
+
+	// Address the server reaches the agent at, sent when registering. The
+	// address the agent registered from is used if it is empty.
+	Address string
+
+	// State is the file the agent keeps its PSK and machine ID in.
+	State string
+
+	// Identity is the directory where the certificate issued by the server's CA
+	// is kept. Once the agent has one, it serves the API over HTTPS with it.
+	Identity string
+
+	// TLS serves the API over HTTPS when Cert and Key are set. CA is a PEM file
+	// of the certificates the server is verified against, instead of the
+	// system's.
+	TLS struct {
+		Cert string
+		Key  string
+		CA   string
+	}
+
+	// Heartbeat interval in seconds, and the path whose file system's free space
+	// is reported with each heartbeat.
+	Heartbeat struct {
+		Interval int    `default:"30"`
+		DiskPath string `default:"."`
+	}
 }
 
 // Load config.
@@ -35,6 +78,17 @@ func Load() (*Config, error) {
 	server := os.Getenv("TERGUM_SERVER")
 	restic := os.Getenv("TERGUM_RESTIC")
 	regToken := os.Getenv("TERGUM_REGISTRATION")
+	labels := os.Getenv("TERGUM_LABELS")
+	heartbeat := os.Getenv("TERGUM_HEARTBEAT_INTERVAL")
+	tunnel := os.Getenv("TERGUM_TUNNEL")
+	outbox := os.Getenv("TERGUM_OUTBOX")
+	progressInterval := os.Getenv("TERGUM_PROGRESS_INTERVAL")
+	tlsCert := os.Getenv("TERGUM_TLS_CERT")
+	tlsKey := os.Getenv("TERGUM_TLS_KEY")
+	tlsCA := os.Getenv("TERGUM_TLS_CA")
+	identity := os.Getenv("TERGUM_IDENTITY")
+	state := os.Getenv("TERGUM_STATE")
+	address := os.Getenv("TERGUM_ADDRESS")
 
 	if ip != "" {
 		conf.Listen.IP = ip
@@ -58,6 +112,60 @@ func Load() (*Config, error) {
 	if regToken != "" {
 		conf.Registration = regToken
 	}
+	if labels != "" {
+		parsed, err := parseLabels(labels)
+		if err != nil {
+			return nil, err
+		}
+		conf.Labels = parsed
+	}
+	if heartbeat != "" {
+		num, err := strconv.Atoi(heartbeat)
+		if err != nil {
+			return nil, fmt.Errorf("TERGUM_HEARTBEAT_INTERVAL is not an integer")
+		}
+		conf.Heartbeat.Interval = num
+	}
+	if tunnel != "" {
+		enabled, err := strconv.ParseBool(tunnel)
+		if err != nil {
+			return nil, fmt.Errorf("TERGUM_TUNNEL is not a boolean")
+		}
+		conf.Tunnel = enabled
+	}
+	if outbox != "" {
+		conf.Outbox = outbox
+	}
+	if progressInterval != "" {
+		num, err := strconv.Atoi(progressInterval)
+		if err != nil {
+			return nil, fmt.Errorf("TERGUM_PROGRESS_INTERVAL is not an integer")
+		}
+		conf.ProgressInterval = num
+	}
+	if tlsCert != "" {
+		conf.TLS.Cert = tlsCert
+	}
+	if tlsKey != "" {
+		conf.TLS.Key = tlsKey
+	}
+	if tlsCA != "" {
+		conf.TLS.CA = tlsCA
+	}
+
+	if identity != "" {
+		conf.Identity = identity
+	}
+	if state != "" {
+		conf.State = state
+	}
+	if address != "" {
+		conf.Address = address
+	}
+
+	if (conf.TLS.Cert == "") != (conf.TLS.Key == "") {
+		return nil, fmt.Errorf("TLS cert and key must be set together")
+	}
 
 	if conf.Listen.IP == "" {
 		conf.Listen.IP = "127.0.0.1"
@@ -65,6 +173,38 @@ func Load() (*Config, error) {
 	if conf.Listen.Port == 0 {
 		conf.Listen.Port = 666
 	}
+	if conf.Heartbeat.Interval <= 0 {
+		conf.Heartbeat.Interval = 30
+	}
+	if conf.ProgressInterval <= 0 {
+		conf.ProgressInterval = 1000
+	}
+	if conf.Outbox == "" {
+		conf.Outbox = "outbox"
+	}
+	if conf.Identity == "" {
+		conf.Identity = "identity"
+	}
+	if conf.State == "" {
+		conf.State = "state.json"
+	}
+	if conf.Heartbeat.DiskPath == "" {
+		conf.Heartbeat.DiskPath = "."
+	}
 
 	return &conf, nil
 }
+
+// parseLabels parses labels given as "key=value,key=value".
+func parseLabels(labels string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for _, label := range strings.Split(labels, ",") {
+		kv := strings.SplitN(label, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("TERGUM_LABELS must be a list of key=value pairs")
+		}
+		parsed[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return parsed, nil
+}
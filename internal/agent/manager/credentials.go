@@ -0,0 +1,178 @@
+package manager
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// credentials of the agent, saved to a state file so they survive restarts and
+// rotations. During a rotation the next PSK is known as well, and both are
+// accepted until the server commits to the next one.
+//
+// The state also holds the machine ID, generated on first start, which the
+// server tells the agent apart by when it registers again, wherever from.
+type credentials struct {
+	path string
+
+	mutex sync.RWMutex
+	state credentialState
+}
+
+type credentialState struct {
+	MachineID string `json:"machine_id"`
+	PSK       string `json:"psk"`
+	NextPSK   string `json:"next_psk,omitempty"`
+}
+
+// loadCredentials reads the state file, falling back to the configured PSK when
+// there is none yet. A machine ID is generated and saved if there is none.
+func loadCredentials(path, psk string) (*credentials, error) {
+	creds := &credentials{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("loadCredentials: could not read state: %w", err)
+	}
+
+	if err == nil {
+		err = json.Unmarshal(data, &creds.state)
+		if err != nil {
+			return nil, fmt.Errorf("loadCredentials: could not parse state: %w", err)
+		}
+	}
+
+	if creds.state.PSK == "" {
+		creds.state.PSK = psk
+	}
+
+	if creds.state.MachineID == "" {
+		creds.state.MachineID, err = newMachineID()
+		if err != nil {
+			return nil, err
+		}
+
+		err = creds.save()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return creds, nil
+}
+
+func newMachineID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("loadCredentials: could not generate machine ID: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// save writes the state file, through a temporary file so a crash never leaves
+// the agent without its credentials. The mutex must be held.
+func (creds *credentials) save() error {
+	data, err := json.Marshal(creds.state)
+	if err != nil {
+		return err
+	}
+
+	tmp := creds.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("credentials: could not write state: %w", err)
+	}
+
+	err = os.Rename(tmp, creds.path)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("credentials: could not write state: %w", err)
+	}
+
+	return nil
+}
+
+// MachineID returns the ID the agent registers with.
+func (man *Manager) MachineID() string {
+	man.creds.mutex.RLock()
+	defer man.creds.mutex.RUnlock()
+
+	return man.creds.state.MachineID
+}
+
+// PSK returns the PSK the agent authenticates with.
+func (man *Manager) PSK() string {
+	man.creds.mutex.RLock()
+	defer man.creds.mutex.RUnlock()
+
+	return man.creds.state.PSK
+}
+
+// SetPSK replaces the PSK, as when the server hands one out on registration.
+// The next PSK of a rotation in progress is dropped, as the server drops it too.
+func (man *Manager) SetPSK(psk string) error {
+	man.creds.mutex.Lock()
+	defer man.creds.mutex.Unlock()
+
+	if man.creds.state.PSK == psk && man.creds.state.NextPSK == "" {
+		return nil
+	}
+
+	man.creds.state.PSK = psk
+	man.creds.state.NextPSK = ""
+	return man.creds.save()
+}
+
+// AcceptsPSK reports whether requests with the PSK come from the server, which
+// is the case for the current PSK and during a rotation the next one.
+func (man *Manager) AcceptsPSK(psk string) bool {
+	man.creds.mutex.RLock()
+	defer man.creds.mutex.RUnlock()
+
+	if psk == "" {
+		return false
+	}
+
+	current := subtle.ConstantTimeCompare([]byte(psk), []byte(man.creds.state.PSK)) == 1
+	next := man.creds.state.NextPSK != "" && subtle.ConstantTimeCompare([]byte(psk), []byte(man.creds.state.NextPSK)) == 1
+
+	return current || next
+}
+
+// PreparePSK is the first phase of a rotation. The next PSK is saved and
+// accepted from then on, while the agent keeps using the current one.
+func (man *Manager) PreparePSK(psk string) error {
+	if psk == "" {
+		return fmt.Errorf("manager.PreparePSK: empty PSK")
+	}
+
+	man.creds.mutex.Lock()
+	defer man.creds.mutex.Unlock()
+
+	man.creds.state.NextPSK = psk
+	return man.creds.save()
+}
+
+// CommitPSK is the second phase of a rotation, switching over to the next PSK.
+// Committing the PSK already in use again is fine, as the server retries when
+// it doesn't hear back.
+func (man *Manager) CommitPSK(psk string) error {
+	man.creds.mutex.Lock()
+	defer man.creds.mutex.Unlock()
+
+	if psk != "" && psk == man.creds.state.PSK {
+		return nil
+	}
+
+	if psk == "" || psk != man.creds.state.NextPSK {
+		return fmt.Errorf("manager.CommitPSK: PSK was not prepared")
+	}
+
+	man.creds.state.PSK = psk
+	man.creds.state.NextPSK = ""
+	return man.creds.save()
+}
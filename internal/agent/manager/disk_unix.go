@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package manager
+
+import "syscall"
+
+// freeDisk returns the bytes available to the agent on the file system of path.
+func freeDisk(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
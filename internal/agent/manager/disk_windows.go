@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package manager
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// freeDisk returns the bytes available to the agent on the volume of path.
+func freeDisk(path string) (uint64, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var available, total, free uint64
+	ret, _, err := getDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(name)),
+		uintptr(unsafe.Pointer(&available)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&free)),
+	)
+	if ret == 0 {
+		return 0, err
+	}
+
+	return available, nil
+}
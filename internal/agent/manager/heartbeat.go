@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// HeartbeatHandler sends a heartbeat to the server every configured interval
+// until the context is done.
+func (man *Manager) HeartbeatHandler() {
+	man.log.WithFields("function", "HeartbeatHandler").Debug("Starting")
+
+	ticker := time.NewTicker(time.Duration(man.conf.Heartbeat.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		err := man.sendHeartbeat()
+		if err != nil {
+			man.log.WithFields("function", "HeartbeatHandler").Error("could not send heartbeat:", err)
+		}
+
+		select {
+		case <-man.ctx.Done():
+			man.log.WithFields("function", "HeartbeatHandler").Debug("Context done, stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (man *Manager) heartbeat() *entity.Heartbeat {
+	heartbeat := &entity.Heartbeat{
+		AgentInfo:   man.info,
+		Uptime:      int64(time.Since(man.started).Seconds()),
+		RunningJobs: make([]string, 0),
+	}
+
+	free, err := freeDisk(man.conf.Heartbeat.DiskPath)
+	if err != nil {
+		man.log.WithFields("function", "heartbeat").Error("could not get free disk space:", err)
+	}
+	heartbeat.FreeDisk = free
+
+	man.jobMutex.RLock()
+	for id := range man.jobs {
+		heartbeat.RunningJobs = append(heartbeat.RunningJobs, id)
+	}
+	man.jobMutex.RUnlock()
+	sort.Strings(heartbeat.RunningJobs)
+
+	return heartbeat
+}
+
+func (man *Manager) sendHeartbeat() error {
+	msg, err := json.Marshal(man.heartbeat())
+	if err != nil {
+		return err
+	}
+
+	return man.post("/api/agent/heartbeat", nil, msg)
+}
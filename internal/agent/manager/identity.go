@@ -0,0 +1,265 @@
+package manager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/ca"
+	"zerosrealm.xyz/tergum/internal/tlsconfig"
+)
+
+// certificateCheck is how often the agent's certificate is checked for renewal.
+const certificateCheck = 12 * time.Hour
+
+// identity is the certificate the server's CA issued the agent, kept on disk
+// along with its key and the certificate of the CA.
+type identity struct {
+	dir string
+
+	mutex sync.RWMutex
+	cert  *tls.Certificate
+	pool  *x509.CertPool
+
+	// pending is the key of the certificate request sent to the server, until
+	// the certificate for it arrives.
+	pending []byte
+}
+
+func loadIdentity(dir string) (*identity, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("loadIdentity: could not create directory: %w", err)
+	}
+
+	id := &identity{dir: dir}
+
+	if _, err := os.Stat(id.path("cert.pem")); os.IsNotExist(err) {
+		return id, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(id.path("cert.pem"), id.path("key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("loadIdentity: could not load certificate: %w", err)
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("loadIdentity: could not parse certificate: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(id.path("ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("loadIdentity: could not read CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("loadIdentity: no certificates found in %s", id.path("ca.pem"))
+	}
+
+	id.cert = &cert
+	id.pool = pool
+
+	return id, nil
+}
+
+func (id *identity) path(name string) string {
+	return filepath.Join(id.dir, name)
+}
+
+// certificate returns the agent's certificate, nil if it has none.
+func (id *identity) certificate() *tls.Certificate {
+	id.mutex.RLock()
+	defer id.mutex.RUnlock()
+
+	return id.cert
+}
+
+// CertificateRequest returns a PEM encoded certificate request to send when
+// registering, nil if the agent's certificate is still good.
+func (man *Manager) CertificateRequest() ([]byte, error) {
+	man.identity.mutex.Lock()
+	defer man.identity.mutex.Unlock()
+
+	if man.identity.cert != nil && time.Until(man.identity.cert.Leaf.NotAfter) > ca.RenewBefore {
+		return nil, nil
+	}
+
+	key, csr, err := ca.Request()
+	if err != nil {
+		return nil, err
+	}
+	man.identity.pending = key
+
+	return csr, nil
+}
+
+// SetCertificate stores the certificate the server issued for the last
+// certificate request, along with the certificate of its CA.
+func (man *Manager) SetCertificate(certPEM, caPEM []byte) error {
+	id := man.identity
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+
+	if id.pending == nil {
+		return fmt.Errorf("manager.SetCertificate: no certificate was requested")
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, id.pending)
+	if err != nil {
+		return fmt.Errorf("manager.SetCertificate: invalid certificate: %w", err)
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("manager.SetCertificate: could not parse certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("manager.SetCertificate: no CA certificate found")
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"key.pem", id.pending},
+		{"cert.pem", certPEM},
+		{"ca.pem", caPEM},
+	}
+	for _, file := range files {
+		err = os.WriteFile(id.path(file.name), file.data, 0o600)
+		if err != nil {
+			return fmt.Errorf("manager.SetCertificate: could not write %s: %w", file.name, err)
+		}
+	}
+
+	id.cert = &cert
+	id.pool = pool
+	id.pending = nil
+
+	return nil
+}
+
+// CertificateHandler renews the agent's certificate with the server as it nears
+// expiry, until the context is done. The new certificate is used for the
+// connections made afterwards.
+func (man *Manager) CertificateHandler() {
+	man.log.WithFields("function", "CertificateHandler").Debug("Starting")
+
+	ticker := time.NewTicker(certificateCheck)
+	defer ticker.Stop()
+
+	for {
+		if man.HasCertificate() {
+			err := man.renewCertificate()
+			if err != nil {
+				man.log.WithFields("function", "CertificateHandler").Error("could not renew certificate:", err)
+			}
+		}
+
+		select {
+		case <-man.ctx.Done():
+			man.log.WithFields("function", "CertificateHandler").Debug("Context done, stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (man *Manager) renewCertificate() error {
+	csr, err := man.CertificateRequest()
+	if err != nil || csr == nil {
+		return err
+	}
+
+	msg, err := json.Marshal(struct {
+		CSR string `json:"csr"`
+	}{CSR: string(csr)})
+	if err != nil {
+		return err
+	}
+
+	body, err := man.request("/api/agent/certificate", nil, msg)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Certificate string `json:"certificate"`
+		CA          string `json:"ca"`
+	}
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return fmt.Errorf("could not unmarshal response: %w", err)
+	}
+
+	err = man.SetCertificate([]byte(resp.Certificate), []byte(resp.CA))
+	if err != nil {
+		return err
+	}
+
+	man.log.WithFields("function", "CertificateHandler").Info("Renewed certificate")
+
+	return nil
+}
+
+// HasCertificate reports whether the agent was issued a certificate, in which
+// case it serves HTTPS with it and the server has to authenticate with its own.
+func (man *Manager) HasCertificate() bool {
+	return man.identity.certificate() != nil
+}
+
+// ServerTLSConfig returns the TLS config for serving the API, nil if it is
+// served over plain HTTP.
+func (man *Manager) ServerTLSConfig() (*tls.Config, error) {
+	// The certificate from the server's CA goes first, as it is how the server
+	// knows it reached the right agent.
+	var conf *tls.Config
+	switch {
+	case man.HasCertificate():
+		conf = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return man.identity.certificate(), nil
+			},
+		}
+	case man.conf.TLS.Cert != "":
+		var err error
+		conf, err = tlsconfig.Server(man.conf.TLS.Cert, man.conf.TLS.Key)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	man.identity.mutex.RLock()
+	pool := man.identity.pool
+	man.identity.mutex.RUnlock()
+
+	if pool != nil {
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		conf.ClientCAs = pool
+	}
+
+	return conf, nil
+}
+
+// clientCertificate presents the agent's certificate to the server, if it has
+// one.
+func (man *Manager) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert := man.identity.certificate()
+	if cert == nil {
+		return &tls.Certificate{}, nil
+	}
+
+	return cert, nil
+}
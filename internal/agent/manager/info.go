@@ -0,0 +1,35 @@
+package manager
+
+import (
+	"runtime"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// Version of the agent, set when building with
+// -ldflags "-X zerosrealm.xyz/tergum/internal/agent/manager.Version=v1.0.0".
+var Version = "dev"
+
+// loadInfo runs restic to find its version. The agent still starts if that
+// fails, it is then reported without a restic version.
+func (man *Manager) loadInfo() {
+	man.info = entity.AgentInfo{
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		AgentVersion: Version,
+	}
+
+	version, err := man.restic.Version()
+	if err != nil {
+		man.log.WithFields("function", "loadInfo").Error("could not get restic version:", err)
+		return
+	}
+	man.info.ResticVersion = version
+
+	man.log.WithFields("function", "loadInfo").Info("Running restic", version, "on", man.info.OS+"/"+man.info.Arch)
+}
+
+// Info returns the platform of the agent and the versions it runs.
+func (man *Manager) Info() entity.AgentInfo {
+	return man.info
+}
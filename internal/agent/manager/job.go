@@ -1,13 +1,29 @@
 package manager
 
 import (
+	"encoding/json"
+
 	"zerosrealm.xyz/tergum/internal/entity"
 	"zerosrealm.xyz/tergum/internal/restic"
 )
 
-func (man *Manager) Backup(job string, repo *entity.Repo, backup *entity.Backup) {
+func (man *Manager) Backup(job string, repo *entity.Repo, backup *entity.Backup, schedule *entity.Schedule) {
 	man.log.WithFields("function", "backup", "job", job).Info("Starting job")
-	out, err := man.restic.Backup(repo.Repo, backup.Source, repo.Password, backup.Exclude, job, repo.Settings...)
+
+	var tags, options []string
+	if schedule != nil {
+		tags = schedule.Tags
+		options = schedule.Options
+	}
+
+	defer func() {
+		man.jobMutex.Lock()
+		defer man.jobMutex.Unlock()
+
+		delete(man.jobs, job)
+	}()
+
+	out, err := man.restic.Backup(repo.Repo, backup.Source, repo.Password, backup.Exclude, tags, options, job, repo.Settings...)
 	if err != nil {
 		man.jobErrors <- jobError{JobID: job, Error: err, Msg: out}
 		man.log.WithFields("function", "backup", "job", job, "output", string(out)).Error("restic backup error:", err)
@@ -80,6 +96,42 @@ func (man *Manager) Forget(repo *entity.Repo, snapshots []string, options *resti
 	return out, nil
 }
 
+type forgetSummary struct {
+	MessageType string `json:"message_type"`
+	Output      string `json:"output"`
+}
+
+// ForgetJob runs the forget policy and sends the output to the server as the
+// job's summary.
+func (man *Manager) ForgetJob(job string, repo *entity.Repo, options *restic.ForgetOptions) {
+	man.log.WithFields("function", "forgetJob", "job", job).Info("Starting job")
+
+	defer func() {
+		man.jobMutex.Lock()
+		defer man.jobMutex.Unlock()
+
+		delete(man.jobs, job)
+	}()
+
+	out, err := man.restic.ForgetJob(job, repo.Repo, repo.Password, options, repo.Settings...)
+	if err != nil {
+		man.jobErrors <- jobError{JobID: job, Error: err, Msg: out}
+		man.log.WithFields("function", "forgetJob", "job", job, "output", string(out)).Error("restic forget error:", err)
+		return
+	}
+
+	msg, err := json.Marshal(forgetSummary{MessageType: "summary", Output: string(out)})
+	if err != nil {
+		man.log.WithFields("function", "forgetJob", "job", job).Error("marshalling summary error:", err)
+		return
+	}
+
+	select {
+	case man.restic.Updates <- restic.JobUpdate{ID: job, Msg: msg}:
+	case <-man.ctx.Done():
+	}
+}
+
 func (man *Manager) List(repo *entity.Repo, snapshot string) ([]*restic.FileNode, error) {
 	man.log.WithFields("function", "list").Info("Starting request")
 	nodes, err := man.restic.List(repo.Repo, repo.Password, snapshot, repo.Settings...)
@@ -1,11 +1,9 @@
 package manager
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -13,8 +11,12 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/egonelbre/antifreeze"
 	"zerosrealm.xyz/tergum/internal/agent/config"
+	"zerosrealm.xyz/tergum/internal/entity"
 	"zerosrealm.xyz/tergum/internal/log"
+	"zerosrealm.xyz/tergum/internal/queue"
 	"zerosrealm.xyz/tergum/internal/restic"
+	"zerosrealm.xyz/tergum/internal/tlsconfig"
+	"zerosrealm.xyz/tergum/internal/tunnel"
 )
 
 func init() {
@@ -32,11 +34,28 @@ type Manager struct {
 	log    *log.Logger
 	restic *restic.Restic
 
-	conf *config.Config
+	conf    *config.Config
+	started time.Time
+	info    entity.AgentInfo
+
+	// tlsConfig verifies the server and presents the agent's certificate, for
+	// client and the tunnel.
+	tlsConfig *tls.Config
+	client    *http.Client
+	identity  *identity
+	creds     *credentials
 
 	jobMutex  sync.RWMutex
 	jobs      map[string]*restic.Job
 	jobErrors chan jobError
+
+	outbox *outbox
+	status *queue.Queue
+
+	// tunnelReady is closed while the tunnel to the server is up.
+	tunnelMutex sync.Mutex
+	tunnel      *tunnel.Conn
+	tunnelReady chan struct{}
 }
 
 func New(ctx context.Context, conf *config.Config, resticExe *restic.Restic) (*Manager, error) {
@@ -45,17 +64,52 @@ func New(ctx context.Context, conf *config.Config, resticExe *restic.Restic) (*M
 		return nil, err
 	}
 
-	return &Manager{
+	tlsConf, err := tlsconfig.Client(conf.TLS.CA)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := loadIdentity(conf.Identity)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := loadCredentials(conf.State, conf.PSK)
+	if err != nil {
+		return nil, err
+	}
+
+	box, err := newOutbox(conf.Outbox)
+	if err != nil {
+		return nil, err
+	}
+
+	man := &Manager{
 		ctx:    ctx,
 		log:    log,
 		restic: resticExe,
 
-		conf: conf,
+		conf:    conf,
+		started: time.Now(),
+
+		tlsConfig: tlsConf,
+		client:    tlsconfig.HTTPClient(tlsConf),
+		identity:  id,
+		creds:     creds,
 
 		jobMutex:  sync.RWMutex{},
 		jobs:      make(map[string]*restic.Job, 100),
 		jobErrors: make(chan jobError),
-	}, nil
+
+		outbox: box,
+		status: queue.New("status", statusQueueSize),
+
+		tunnelReady: make(chan struct{}),
+	}
+	man.loadInfo()
+	tlsConf.GetClientCertificate = man.clientCertificate
+
+	return man, nil
 }
 
 type jobProgress struct {
@@ -69,44 +123,33 @@ type jobUpdate struct {
 
 func (man *Manager) UpdateHandler() {
 	man.log.WithFields("function", "UpdateHandler").Debug("Starting")
+
+	interval := time.Duration(man.conf.ProgressInterval) * time.Millisecond
+	coalesced := newProgress(interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-man.ctx.Done():
 			man.log.WithFields("function", "UpdateHandler").Debug("Context done, stopping")
 			return
 		case update := <-man.restic.Updates:
-			msg, err := json.Marshal(jobProgress{Msg: update.Msg})
-			if err != nil {
-				man.log.WithFields("function", "UpdateHandler", "job", update.ID).Debug("update dump:", spew.Sdump(update))
-				man.log.WithFields("function", "UpdateHandler", "job", update.ID).Error("marshalling update error:", err)
-				continue
-			}
-
-			req, err := http.NewRequest("POST", man.conf.Server+"/api/job/"+update.ID+"/progress", bytes.NewReader(msg))
-			if err != nil {
-				man.log.WithFields("function", "UpdateHandler", "job", update.ID).Error("error:", err)
+			// The messages that end a job must reach the server, the rest are only
+			// worth sending while they are current.
+			if restic.IsTerminal(update.Msg) {
+				coalesced.done(update.ID)
+				man.sendUpdate(update, true)
 				continue
 			}
 
-			req.Header.Add("authorization", fmt.Sprintf("PSK %s", man.conf.PSK))
-
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				man.log.WithFields("function", "UpdateHandler", "job", update.ID).Error("marshalling update error:", err)
-				continue
+			if coalesced.add(update, time.Now()) {
+				man.sendUpdate(update, false)
 			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode > 299 {
-				body, err := io.ReadAll(resp.Body)
-				if err != nil {
-					man.log.WithFields("function", "UpdateHandler", "job", update.ID).Error("non-2XX status:", resp.Status, "body read error:", err)
-					continue
-				}
-				man.log.WithFields("function", "UpdateHandler", "job", update.ID).Error("non-2XX status:", resp.Status, "body:", string(body))
+		case <-ticker.C:
+			for _, update := range coalesced.due(time.Now()) {
+				man.sendUpdate(update, false)
 			}
-
-			man.log.WithFields("function", "UpdateHandler", "job", update.ID).Debug("Successfully sent update.")
 		case job := <-man.restic.Jobs:
 			man.jobMutex.Lock()
 
@@ -117,53 +160,53 @@ func (man *Manager) UpdateHandler() {
 			man.jobs[job.ID] = job
 			man.jobMutex.Unlock()
 		case jobErr := <-man.jobErrors:
-			man.jobMutex.Lock()
-
+			coalesced.done(jobErr.JobID)
 			man.log.WithFields("function", "UpdateHandler", "job", jobErr.JobID).Error("job error:", jobErr.Error)
 
 			msg, err := json.Marshal(jobUpdate{Msg: string(jobErr.Msg), Error: jobErr.Error.Error()})
 			if err != nil {
 				man.log.WithFields("function", "UpdateHandler").Debug("jobError dump:", spew.Sdump(jobErr))
 				man.log.WithFields("function", "UpdateHandler").Error("marshalling jobError error:", err)
-				man.jobMutex.Unlock()
 				continue
 			}
 
-			req, err := http.NewRequest("POST", man.conf.Server+"/api/job/"+jobErr.JobID+"/error", bytes.NewReader(msg))
+			err = man.outbox.add("/api/job/"+jobErr.JobID+"/error", msg)
 			if err != nil {
-				man.log.WithFields("function", "UpdateHandler").Error("error:", err)
-				man.jobMutex.Unlock()
-				continue
+				man.log.WithFields("function", "UpdateHandler").Error("adding jobError to outbox error:", err)
 			}
+		}
+	}
+}
 
-			req.Header.Add("authorization", fmt.Sprintf("PSK %s", man.conf.PSK))
+// sendUpdate sends the job update to the server, through the outbox if it must
+// not get lost, and through the status queue otherwise.
+func (man *Manager) sendUpdate(update restic.JobUpdate, durable bool) {
+	msg, err := json.Marshal(jobProgress{Msg: update.Msg})
+	if err != nil {
+		man.log.WithFields("function", "UpdateHandler", "job", update.ID).Debug("update dump:", spew.Sdump(update))
+		man.log.WithFields("function", "UpdateHandler", "job", update.ID).Error("marshalling update error:", err)
+		return
+	}
 
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				man.log.WithFields("function", "UpdateHandler").Error("marshalling update error:", err)
-				man.jobMutex.Unlock()
-				continue
-			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != 200 {
-				body, err := io.ReadAll(resp.Body)
-				if err != nil {
-					man.log.WithFields("function", "UpdateHandler").Error("non-200 status:", resp.Status, "body read error:", err)
-					man.jobMutex.Unlock()
-					continue
-				}
-				man.log.WithFields("function", "UpdateHandler").Error("non-200 status:", resp.Status, "body:", string(body))
-			}
-		default:
-			select {
-			case <-man.ctx.Done():
-				man.log.WithFields("function", "UpdateHandler").Debug("Context done, stopping")
-				return
-			default:
-			}
+	if durable {
+		err = man.outbox.add("/api/job/"+update.ID+"/progress", msg)
+		if err != nil {
+			man.log.WithFields("function", "UpdateHandler", "job", update.ID).Error("adding update to outbox error:", err)
 		}
+		return
 	}
+
+	man.queueStatus("/api/job/"+update.ID+"/progress", msg)
+}
+
+// Client returns the HTTP client for requests to the server.
+func (man *Manager) Client() *http.Client {
+	return man.client
+}
+
+// TLSConfig returns the TLS config for connections to the server.
+func (man *Manager) TLSConfig() *tls.Config {
+	return man.tlsConfig
 }
 
 func (man *Manager) Cancel() {
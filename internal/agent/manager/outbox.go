@@ -0,0 +1,235 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+const (
+	minRetryDelay = 1 * time.Second
+	maxRetryDelay = 5 * time.Minute
+)
+
+// outboxMessage is a message to the server waiting in the outbox. The ID is sent
+// along so the server can ignore messages it already got when a retry follows a
+// lost response.
+type outboxMessage struct {
+	ID   string          `json:"id"`
+	Path string          `json:"path"`
+	Body json.RawMessage `json:"body"`
+}
+
+// outbox keeps messages that must reach the server on disk until they are
+// delivered, one file per message named after its sequence number so they are
+// sent in order, even across restarts.
+type outbox struct {
+	dir string
+
+	mutex sync.Mutex
+	seq   uint64
+	wake  chan struct{}
+}
+
+func newOutbox(dir string) (*outbox, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("newOutbox: could not create directory: %w", err)
+	}
+
+	box := &outbox{
+		dir:  dir,
+		wake: make(chan struct{}, 1),
+	}
+
+	files, err := box.files()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) != 0 {
+		last := strings.SplitN(files[len(files)-1], "-", 2)[0]
+		box.seq, err = strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("newOutbox: invalid file name %q", files[len(files)-1])
+		}
+	}
+
+	return box, nil
+}
+
+// files returns the names of the message files in the order they were added.
+func (box *outbox) files() ([]string, error) {
+	entries, err := os.ReadDir(box.dir)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: could not read directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// add writes the message to disk. It is written to a temporary file first so a
+// crash never leaves half a message behind.
+func (box *outbox) add(path string, body []byte) error {
+	id := xid.New().String()
+	msg, err := json.Marshal(outboxMessage{
+		ID:   id,
+		Path: path,
+		Body: body,
+	})
+	if err != nil {
+		return err
+	}
+
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+
+	box.seq++
+	name := fmt.Sprintf("%020d-%s.json", box.seq, id)
+
+	tmp := filepath.Join(box.dir, name+".tmp")
+	err = os.WriteFile(tmp, msg, 0o600)
+	if err != nil {
+		return fmt.Errorf("outbox: could not write message: %w", err)
+	}
+
+	err = os.Rename(tmp, filepath.Join(box.dir, name))
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("outbox: could not write message: %w", err)
+	}
+
+	select {
+	case box.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// next returns the oldest message and its file name, nil if the outbox is empty.
+func (box *outbox) next() (*outboxMessage, string, error) {
+	files, err := box.files()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(files) == 0 {
+		return nil, "", nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(box.dir, files[0]))
+	if err != nil {
+		return nil, files[0], fmt.Errorf("outbox: could not read message: %w", err)
+	}
+
+	var msg outboxMessage
+	err = json.Unmarshal(data, &msg)
+	if err != nil {
+		return nil, files[0], fmt.Errorf("outbox: could not parse message: %w", err)
+	}
+
+	return &msg, files[0], nil
+}
+
+func (box *outbox) remove(name string) error {
+	return os.Remove(filepath.Join(box.dir, name))
+}
+
+// rejected reports whether the server refused the message for good, so that
+// retrying it won't help. Failed authentication is retried, as it may be fixed
+// on the server in the meantime.
+func rejected(err error) bool {
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	switch statusErr.status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+
+	return statusErr.status >= 400 && statusErr.status < 500
+}
+
+// OutboxHandler delivers the messages in the outbox to the server in order. A
+// message is retried with a growing delay until the server takes it, or until
+// the server rejects it as a bad request, which retrying won't fix.
+func (man *Manager) OutboxHandler() {
+	man.log.WithFields("function", "OutboxHandler").Debug("Starting")
+
+	delay := minRetryDelay
+	for {
+		msg, name, err := man.outbox.next()
+		if err != nil && name != "" {
+			// A message that can't be read will never be sent.
+			man.log.WithFields("function", "OutboxHandler", "file", name).Error("dropping message:", err)
+			man.outbox.remove(name)
+			continue
+		}
+		if err != nil {
+			man.log.WithFields("function", "OutboxHandler").Error(err)
+		}
+
+		if msg == nil {
+			select {
+			case <-man.ctx.Done():
+				man.log.WithFields("function", "OutboxHandler").Debug("Context done, stopping")
+				return
+			case <-man.outbox.wake:
+			}
+			continue
+		}
+
+		header := make(http.Header)
+		header.Set("X-Message-ID", msg.ID)
+
+		err = man.post(msg.Path, header, msg.Body)
+
+		if err == nil || rejected(err) {
+			if err != nil {
+				man.log.WithFields("function", "OutboxHandler", "message", msg.ID).Error("server rejected message, dropping it:", err)
+			}
+
+			err = man.outbox.remove(name)
+			if err != nil {
+				man.log.WithFields("function", "OutboxHandler", "message", msg.ID).Error("could not remove delivered message:", err)
+			}
+			delay = minRetryDelay
+			continue
+		}
+
+		man.log.WithFields("function", "OutboxHandler", "message", msg.ID).Warn("could not deliver message, retrying in", delay, "error:", err)
+
+		select {
+		case <-man.ctx.Done():
+			man.log.WithFields("function", "OutboxHandler").Debug("Context done, stopping")
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/restic"
+)
+
+// progress coalesces the status updates of running jobs, so that at most one
+// per interval is sent for each job. The first update of a job is always sent
+// at once, later ones replace the update waiting to be sent.
+type progress struct {
+	interval time.Duration
+	lastSent map[string]time.Time
+	pending  map[string]restic.JobUpdate
+}
+
+func newProgress(interval time.Duration) *progress {
+	return &progress{
+		interval: interval,
+		lastSent: make(map[string]time.Time),
+		pending:  make(map[string]restic.JobUpdate),
+	}
+}
+
+// add reports whether the update should be sent now. If not, it is kept until it
+// is due.
+func (p *progress) add(update restic.JobUpdate, now time.Time) bool {
+	last, ok := p.lastSent[update.ID]
+	if !ok || now.Sub(last) >= p.interval {
+		p.lastSent[update.ID] = now
+		delete(p.pending, update.ID)
+		return true
+	}
+
+	p.pending[update.ID] = update
+	return false
+}
+
+// due returns the waiting updates that may be sent by now.
+func (p *progress) due(now time.Time) []restic.JobUpdate {
+	var updates []restic.JobUpdate
+	for id, update := range p.pending {
+		if now.Sub(p.lastSent[id]) < p.interval {
+			continue
+		}
+
+		updates = append(updates, update)
+		p.lastSent[id] = now
+		delete(p.pending, id)
+	}
+
+	// Jobs that stopped without a summary are forgotten after a while.
+	for id, last := range p.lastSent {
+		if _, ok := p.pending[id]; !ok && now.Sub(last) > time.Minute {
+			delete(p.lastSent, id)
+		}
+	}
+
+	return updates
+}
+
+// done forgets the job, dropping its waiting update.
+func (p *progress) done(jobID string) {
+	delete(p.lastSent, jobID)
+	delete(p.pending, jobID)
+}
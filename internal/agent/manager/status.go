@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"zerosrealm.xyz/tergum/internal/queue"
+)
+
+// statusQueueSize is how many status updates may wait for the server. They are
+// only worth sending while they are current, so older ones are dropped first.
+const statusQueueSize = 100
+
+// statusMessage is a status update waiting in the status queue.
+type statusMessage struct {
+	path string
+	body []byte
+}
+
+// StatusHandler sends the queued status updates to the server, one at a time so
+// a slow server only holds up its own queue.
+func (man *Manager) StatusHandler() {
+	man.log.WithFields("function", "StatusHandler").Debug("Starting")
+
+	man.status.Run(man.ctx, func(item interface{}) error {
+		msg := item.(statusMessage)
+
+		err := man.post(msg.path, nil, msg.body)
+		if err != nil {
+			man.log.WithFields("function", "StatusHandler", "path", msg.path).Error("sending status update error:", err)
+			return err
+		}
+
+		man.log.WithFields("function", "StatusHandler", "path", msg.path).Debug("Successfully sent status update.")
+		return nil
+	})
+
+	man.log.WithFields("function", "StatusHandler").Debug("Context done, stopping")
+}
+
+// queueStatus queues the status update for the server.
+func (man *Manager) queueStatus(path string, body []byte) {
+	if man.status.Push(statusMessage{path: path, body: body}) {
+		man.log.WithFields("function", "queueStatus").Warn("server is too slow, dropped a status update")
+	}
+}
+
+// QueueStats returns the stats of the queue of status updates.
+func (man *Manager) QueueStats() []queue.Stats {
+	return []queue.Stats{man.status.Stats()}
+}
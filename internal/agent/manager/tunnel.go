@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"zerosrealm.xyz/tergum/internal/tunnel"
+)
+
+// SetTunnel sets the tunnel to the server, nil once it has closed.
+func (man *Manager) SetTunnel(conn *tunnel.Conn) {
+	man.tunnelMutex.Lock()
+	defer man.tunnelMutex.Unlock()
+
+	connected := man.tunnel != nil
+	man.tunnel = conn
+
+	switch {
+	case conn != nil && !connected:
+		close(man.tunnelReady)
+	case conn == nil && connected:
+		man.tunnelReady = make(chan struct{})
+	}
+}
+
+// waitTunnel returns the tunnel to the server, waiting for the agent to
+// reconnect if it is down.
+func (man *Manager) waitTunnel() (*tunnel.Conn, error) {
+	for {
+		man.tunnelMutex.Lock()
+		conn, ready := man.tunnel, man.tunnelReady
+		man.tunnelMutex.Unlock()
+
+		if conn != nil {
+			return conn, nil
+		}
+
+		select {
+		case <-man.ctx.Done():
+			return nil, man.ctx.Err()
+		case <-ready:
+		}
+	}
+}
+
+// statusError is returned by post for non-2XX responses.
+type statusError struct {
+	status int
+	body   []byte
+}
+
+func (err *statusError) Error() string {
+	return fmt.Sprintf("non-2XX status: %d, body: %s", err.status, string(err.body))
+}
+
+// post sends the message to the server's API, over the tunnel if the agent
+// uses one. Messages sent while the tunnel is down are sent once it is back up.
+// The header is optional.
+func (man *Manager) post(path string, header http.Header, msg []byte) error {
+	_, err := man.request(path, header, msg)
+	return err
+}
+
+// request is post returning the body of the response.
+func (man *Manager) request(path string, header http.Header, msg []byte) ([]byte, error) {
+	var status int
+	var body []byte
+	var err error
+	if man.conf.Tunnel {
+		status, body, err = man.postTunnel(path, header, msg)
+	} else {
+		status, body, err = man.postHTTP(path, header, msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if status > 299 {
+		return nil, &statusError{status: status, body: body}
+	}
+
+	return body, nil
+}
+
+func (man *Manager) postTunnel(path string, header http.Header, msg []byte) (int, []byte, error) {
+	for {
+		conn, err := man.waitTunnel()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		status, body, err := conn.Do(man.ctx, "POST", path, header, msg)
+		if errors.Is(err, tunnel.ErrClosed) {
+			continue
+		}
+
+		return status, body, err
+	}
+}
+
+func (man *Manager) postHTTP(path string, header http.Header, msg []byte) (int, []byte, error) {
+	req, err := http.NewRequest("POST", man.conf.Server+path, bytes.NewReader(msg))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	req.Header.Add("authorization", fmt.Sprintf("PSK %s", man.PSK()))
+
+	resp, err := man.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("body read error: %w", err)
+	}
+
+	return resp.StatusCode, body, nil
+}
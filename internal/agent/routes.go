@@ -28,18 +28,22 @@ func (srv *Server) routes() {
 	srv.router.NewRoute().HandlerFunc(corsHandler).Methods("OPTIONS")
 	srv.router.StrictSlash(true)
 
-	api := api.New(srv.log.WithFields("component", "api"), srv.restic, srv.manager, srv.conf.PSK)
+	api := api.New(srv.log.WithFields("component", "api"), srv.restic, srv.manager)
 
 	apiRoute := srv.router.PathPrefix("/api/").Subrouter()
 	apiRoute.Use(api.Authenticate())
 
 	apiRoute.Handle("/backup", api.Backup()).Methods("POST")
+	apiRoute.Handle("/forget", api.ForgetJob()).Methods("POST")
 	apiRoute.Handle("/stop", api.Stop()).Methods("POST")
 	apiRoute.Handle("/snapshot", api.GetSnapshots()).Methods("POST")
 	apiRoute.Handle("/snapshot", api.DeleteSnapshot()).Methods("DELETE")
 	apiRoute.Handle("/snapshot/list", api.ListSnapshot()).Methods("POST")
 	apiRoute.Handle("/snapshot/forget", api.Forget()).Methods("POST")
 	apiRoute.Handle("/snapshot/restore", api.Restore()).Methods("POST")
+	apiRoute.Handle("/queue", api.GetQueues()).Methods("GET")
+	apiRoute.Handle("/psk", api.PreparePSK()).Methods("POST")
+	apiRoute.Handle("/psk/commit", api.CommitPSK()).Methods("POST")
 
 	srv.router.Use(mux.CORSMethodMiddleware(srv.router))
 	srv.router.Use(cors)
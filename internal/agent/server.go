@@ -63,11 +63,24 @@ func NewServer(conf *config.Config) (*Server, error) {
 	return srv, nil
 }
 
+// Manager returns the manager of the agent, which holds what it registers with.
+func (srv *Server) Manager() *manager.Manager {
+	return srv.manager
+}
+
 // Start to serve HTTP.
 func (srv *Server) Start() {
 	defer srv.log.Close()
 
 	go srv.manager.UpdateHandler()
+	go srv.manager.HeartbeatHandler()
+	go srv.manager.OutboxHandler()
+	go srv.manager.StatusHandler()
+	go srv.manager.CertificateHandler()
+
+	if srv.conf.Tunnel {
+		go srv.tunnel()
+	}
 
 	listener := &http.Server{
 		Handler:      srv,
@@ -77,10 +90,24 @@ func (srv *Server) Start() {
 		IdleTimeout:  time.Second * 60,
 	}
 
-	srv.log.Info(fmt.Sprintf("Listening on %s:%d", srv.conf.Listen.IP, srv.conf.Listen.Port))
+	tlsConf, err := srv.manager.ServerTLSConfig()
+	if err != nil {
+		srv.log.Fatal(err)
+	}
+	useTLS := tlsConf != nil
+	listener.TLSConfig = tlsConf
+
+	srv.log.Info(fmt.Sprintf("Listening on %s:%d", srv.conf.Listen.IP, srv.conf.Listen.Port), "tls:", useTLS)
 
 	go func() {
-		if err := listener.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if useTLS {
+			// The certificate is already in the listener's TLS config.
+			err = listener.ListenAndServeTLS("", "")
+		} else {
+			err = listener.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			srv.log.Fatal(err)
 		}
 	}()
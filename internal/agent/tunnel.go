@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"zerosrealm.xyz/tergum/internal/tunnel"
+)
+
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 1 * time.Minute
+)
+
+// tunnelURL returns the websocket URL of the server's tunnel endpoint.
+func tunnelURL(server string) string {
+	switch {
+	case strings.HasPrefix(server, "https://"):
+		server = "wss://" + strings.TrimPrefix(server, "https://")
+	case strings.HasPrefix(server, "http://"):
+		server = "ws://" + strings.TrimPrefix(server, "http://")
+	}
+
+	return strings.TrimSuffix(server, "/") + "/api/agent/tunnel"
+}
+
+// tunnel keeps a tunnel open to the server, reconnecting with a growing delay
+// whenever it drops, until the agent stops.
+func (srv *Server) tunnel() {
+	delay := minReconnectDelay
+	for {
+		connected, err := srv.serveTunnel()
+		if err != nil {
+			srv.log.WithFields("function", "tunnel").Error("tunnel error:", err)
+		}
+
+		if connected {
+			delay = minReconnectDelay
+		}
+
+		select {
+		case <-srv.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// serveTunnel connects to the server and serves the tunnel until it closes. It
+// reports whether the connection was made.
+func (srv *Server) serveTunnel() (bool, error) {
+	header := make(http.Header)
+	header.Set("authorization", fmt.Sprintf("PSK %s", srv.manager.PSK()))
+
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = srv.manager.TLSConfig()
+
+	ws, _, err := dialer.DialContext(srv.ctx, tunnelURL(srv.conf.Server), header)
+	if err != nil {
+		return false, fmt.Errorf("could not connect: %w", err)
+	}
+
+	// Requests from the server are served by the agent's own API. The tunnel
+	// is how they are authenticated, so they get whatever the PSK is by then.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("X-PSK", srv.manager.PSK())
+		srv.router.ServeHTTP(w, r)
+	})
+	conn := tunnel.New(ws, handler, nil)
+
+	go func() {
+		select {
+		case <-srv.ctx.Done():
+			conn.Close()
+		case <-conn.Done():
+		}
+	}()
+
+	srv.log.WithFields("function", "tunnel").Info("Tunnel to server opened")
+	srv.manager.SetTunnel(conn)
+	defer srv.manager.SetTunnel(nil)
+
+	err = conn.Serve()
+	srv.log.WithFields("function", "tunnel").Info("Tunnel to server closed")
+
+	return true, err
+}
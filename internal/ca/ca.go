@@ -0,0 +1,342 @@
+// Package ca is the small certificate authority the server runs to give agents
+// certificates, so the server and its agents can authenticate each other by
+// mutual TLS.
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+
+	// RenewBefore is how long before it expires a certificate is replaced.
+	RenewBefore = 30 * 24 * time.Hour
+)
+
+// ServerName is the common name of the certificate the server authenticates
+// with to agents.
+const ServerName = "tergum-server"
+
+const agentPrefix = "agent-"
+
+// AgentName returns the common name of the certificate of the agent.
+func AgentName(id int) string {
+	return agentPrefix + strconv.Itoa(id)
+}
+
+// AgentID returns the ID of the agent the certificate was issued to.
+func AgentID(cert *x509.Certificate) (int, error) {
+	name := cert.Subject.CommonName
+	if !strings.HasPrefix(name, agentPrefix) {
+		return 0, fmt.Errorf("ca: %q is not an agent certificate", name)
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(name, agentPrefix))
+	if err != nil {
+		return 0, fmt.Errorf("ca: %q is not an agent certificate", name)
+	}
+
+	return id, nil
+}
+
+// Serial returns the serial number of the certificate as a string, which is
+// how certificates are recorded.
+func Serial(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16)
+}
+
+// CA signs agent certificates. Its own certificate and key, and the client
+// certificate of the server, are kept in a directory.
+type CA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+	pool    *x509.CertPool
+
+	// server is renewed while in use, so is read and replaced under the mutex.
+	dir    string
+	mutex  sync.RWMutex
+	server *tls.Certificate
+}
+
+// Load the CA from the directory, creating it on first use. The server's
+// certificate is renewed as it nears expiry.
+func Load(dir string) (*CA, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("ca: could not create directory: %w", err)
+	}
+
+	ca := &CA{dir: dir}
+
+	certPath := filepath.Join(dir, "ca.pem")
+	keyPath := filepath.Join(dir, "ca-key.pem")
+
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		err = ca.create(certPath, keyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("ca: could not load CA: %w", err)
+	}
+
+	ca.cert, err = x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("ca: could not parse CA certificate: %w", err)
+	}
+	ca.certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+	ca.key = pair.PrivateKey.(crypto.Signer)
+	ca.pool = x509.NewCertPool()
+	ca.pool.AddCert(ca.cert)
+
+	_, err = ca.RenewServer()
+	if err != nil {
+		return nil, err
+	}
+
+	return ca, nil
+}
+
+// create a new self-signed CA.
+func (ca *CA) create(certPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("ca: could not generate key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "tergum CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return fmt.Errorf("ca: could not create CA certificate: %w", err)
+	}
+
+	return writePair(certPath, keyPath, der, key)
+}
+
+// RenewServer loads the server's client certificate, issuing a new one when it
+// is missing or about to expire, and reports whether it did. Connections made
+// afterwards use the new certificate.
+func (ca *CA) RenewServer() (bool, error) {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	if ca.server != nil && time.Until(ca.server.Leaf.NotAfter) > RenewBefore {
+		return false, nil
+	}
+
+	certPath := filepath.Join(ca.dir, "server.pem")
+	keyPath := filepath.Join(ca.dir, "server-key.pem")
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil {
+		leaf, err := x509.ParseCertificate(pair.Certificate[0])
+		if err == nil && time.Until(leaf.NotAfter) > RenewBefore && ca.Verify(leaf) == nil {
+			pair.Leaf = leaf
+			ca.server = &pair
+			return false, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return false, fmt.Errorf("ca: could not generate key: %w", err)
+	}
+
+	der, err := ca.issue(ServerName, key.Public())
+	if err != nil {
+		return false, err
+	}
+
+	err = writePair(certPath, keyPath, der, key)
+	if err != nil {
+		return false, err
+	}
+
+	pair, err = tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return false, fmt.Errorf("ca: could not load server certificate: %w", err)
+	}
+
+	pair.Leaf, err = x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("ca: could not parse server certificate: %w", err)
+	}
+	ca.server = &pair
+
+	return true, nil
+}
+
+// CertPEM returns the certificate of the CA, for agents to verify the server
+// with.
+func (ca *CA) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// Pool returns a pool holding only the certificate of the CA.
+func (ca *CA) Pool() *x509.CertPool {
+	return ca.pool
+}
+
+// ServerCertificate returns the certificate the server authenticates with to
+// agents.
+func (ca *CA) ServerCertificate() *tls.Certificate {
+	ca.mutex.RLock()
+	defer ca.mutex.RUnlock()
+
+	return ca.server
+}
+
+// Verify that the certificate was issued by the CA.
+func (ca *CA) Verify(cert *x509.Certificate) error {
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:     ca.pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+// SignAgent signs the PEM encoded certificate request of the agent. The name in
+// the request is ignored, the certificate is always issued to the agent's ID.
+func (ca *CA) SignAgent(id int, csrPEM []byte) ([]byte, string, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, "", errors.New("ca: invalid certificate request")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("ca: invalid certificate request: %w", err)
+	}
+
+	err = csr.CheckSignature()
+	if err != nil {
+		return nil, "", fmt.Errorf("ca: invalid certificate request signature: %w", err)
+	}
+
+	der, err := ca.issue(AgentName(id), csr.PublicKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, "", fmt.Errorf("ca: could not parse certificate: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), Serial(cert), nil
+}
+
+// issue a certificate for both ends of a connection, as agents and the server
+// each both serve and make requests.
+func (ca *CA) issue(name string, pub crypto.PublicKey) ([]byte, error) {
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, pub, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("ca: could not create certificate: %w", err)
+	}
+
+	return der, nil
+}
+
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("ca: could not generate serial number: %w", err)
+	}
+
+	return serial, nil
+}
+
+// writePair writes the certificate and its key as PEM files, the key readable
+// only by the owner.
+func writePair(certPath, keyPath string, der []byte, key crypto.Signer) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("ca: could not marshal key: %w", err)
+	}
+
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	if err != nil {
+		return fmt.Errorf("ca: could not write key: %w", err)
+	}
+
+	err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	if err != nil {
+		return fmt.Errorf("ca: could not write certificate: %w", err)
+	}
+
+	return nil
+}
+
+// Request generates a key and a certificate request for it, both PEM encoded,
+// for an agent to send when it registers.
+func Request() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ca: could not generate key: %w", err)
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ca: could not create certificate request: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ca: could not marshal key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
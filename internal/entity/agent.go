@@ -1,10 +1,92 @@
 package entity
 
+import "time"
+
 // Agent to send jobs to.
 type Agent struct {
-	ID   int    `json:"id"`
+	ID int `json:"id"`
+
+	// MachineID is generated by the agent and kept across restarts, so the agent
+	// is recognized when it registers again after its address changed.
+	MachineID string `json:"machine_id"`
+
 	Name string `json:"name"`
+
+	// IP is the address the agent is reached at, which may be a host name.
 	IP   string `json:"ip"`
 	Port int    `json:"port"`
 	PSK  string `json:"psk"`
+
+	// Tunnel is set for agents that keep a connection open to the server, instead
+	// of being reached at their IP and port.
+	Tunnel bool `json:"tunnel"`
+
+	// TLS is set for agents that serve their API over HTTPS.
+	TLS bool `json:"tls"`
+
+	// CertSerial is the serial number of the certificate the agent was issued
+	// by the server's CA. Only that certificate is accepted from the agent, so
+	// deleting the agent or issuing it a new certificate revokes the old one.
+	CertSerial string `json:"cert_serial"`
+
+	// NextPSK is the PSK being rotated to, which the agent already accepts but
+	// doesn't use yet. PSKRotatedAt is when the PSK was last rotated.
+	NextPSK      string    `json:"-"`
+	PSKRotatedAt time.Time `json:"psk_rotated_at"`
+
+	// Pending agents registered while approval was required and get no jobs
+	// until an admin approves them.
+	Pending bool `json:"pending"`
+
+	// TokenID is the registration token the agent registered with, 0 if none.
+	// The agent may register again with that token, and gets its labels.
+	TokenID int `json:"token_id"`
+
+	// Labels such as env=prod, which backup selectors match against.
+	Labels map[string]string `json:"labels"`
+
+	// SchedulesPaused stops scheduled backups on the agent until resumed, or
+	// until PausedUntil if that is set.
+	SchedulesPaused bool      `json:"schedules_paused"`
+	PausedUntil     time.Time `json:"paused_until"`
+
+	// LastSeen is the time of the agent's last heartbeat. Status is derived from
+	// it when the agent is read and is one of "online", "offline" or "unknown" for
+	// agents that have never sent a heartbeat.
+	LastSeen time.Time `json:"last_seen"`
+	Status   string    `json:"status"`
+
+	// Reported by the agent on registration and with every heartbeat.
+	AgentInfo
+
+	// Reported by the agent with every heartbeat, uptime in seconds and free disk
+	// in bytes.
+	Uptime      int64    `json:"uptime"`
+	RunningJobs []string `json:"running_jobs"`
+	FreeDisk    uint64   `json:"free_disk"`
+}
+
+// AgentInfo describes the platform of an agent and the versions it runs.
+type AgentInfo struct {
+	ResticVersion string `json:"restic_version"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	AgentVersion  string `json:"agent_version"`
+}
+
+// Agent statuses.
+const (
+	AgentOnline  = "online"
+	AgentOffline = "offline"
+	AgentUnknown = "unknown"
+)
+
+// Heartbeat sent periodically by agents to the server, see the fields of the
+// same names on Agent.
+type Heartbeat struct {
+	AgentInfo
+
+	Uptime      int64    `json:"uptime"`
+	RunningJobs []string `json:"running_jobs"`
+	FreeDisk    uint64   `json:"free_disk"`
 }
@@ -4,12 +4,45 @@ import "time"
 
 // Backup for a certain source to the target repository.
 type Backup struct {
-	ID       int       `json:"id"`
-	Target   int       `json:"target"`
-	Source   string    `json:"source"`
-	Schedule string    `json:"schedule"`
-	Exclude  []string  `json:"exclude"`
-	LastRun  time.Time `json:"last_run"`
+	ID        int         `json:"id"`
+	Target    int         `json:"target"`
+	Source    string      `json:"source"`
+	Schedules []*Schedule `json:"schedules"`
+	Exclude   []string    `json:"exclude"`
+	LastRun   time.Time   `json:"last_run"`
+
+	// Selector subscribes every agent whose labels match it, in addition to the
+	// agents subscribed explicitly.
+	Selector string `json:"selector"`
+
+	// TemplateID is the template the backup was created from, 0 if none. Its
+	// source and excludes are then rendered per agent.
+	TemplateID int `json:"template_id"`
+
+	// Enabled is false while the backup's schedules are paused indefinitely.
+	// PausedUntil pauses them until the given time instead.
+	Enabled     bool      `json:"enabled"`
+	PausedUntil time.Time `json:"paused_until"`
+}
+
+// Schedule for running a backup, with tags and restic options that only apply to
+// runs started by it. Jitter is a duration such as "15m" within which each agent's
+// run is randomly delayed.
+//
+// CatchUp decides what happens at startup to a run missed while the server was
+// down: "skip" (the default) drops it, "once" runs it once, and "overdue" runs it
+// once only if it is late by more than CatchUpAfter.
+type Schedule struct {
+	Name         string    `json:"name"`
+	Cron         string    `json:"cron"`
+	TimeZone     string    `json:"time_zone"`
+	Jitter       string    `json:"jitter"`
+	CatchUp      string    `json:"catch_up"`
+	CatchUpAfter string    `json:"catch_up_after"`
+	Tags         []string  `json:"tags"`
+	Options      []string  `json:"options"`
+	LastRun      time.Time `json:"last_run"`
+	NextRun      time.Time `json:"next_run"`
 }
 
 type BackupSubscribers struct {
@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// Blackout window during which scheduled backups must not run.
+//
+// A window linked to neither an agent nor a repository is global. Recurring
+// windows open at every match of Cron and stay open for Duration, one-off windows
+// run from Start to End. Action is either "defer", which holds jobs until the
+// window closes, or "skip", which drops the run.
+type Blackout struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	AgentID int    `json:"agent_id"`
+	RepoID  int    `json:"repo_id"`
+
+	Cron     string `json:"cron"`
+	TimeZone string `json:"time_zone"`
+	Duration string `json:"duration"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	Action string `json:"action"`
+}
@@ -1,12 +1,25 @@
 package entity
 
+// Forget policy for pruning snapshots after a backup.
+//
+// The policy with ID 0 is the default and applies to every backup. A policy
+// linked to a repository overrides the default for backups into that repository,
+// and a policy linked to a backup overrides both.
 type Forget struct {
-	ID      int  `json:"id"`
-	Enabled bool `json:"enabled"`
-	LastX   int  `json:"lastX"`
-	Hourly  int  `json:"hourly"`
-	Daily   int  `json:"daily"`
-	Weekly  int  `json:"weekly"`
-	Monthly int  `json:"monthly"`
-	Yearly  int  `json:"yearly"`
+	ID       int  `json:"id"`
+	BackupID int  `json:"backup_id"`
+	RepoID   int  `json:"repo_id"`
+	Enabled  bool `json:"enabled"`
+	LastX    int  `json:"lastX"`
+	Hourly   int  `json:"hourly"`
+	Daily    int  `json:"daily"`
+	Weekly   int  `json:"weekly"`
+	Monthly  int  `json:"monthly"`
+	Yearly   int  `json:"yearly"`
+
+	Within   string   `json:"within"`
+	KeepTags []string `json:"keep_tags"`
+	GroupBy  string   `json:"group_by"`
+	Hosts    []string `json:"hosts"`
+	Paths    []string `json:"paths"`
 }
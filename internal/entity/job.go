@@ -6,13 +6,27 @@ import (
 )
 
 type Job struct {
-	ID      string `json:"id"`
-	Done    bool   `json:"done"`
-	Aborted bool   `json:"aborted"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	BackupID int    `json:"backup_id"`
+	Done     bool   `json:"done"`
+	Aborted  bool   `json:"aborted"`
 	// Packet   *JobPacket      `json:"-"`
 	Request  *JobRequest     `json:"-"`
 	Progress json.RawMessage `json:"progress"`
 
+	// AgentID is the agent the job runs on.
+	AgentID int `json:"agent_id"`
+
+	// NotBefore is when a deferred job may be sent, zero once it has been. Its
+	// request is kept in Deferred until then, so the run survives a restart.
+	NotBefore time.Time       `json:"not_before"`
+	Deferred  json.RawMessage `json:"-"`
+
+	// Delivered holds the IDs of the messages from the agent already handled, so
+	// retried ones are only handled once.
+	Delivered []string `json:"-"`
+
 	StartTime time.Time `json:"start_time"`
 	EndTime   time.Time `json:"end_time"`
 }
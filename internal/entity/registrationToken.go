@@ -0,0 +1,26 @@
+package entity
+
+import "time"
+
+// RegistrationToken lets agents register with the server.
+//
+// A one-time token is spent by the first agent registering with it, which may
+// keep using it to register again. No agent can register with a token after
+// ExpiresAt, unless that is zero, agents that registered with it before included.
+// Agents registered with a token get its labels on top of their own, so a token
+// can be handed out for one group of agents.
+type RegistrationToken struct {
+	ID     int               `json:"id"`
+	Name   string            `json:"name"`
+	Token  string            `json:"token"`
+	Labels map[string]string `json:"labels"`
+
+	OneTime   bool      `json:"one_time"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// UsedBy is the ID of the first agent that registered with the token, at
+	// UsedAt.
+	UsedBy int       `json:"used_by"`
+	UsedAt time.Time `json:"used_at"`
+}
@@ -0,0 +1,14 @@
+package entity
+
+// Template for creating backups that share a definition. Source and Exclude are
+// Go templates rendered for each agent when a job is created, such as
+// "/srv/{{hostname}}" or "/data/{{label \"app\"}}".
+type Template struct {
+	ID        int         `json:"id"`
+	Name      string      `json:"name"`
+	Target    int         `json:"target"`
+	Source    string      `json:"source"`
+	Exclude   []string    `json:"exclude"`
+	Schedules []*Schedule `json:"schedules"`
+	Selector  string      `json:"selector"`
+}
@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+// User who logs in to the web UI and API. Password is the bcrypt hash of the
+// user's password, which is never sent back.
+type User struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Password  string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Role is what the user may do, and Scope what to. Users without a scope
+	// have access to everything.
+	Role  string     `json:"role"`
+	Scope *UserScope `json:"scope"`
+}
+
+// UserScope limits a user to the listed repos and backups, and the agents
+// matching a label selector. Backups into one of the repos are included.
+type UserScope struct {
+	Repos   []int  `json:"repos"`
+	Backups []int  `json:"backups"`
+	Agents  string `json:"agents"`
+}
+
+// User roles, each allowed what the ones before it are. Viewers browse
+// everything in their scope, operators also run and stop backups, restore and
+// delete snapshots, and admins change the configuration and manage users.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
@@ -0,0 +1,89 @@
+// Package queue provides bounded queues, each drained by a single sender, for
+// messages that are only worth sending while they are recent.
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Queue of messages for one destination. When it is full, the oldest message is
+// dropped to make room, so a slow destination never blocks the producers.
+type Queue struct {
+	// The counters come first to be 64-bit aligned for atomic access on 32-bit
+	// platforms.
+	sent    uint64
+	failed  uint64
+	dropped uint64
+
+	name  string
+	items chan interface{}
+}
+
+// Stats of a queue, for monitoring.
+type Stats struct {
+	Name    string `json:"name"`
+	Len     int    `json:"len"`
+	Cap     int    `json:"cap"`
+	Sent    uint64 `json:"sent"`
+	Failed  uint64 `json:"failed"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// New queue holding at most size messages.
+func New(name string, size int) *Queue {
+	return &Queue{
+		name:  name,
+		items: make(chan interface{}, size),
+	}
+}
+
+// Push adds the message to the queue, dropping the oldest one if it is full. It
+// reports whether a message was dropped.
+func (q *Queue) Push(item interface{}) bool {
+	dropped := false
+	for {
+		select {
+		case q.items <- item:
+			return dropped
+		default:
+		}
+
+		select {
+		case <-q.items:
+			atomic.AddUint64(&q.dropped, 1)
+			dropped = true
+		default:
+		}
+	}
+}
+
+// Run sends the messages with send as they are pushed, blocking until the
+// context is done. Messages that send fails on are counted and not retried.
+func (q *Queue) Run(ctx context.Context, send func(item interface{}) error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-q.items:
+			err := send(item)
+			if err != nil {
+				atomic.AddUint64(&q.failed, 1)
+				continue
+			}
+			atomic.AddUint64(&q.sent, 1)
+		}
+	}
+}
+
+// Stats returns the current stats of the queue.
+func (q *Queue) Stats() Stats {
+	return Stats{
+		Name:    q.name,
+		Len:     len(q.items),
+		Cap:     cap(q.items),
+		Sent:    atomic.LoadUint64(&q.sent),
+		Failed:  atomic.LoadUint64(&q.failed),
+		Dropped: atomic.LoadUint64(&q.dropped),
+	}
+}
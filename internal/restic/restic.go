@@ -5,12 +5,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -34,6 +36,20 @@ type JobUpdate struct {
 	Msg json.RawMessage
 }
 
+// IsTerminal reports whether the JSON message from restic ends the job, that is
+// the summary or the error restic exits with. Error messages about single files
+// don't end it, restic carries on with the rest.
+func IsTerminal(msg json.RawMessage) bool {
+	var msgType struct {
+		MessageType string `json:"message_type"`
+	}
+	if err := json.Unmarshal(msg, &msgType); err != nil {
+		return false
+	}
+
+	return msgType.MessageType == "summary" || msgType.MessageType == "exit_error"
+}
+
 // New restic instance.
 func New(ctx context.Context, exePath string) *Restic {
 	return &Restic{
@@ -44,11 +60,133 @@ func New(ctx context.Context, exePath string) *Restic {
 	}
 }
 
+// Version of the restic executable, such as "0.12.1".
+func (r *Restic) Version() (string, error) {
+	out, err := exec.Command(r.exe, "version").Output()
+	if err != nil {
+		return "", err
+	}
+
+	// Output looks like: restic 0.12.1 compiled with go1.16.6 on linux/amd64
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 || fields[0] != "restic" {
+		return "", fmt.Errorf("restic.Version: unexpected output %q", string(out))
+	}
+
+	return fields[1], nil
+}
+
+// ParseVersion parses a restic version such as "0.12.1" into its major, minor
+// and patch numbers. Suffixes like "-dev" are ignored.
+func ParseVersion(version string) ([3]int, error) {
+	var parsed [3]int
+
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+ "); i != -1 {
+		version = version[:i]
+	}
+
+	parts := strings.Split(version, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return parsed, fmt.Errorf("invalid restic version %q", version)
+	}
+
+	for i, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil || num < 0 {
+			return parsed, fmt.Errorf("invalid restic version %q", version)
+		}
+		parsed[i] = num
+	}
+
+	return parsed, nil
+}
+
+// VersionAtLeast reports whether version is min or newer.
+func VersionAtLeast(version, min string) (bool, error) {
+	v, err := ParseVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	m, err := ParseVersion(min)
+	if err != nil {
+		return false, err
+	}
+
+	for i := range v {
+		if v[i] != m[i] {
+			return v[i] > m[i], nil
+		}
+	}
+
+	return true, nil
+}
+
+// backupOptions are the options of restic backup that schedules may set, and
+// whether they take a value. Anything else is refused, as options like
+// --password-command or --option run commands on the agent.
+var backupOptions = map[string]bool{
+	"--exclude":             true,
+	"--iexclude":            true,
+	"--exclude-caches":      false,
+	"--exclude-if-present":  true,
+	"--exclude-larger-than": true,
+	"--one-file-system":     false,
+	"--tag":                 true,
+	"--host":                true,
+	"--time":                true,
+	"--force":               false,
+	"--ignore-ctime":        false,
+	"--ignore-inode":        false,
+	"--with-atime":          false,
+	"--no-scan":             false,
+	"--skip-if-unchanged":   false,
+	"--compression":         true,
+	"--pack-size":           true,
+	"--read-concurrency":    true,
+	"--limit-upload":        true,
+	"--limit-download":      true,
+}
+
+// ValidateBackupOption checks that the option is one schedules may set. Options
+// taking a value are given as --name=value, so they can't take the next
+// argument as theirs.
+func ValidateBackupOption(opt string) error {
+	parts := strings.SplitN(opt, "=", 2)
+	name, hasValue := parts[0], len(parts) == 2
+	value := ""
+	if hasValue {
+		value = parts[1]
+	}
+
+	takesValue, ok := backupOptions[name]
+	if !ok {
+		return fmt.Errorf("option %q is not allowed", name)
+	}
+
+	if takesValue && (!hasValue || value == "") {
+		return fmt.Errorf("option %q needs a value, as %s=value", name, name)
+	}
+
+	if !takesValue && hasValue {
+		return fmt.Errorf("option %q takes no value", name)
+	}
+
+	return nil
+}
+
 // Restic JSON struct
 // https://github.com/restic/restic/blob/master/internal/ui/backup/json.go#L198
 
 // Backup source to target repo.
-func (r *Restic) Backup(repo, source, password string, exclude []string, jobID string, env ...string) ([]byte, error) {
+func (r *Restic) Backup(repo, source, password string, exclude, tags, options []string, jobID string, env ...string) ([]byte, error) {
+	for _, opt := range options {
+		if err := ValidateBackupOption(opt); err != nil {
+			return nil, err
+		}
+	}
+
 	args := []string{
 		"backup",
 		"--json",
@@ -64,6 +202,12 @@ func (r *Restic) Backup(repo, source, password string, exclude []string, jobID s
 		}
 	}
 
+	for _, tag := range tags {
+		args = append(args, "--tag", tag)
+	}
+
+	args = append(args, options...)
+
 	// defer cancel()
 
 	cmd := exec.Command(r.exe, args...)
@@ -93,57 +237,54 @@ func (r *Restic) Backup(repo, source, password string, exclude []string, jobID s
 
 	r.Jobs <- job
 
-	wg := new(sync.WaitGroup)
-
-	go func() {
-		if r.Updates == nil {
-			return
-		}
-
-		for {
-			wg.Add(1)
-			defer wg.Done()
-			select {
-			case <-job.ctx.Done():
-				err := cmd.Process.Signal(os.Interrupt)
-				if err != nil {
-					err = cmd.Process.Signal(os.Kill)
-					if err != nil {
-						panic(fmt.Errorf("restic.Backup: failed to kill process: %w", err))
-					}
-				}
-
-				return
-			default:
-			}
+	if err := cmd.Start(); err != nil {
+		out, readErr := io.ReadAll(errReader)
+		if readErr != nil {
+			return nil, fmt.Errorf("restic.Backup cmd.Start(): could not read stderr: %w", readErr)
+		}
+		return out, err
+	}
 
-			data, err := reader.ReadBytes('\n')
-			if err != nil {
-				if err != io.EOF {
-					log.Println("restic.Backup: failed to read update from reader:", err)
-				}
-				break
-			}
+	// Cancelling the job interrupts restic, which then ends its output.
+	stop := interruptOnCancel(job.ctx, cmd)
 
+	// All of the output is read before waiting for restic, as Wait closes the
+	// pipe and the last lines, the summary among them, would be lost.
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(data) != 0 && r.Updates != nil {
 			update := JobUpdate{
 				ID:  jobID,
 				Msg: json.RawMessage(data),
 			}
 
-			select {
-			case r.Updates <- update:
-			default:
+			// Status updates may be dropped when the agent falls behind, but the
+			// messages that end the job must get through.
+			if IsTerminal(update.Msg) {
+				select {
+				case r.Updates <- update:
+				case <-r.ctx.Done():
+				}
+			} else {
+				select {
+				case r.Updates <- update:
+				default:
+				}
 			}
 		}
-	}()
-	if err := cmd.Start(); err != nil {
-		out, readErr := io.ReadAll(errReader)
-		if readErr != nil {
-			return nil, fmt.Errorf("restic.Backup cmd.Start(): could not read stderr: %w", readErr)
+
+		if err != nil {
+			if err != io.EOF {
+				log.Println("restic.Backup: failed to read update from reader:", err)
+			}
+			break
 		}
-		return out, err
 	}
-	if err := cmd.Wait(); err != nil {
+
+	err = cmd.Wait()
+	stop()
+
+	if err != nil {
 		out, readErr := io.ReadAll(errReader)
 		if readErr != nil {
 			return nil, fmt.Errorf("restic.Backup cmd.Wait(): could not read stderr: %w", readErr)
@@ -151,11 +292,38 @@ func (r *Restic) Backup(repo, source, password string, exclude []string, jobID s
 		return out, err
 	}
 
-	wg.Wait()
-
 	return []byte("Done"), nil
 }
 
+// interruptOnCancel interrupts the started command when the context is done,
+// or kills it if that fails. The returned function stops watching the context,
+// and is called once the command has been waited for.
+func interruptOnCancel(ctx context.Context, cmd *exec.Cmd) func() {
+	stopped := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		select {
+		case <-ctx.Done():
+			err := cmd.Process.Signal(os.Interrupt)
+			if err != nil {
+				err = cmd.Process.Kill()
+			}
+			if err != nil && !errors.Is(err, os.ErrProcessDone) {
+				log.Println("restic: failed to kill process:", err)
+			}
+		case <-stopped:
+		}
+	}()
+
+	return func() {
+		close(stopped)
+		wg.Wait()
+	}
+}
+
 // Restore snapshot to target.
 func (r *Restic) Restore(repo, password, snapshot, target string, include, exclude []string, env ...string) ([]byte, error) {
 	args := []string{
@@ -241,10 +409,69 @@ type ForgetOptions struct {
 	Weekly  int
 	Monthly int
 	Yearly  int
+
+	// Within keeps all snapshots made within the duration of the latest one, in
+	// restic's duration format, e.g. "1y2m3d4h".
+	Within   string
+	KeepTags []string
+	GroupBy  string
+
+	// Hosts and Paths limit which snapshots the policy is applied to.
+	Hosts []string
+	Paths []string
+
+	DryRun bool
+	// JSON makes restic print its result as JSON, in which case only stdout is
+	// returned on success.
+	JSON bool
 }
 
 // Forget a snapshot.
 func (r *Restic) Forget(repo, password string, snapshots []string, options *ForgetOptions, env ...string) ([]byte, error) {
+	cmd := r.forgetCommand(repo, password, snapshots, options, env...)
+
+	if options != nil && options.JSON {
+		errReader := new(bytes.Buffer)
+		cmd.Stderr = errReader
+
+		out, err := cmd.Output()
+		if err != nil {
+			return errReader.Bytes(), err
+		}
+		return out, nil
+	}
+
+	return cmd.CombinedOutput()
+}
+
+// ForgetJob runs a forget policy as a job, which is stopped like backups by
+// cancelling it. The output is restic's stdout and stderr together.
+func (r *Restic) ForgetJob(jobID, repo, password string, options *ForgetOptions, env ...string) ([]byte, error) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+	r.Jobs <- &Job{
+		ID:     jobID,
+		ctx:    ctx,
+		Cancel: cancel,
+	}
+
+	cmd := r.forgetCommand(repo, password, nil, options, env...)
+	out := new(bytes.Buffer)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	stop := interruptOnCancel(ctx, cmd)
+	err := cmd.Wait()
+	stop()
+
+	return out.Bytes(), err
+}
+
+func (r *Restic) forgetCommand(repo, password string, snapshots []string, options *ForgetOptions, env ...string) *exec.Cmd {
 	args := []string{
 		"forget",
 	}
@@ -288,6 +515,39 @@ func (r *Restic) Forget(repo, password string, snapshots []string, options *Forg
 			args = append(args, "--keep-yearly")
 			args = append(args, strconv.Itoa(options.Yearly))
 		}
+
+		if options.Within != "" {
+			args = append(args, "--keep-within")
+			args = append(args, options.Within)
+		}
+
+		for _, tag := range options.KeepTags {
+			args = append(args, "--keep-tag")
+			args = append(args, tag)
+		}
+
+		if options.GroupBy != "" {
+			args = append(args, "--group-by")
+			args = append(args, options.GroupBy)
+		}
+
+		for _, host := range options.Hosts {
+			args = append(args, "--host")
+			args = append(args, host)
+		}
+
+		for _, path := range options.Paths {
+			args = append(args, "--path")
+			args = append(args, path)
+		}
+
+		if options.DryRun {
+			args = append(args, "--dry-run")
+		}
+
+		if options.JSON {
+			args = append(args, "--json")
+		}
 	}
 
 	cmd := exec.Command(r.exe, args...)
@@ -296,7 +556,117 @@ func (r *Restic) Forget(repo, password string, snapshots []string, options *Forg
 	cmd.Env = append(cmd.Env, "RESTIC_PASSWORD="+password)
 	cmd.Env = append(cmd.Env, env...)
 
-	return cmd.CombinedOutput()
+	return cmd
+}
+
+// ForgetGroup of snapshots as printed by `restic forget --json`.
+type ForgetGroup struct {
+	Tags    []string      `json:"tags"`
+	Host    string        `json:"host"`
+	Paths   []string      `json:"paths"`
+	Keep    []*Snapshot   `json:"keep"`
+	Remove  []*Snapshot   `json:"remove"`
+	Reasons []*KeepReason `json:"reasons"`
+}
+
+// KeepReason lists the rules of the policy a kept snapshot matched.
+type KeepReason struct {
+	Snapshot *Snapshot `json:"snapshot"`
+	Matches  []string  `json:"matches"`
+}
+
+// ForgetDecision for a single snapshot.
+type ForgetDecision struct {
+	*Snapshot
+	Reasons []string `json:"reasons"`
+}
+
+// ForgetPreview of what a forget policy would keep and remove in a group of
+// snapshots sharing host and paths (or whatever the policy groups by).
+type ForgetPreview struct {
+	Tags   []string          `json:"tags"`
+	Host   string            `json:"host"`
+	Paths  []string          `json:"paths"`
+	Keep   []*ForgetDecision `json:"keep"`
+	Remove []*ForgetDecision `json:"remove"`
+}
+
+// ParseForgetPreview parses the output of `restic forget --dry-run --json`.
+func ParseForgetPreview(out []byte) ([]*ForgetPreview, error) {
+	previews := make([]*ForgetPreview, 0)
+
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return previews, nil
+	}
+
+	var groups []*ForgetGroup
+	err := json.Unmarshal(out, &groups)
+	if err != nil {
+		return nil, fmt.Errorf("restic.ParseForgetPreview: could not unmarshal output: %w", err)
+	}
+
+	for _, group := range groups {
+		reasons := make(map[string][]string)
+		for _, reason := range group.Reasons {
+			if reason.Snapshot == nil {
+				continue
+			}
+			reasons[reason.Snapshot.ID] = reason.Matches
+		}
+
+		preview := &ForgetPreview{
+			Tags:   group.Tags,
+			Host:   group.Host,
+			Paths:  group.Paths,
+			Keep:   make([]*ForgetDecision, 0, len(group.Keep)),
+			Remove: make([]*ForgetDecision, 0, len(group.Remove)),
+		}
+
+		for _, snapshot := range group.Keep {
+			matches, ok := reasons[snapshot.ID]
+			if !ok {
+				matches = make([]string, 0)
+			}
+
+			preview.Keep = append(preview.Keep, &ForgetDecision{
+				Snapshot: snapshot,
+				Reasons:  matches,
+			})
+		}
+
+		for _, snapshot := range group.Remove {
+			preview.Remove = append(preview.Remove, &ForgetDecision{
+				Snapshot: snapshot,
+				Reasons:  []string{"no keep rule matched"},
+			})
+		}
+
+		previews = append(previews, preview)
+	}
+
+	return previews, nil
+}
+
+// ForgetPreview shows what forget would do with the options, without removing anything.
+func (r *Restic) ForgetPreview(repo, password string, options *ForgetOptions, env ...string) ([]*ForgetPreview, error) {
+	previewOptions := ForgetOptions{}
+	if options != nil {
+		previewOptions = *options
+	}
+	previewOptions.DryRun = true
+	previewOptions.JSON = true
+
+	out, err := r.Forget(repo, password, nil, &previewOptions, env...)
+	if err != nil {
+		if len(out) == 0 {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%s: %s", err, string(out))
+	}
+
+	return ParseForgetPreview(out)
 }
 
 type FileNode struct {
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
+)
+
+// roleLevels orders the roles, each allowed what the ones below it are.
+var roleLevels = map[string]int{
+	entity.RoleViewer:   1,
+	entity.RoleOperator: 2,
+	entity.RoleAdmin:    3,
+}
+
+// validRole reports whether role is one of the user roles.
+func validRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// hasRole reports whether the user has the role or one above it.
+func hasRole(user *entity.User, role string) bool {
+	return user != nil && roleLevels[user.Role] >= roleLevels[role]
+}
+
+// allow responds with forbidden unless the request's user has the role.
+func (api *API) allow(w http.ResponseWriter, r *http.Request, role string) bool {
+	if hasRole(requestUser(r), role) {
+		return true
+	}
+
+	api.error(w, r, "Not allowed.", fmt.Errorf("requires role %s", role), http.StatusForbidden)
+	return false
+}
+
+// forbid responds with forbidden for a resource outside the user's scope.
+func (api *API) forbid(w http.ResponseWriter, r *http.Request) {
+	api.error(w, r, "Not allowed.", fmt.Errorf("resource is out of scope"), http.StatusForbidden)
+}
+
+// unscoped reports whether the request's user has access to every resource.
+func unscoped(r *http.Request) bool {
+	return unscopedUser(requestUser(r))
+}
+
+// unscopedUser reports whether the user has access to every resource. Admins
+// always do, even those stored with a scope before it was refused for them.
+func unscopedUser(user *entity.User) bool {
+	return user != nil && (user.Scope == nil || user.Role == entity.RoleAdmin)
+}
+
+func containsID(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// canRepo reports whether the repo is in the request's user's scope.
+func canRepo(r *http.Request, repoID int) bool {
+	return userCanRepo(requestUser(r), repoID)
+}
+
+// userCanRepo reports whether the repo is in the user's scope.
+func userCanRepo(user *entity.User, repoID int) bool {
+	if unscopedUser(user) {
+		return true
+	}
+
+	return user != nil && containsID(user.Scope.Repos, repoID)
+}
+
+// canBackup reports whether the backup is in the request's user's scope, by
+// itself or through its repo.
+func canBackup(r *http.Request, backup *entity.Backup) bool {
+	return userCanBackup(requestUser(r), backup)
+}
+
+// userCanBackup is canBackup for the user.
+func userCanBackup(user *entity.User, backup *entity.Backup) bool {
+	if unscopedUser(user) {
+		return true
+	}
+
+	return user != nil && (containsID(user.Scope.Backups, backup.ID) || userCanRepo(user, backup.Target))
+}
+
+// canAgent reports whether the agent matches the request's user's agent
+// selector.
+func canAgent(r *http.Request, agent *entity.Agent) bool {
+	return userCanAgent(requestUser(r), agent)
+}
+
+// userCanAgent is canAgent for the user.
+func userCanAgent(user *entity.User, agent *entity.Agent) bool {
+	if unscopedUser(user) {
+		return true
+	}
+
+	if user == nil {
+		return false
+	}
+
+	selector, err := manager.ParseSelector(user.Scope.Agents)
+	if err != nil {
+		return false
+	}
+
+	return selector.Matches(agent.Labels)
+}
+
+// canBackupID is canBackup by ID. Backups that don't exist, such as those of
+// jobs not started by a backup, are only for unscoped users.
+func (api *API) canBackupID(r *http.Request, backupID int) (bool, error) {
+	if unscoped(r) {
+		return true, nil
+	}
+
+	backup, err := api.services.BackupSvc.Get([]byte(strconv.Itoa(backupID)))
+	if err != nil {
+		return false, err
+	}
+
+	return backup != nil && canBackup(r, backup), nil
+}
+
+// redactAgent returns the agent without its PSK and machine ID for users who
+// aren't admins. It is a copy, as the agent may be cached.
+func redactAgent(r *http.Request, agent *entity.Agent) *entity.Agent {
+	if hasRole(requestUser(r), entity.RoleAdmin) {
+		return agent
+	}
+
+	redacted := *agent
+	redacted.PSK = ""
+	redacted.MachineID = ""
+	return &redacted
+}
+
+// redactRepo returns the repo without its password and settings, which hold
+// the credentials of its storage, for users who aren't admins.
+func redactRepo(r *http.Request, repo *entity.Repo) *entity.Repo {
+	if hasRole(requestUser(r), entity.RoleAdmin) {
+		return repo
+	}
+
+	redacted := *repo
+	redacted.Password = ""
+	redacted.Settings = make([]string, 0)
+	return &redacted
+}
+
+// canJob reports whether the job is in the request's user's scope, through its
+// backup or the agent it runs on.
+func (api *API) canJob(r *http.Request, job *entity.Job) (bool, error) {
+	if unscoped(r) {
+		return true, nil
+	}
+
+	agent, err := api.jobAgent(job)
+	if err != nil {
+		return false, err
+	}
+
+	if agent != nil && canAgent(r, agent) {
+		return true, nil
+	}
+
+	return api.canBackupID(r, job.BackupID)
+}
+
+// jobAgent returns the agent the job runs on, nil if it is gone. The job's
+// request only holds it for jobs that haven't been loaded from storage.
+func (api *API) jobAgent(job *entity.Job) (*entity.Agent, error) {
+	agent, err := api.services.AgentSvc.Get([]byte(strconv.Itoa(job.AgentID)))
+	if err != nil {
+		return nil, err
+	}
+
+	if agent == nil && job.Request != nil {
+		agent = job.Request.Agent
+	}
+
+	return agent, nil
+}
+
+// jobWatchers returns which users may see messages about the job on the
+// websocket, those whose scope it is in through its agent or backup. The agent
+// and backup are looked up once, not for every user.
+func (api *API) jobWatchers(job *entity.Job) (func(user *entity.User) bool, error) {
+	agent, err := api.jobAgent(job)
+	if err != nil {
+		return nil, err
+	}
+
+	backup, err := api.services.BackupSvc.Get([]byte(strconv.Itoa(job.BackupID)))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(user *entity.User) bool {
+		if unscopedUser(user) {
+			return true
+		}
+
+		return (agent != nil && userCanAgent(user, agent)) || (backup != nil && userCanBackup(user, backup))
+	}, nil
+}
+
+// canForget reports whether the forget policy is in the request's user's scope.
+// The default policy applies to every backup, so is in everyone's.
+func (api *API) canForget(r *http.Request, forget *entity.Forget) (bool, error) {
+	switch {
+	case forget.BackupID != 0:
+		return api.canBackupID(r, forget.BackupID)
+	case forget.RepoID != 0:
+		return canRepo(r, forget.RepoID), nil
+	default:
+		return true, nil
+	}
+}
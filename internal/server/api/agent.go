@@ -5,10 +5,12 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
 )
 
-func (api *API) GetAgents() http.HandlerFunc {
+func (api *API) GetAgents(man *manager.Manager) http.HandlerFunc {
 	type response struct {
 		Agents []*entity.Agent `json:"agents"`
 	}
@@ -19,11 +21,24 @@ func (api *API) GetAgents() http.HandlerFunc {
 			return
 		}
 
-		if agents == nil {
-			agents = make([]*entity.Agent, 0)
+		visible := make([]*entity.Agent, 0, len(agents))
+		for _, agent := range agents {
+			if canAgent(r, agent) {
+				visible = append(visible, agent)
+			}
 		}
 
-		api.respond(w, r, &response{Agents: agents}, http.StatusOK)
+		err = man.SetAgentStatus(visible...)
+		if err != nil {
+			api.error(w, r, "Could not get agent status.", err, http.StatusInternalServerError)
+			return
+		}
+
+		for i, agent := range visible {
+			visible[i] = redactAgent(r, agent)
+		}
+
+		api.respond(w, r, &response{Agents: visible}, http.StatusOK)
 	}
 }
 
@@ -33,11 +48,19 @@ func (api *API) CreateAgent() http.HandlerFunc {
 		PSK  string `json:"psk"`
 		IP   string `json:"ip"`
 		Port int    `json:"port"`
+
+		Tunnel bool              `json:"tunnel"`
+		TLS    bool              `json:"tls"`
+		Labels map[string]string `json:"labels"`
 	}
 	type response struct {
 		Agent *entity.Agent `json:"agent"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		var req request
 		err := api.decode(w, r, &req)
 		if err != nil {
@@ -45,11 +68,20 @@ func (api *API) CreateAgent() http.HandlerFunc {
 			return
 		}
 
+		err = manager.ValidateLabels(req.Labels)
+		if err != nil {
+			api.error(w, r, "Invalid labels.", err, http.StatusBadRequest)
+			return
+		}
+
 		agent := &entity.Agent{
-			Name: req.Name,
-			PSK:  req.PSK,
-			IP:   req.IP,
-			Port: req.Port,
+			Name:   req.Name,
+			PSK:    req.PSK,
+			IP:     req.IP,
+			Port:   req.Port,
+			Tunnel: req.Tunnel,
+			TLS:    req.TLS,
+			Labels: req.Labels,
 		}
 
 		agent, err = api.services.AgentSvc.Create(agent)
@@ -69,11 +101,18 @@ func (api *API) UpdateAgent() http.HandlerFunc {
 		PSK  string `json:"psk"`
 		IP   string `json:"ip"`
 		Port int    `json:"port"`
+
+		// Labels are left untouched when not given.
+		Labels map[string]string `json:"labels"`
 	}
 	type response struct {
 		Agent *entity.Agent `json:"agent"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		agentID := vars["id"]
 
@@ -84,6 +123,12 @@ func (api *API) UpdateAgent() http.HandlerFunc {
 			return
 		}
 
+		err = manager.ValidateLabels(req.Labels)
+		if err != nil {
+			api.error(w, r, "Invalid labels.", err, http.StatusBadRequest)
+			return
+		}
+
 		agent, err := api.services.AgentSvc.Get([]byte(agentID))
 		if err != nil {
 			api.error(w, r, "Could not get agent.", err, http.StatusInternalServerError)
@@ -110,6 +155,9 @@ func (api *API) UpdateAgent() http.HandlerFunc {
 		agent.PSK = req.PSK
 		agent.IP = req.IP
 		agent.Port = req.Port
+		if req.Labels != nil {
+			agent.Labels = req.Labels
+		}
 
 		agent, err = api.services.AgentSvc.Update(agent)
 		if err != nil {
@@ -121,8 +169,12 @@ func (api *API) UpdateAgent() http.HandlerFunc {
 	}
 }
 
-func (api *API) DeleteAgent() http.HandlerFunc {
+func (api *API) DeleteAgent(man *manager.Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		agentID := vars["id"]
 
@@ -142,7 +194,176 @@ func (api *API) DeleteAgent() http.HandlerFunc {
 			api.error(w, r, "Could not delete agent.", err, http.StatusInternalServerError)
 			return
 		}
+		man.RevokeAgent(agent)
 
 		api.respond(w, r, nil, http.StatusNoContent)
 	}
 }
+
+// RotateAgentPSK rotates the PSK of the agent right away.
+func (api *API) RotateAgentPSK(man *manager.Manager) http.HandlerFunc {
+	type response struct {
+		Agent *entity.Agent `json:"agent"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		agentID := vars["id"]
+
+		agent, err := api.services.AgentSvc.Get([]byte(agentID))
+		if err != nil {
+			api.error(w, r, "Could not get agent.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if agent == nil {
+			api.error(w, r, "No agent found with that ID.", fmt.Errorf("no agent with that ID"), http.StatusNotFound)
+			return
+		}
+
+		agent, err = man.RotatePSK(agent)
+		if err != nil {
+			api.error(w, r, "Could not rotate PSK.", err, http.StatusBadGateway)
+			return
+		}
+
+		api.respond(w, r, response{Agent: agent}, http.StatusOK)
+	}
+}
+
+// ApproveAgent lets an agent that registered pending approval be given jobs.
+func (api *API) ApproveAgent(man *manager.Manager) http.HandlerFunc {
+	type response struct {
+		Agent *entity.Agent `json:"agent"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		agentID := vars["id"]
+
+		agent, err := api.services.AgentSvc.Get([]byte(agentID))
+		if err != nil {
+			api.error(w, r, "Could not get agent.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if agent == nil {
+			api.error(w, r, "No agent found with that ID.", fmt.Errorf("no agent with that ID"), http.StatusNotFound)
+			return
+		}
+
+		agent, err = man.ApproveAgent(agent)
+		if err != nil {
+			api.error(w, r, "Could not approve agent.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, response{Agent: agent}, http.StatusOK)
+	}
+}
+
+func (api *API) AgentHeartbeat(man *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agent, err := api.authenticateAgent(r)
+		if err != nil {
+			api.error(w, r, "Could not get agents.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if agent == nil {
+			api.error(w, r, "Forbidden", fmt.Errorf("forbidden"), http.StatusForbidden)
+			return
+		}
+
+		var req entity.Heartbeat
+		err = api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		_, err = man.Heartbeat(agent, &req)
+		if err != nil {
+			api.error(w, r, "Could not update agent.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
+
+// RenewAgentCertificate issues the agent a new certificate for the PEM encoded
+// certificate request, for agents whose certificate is about to expire.
+func (api *API) RenewAgentCertificate(man *manager.Manager) http.HandlerFunc {
+	type request struct {
+		CSR string `json:"csr"`
+	}
+	type response struct {
+		Certificate string `json:"certificate"`
+		CA          string `json:"ca"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		agent, err := api.authenticateAgent(r)
+		if err != nil {
+			api.error(w, r, "Could not get agents.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if agent == nil {
+			api.error(w, r, "Forbidden", fmt.Errorf("forbidden"), http.StatusForbidden)
+			return
+		}
+
+		var req request
+		err = api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		cert, err := man.SignAgent(agent, []byte(req.CSR))
+		if err != nil {
+			api.error(w, r, "Could not issue certificate.", err, http.StatusBadRequest)
+			return
+		}
+
+		api.respond(w, r, response{Certificate: string(cert), CA: string(man.CACertificate())}, http.StatusOK)
+	}
+}
+
+var tunnelUpgrader = websocket.Upgrader{}
+
+// AgentTunnel upgrades the request to a websocket that the agent keeps open, for
+// agents the server can't reach by itself. Requests coming from the agent over it
+// are served by the handler.
+func (api *API) AgentTunnel(man *manager.Manager, handler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agent, err := api.authenticateAgent(r)
+		if err != nil {
+			api.error(w, r, "Could not get agents.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if agent == nil {
+			api.error(w, r, "Forbidden", fmt.Errorf("forbidden"), http.StatusForbidden)
+			return
+		}
+
+		ws, err := tunnelUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			api.log.WithFields("method", r.Method, "path", r.URL.Path, "src", r.RemoteAddr).Error("could not upgrade tunnel:", err)
+			return
+		}
+
+		err = man.ServeTunnel(agent, ws, handler)
+		if err != nil {
+			api.log.WithFields("agent", agent.ID, "src", r.RemoteAddr).Warn("tunnel closed:", err)
+		}
+	}
+}
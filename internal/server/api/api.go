@@ -1,10 +1,16 @@
 package api
 
 import (
+	"crypto/subtle"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"zerosrealm.xyz/tergum/internal/ca"
+	"zerosrealm.xyz/tergum/internal/entity"
 	"zerosrealm.xyz/tergum/internal/log"
 	"zerosrealm.xyz/tergum/internal/server/service"
 )
@@ -14,12 +20,18 @@ const msgDecodeError = "Could not decode request."
 type API struct {
 	log      *log.Logger
 	services service.Services
+
+	// secureCookies marks cookies secure even for requests over plain HTTP, as
+	// when a proxy terminates TLS.
+	secureCookies bool
 }
 
-func New(logger *log.Logger, services *service.Services) *API {
+func New(logger *log.Logger, services *service.Services, secureCookies bool) *API {
 	return &API{
 		log:      logger,
 		services: *services,
+
+		secureCookies: secureCookies,
 	}
 }
 
@@ -69,6 +81,75 @@ func (api *API) decode(w http.ResponseWriter, r *http.Request, v interface{}) er
 	return json.NewDecoder(r.Body).Decode(v)
 }
 
+// authenticateAgent returns the agent whose PSK is given in the authorization
+// header of the request, nil if there is no such agent.
+func (api *API) authenticateAgent(r *http.Request) (*entity.Agent, error) {
+	// The listener only lets through client certificates issued by the CA.
+	if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+		return api.certificateAgent(r.TLS.VerifiedChains[0][0])
+	}
+
+	psk := presentedPSK(r)
+	if psk == "" {
+		return nil, nil
+	}
+
+	agents, err := api.services.AgentSvc.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, agent := range agents {
+		// During a rotation the agent may already use its next PSK.
+		current := subtle.ConstantTimeCompare([]byte(agent.PSK), []byte(psk)) == 1
+		next := agent.NextPSK != "" && subtle.ConstantTimeCompare([]byte(agent.NextPSK), []byte(psk)) == 1
+		if current || next {
+			// Agents with a certificate must use it when they connect directly.
+			// Requests over their tunnel have no TLS state of their own, the
+			// tunnel was authenticated when it was opened.
+			if agent.CertSerial != "" && r.TLS != nil {
+				return nil, nil
+			}
+			return agent, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// presentedPSK returns the PSK given in the authorization header of the request,
+// empty if there is none.
+func presentedPSK(r *http.Request) string {
+	auth := strings.SplitN(r.Header.Get("authorization"), " ", 2)
+	if len(auth) != 2 || strings.ToLower(auth[0]) != "psk" {
+		return ""
+	}
+
+	return auth[1]
+}
+
+// certificateAgent returns the agent the client certificate was issued to, nil
+// if it was revoked by deleting the agent or issuing it a new one.
+func (api *API) certificateAgent(cert *x509.Certificate) (*entity.Agent, error) {
+	// Other certificates from the CA, like the server's own, don't belong to an
+	// agent.
+	id, err := ca.AgentID(cert)
+	if err != nil {
+		return nil, nil
+	}
+
+	agent, err := api.services.AgentSvc.Get([]byte(strconv.Itoa(id)))
+	if err != nil {
+		return nil, err
+	}
+
+	if agent == nil || agent.CertSerial != ca.Serial(cert) {
+		return nil, nil
+	}
+
+	return agent, nil
+}
+
 func (api *API) template() http.HandlerFunc {
 	type request struct{}
 	type response struct{}
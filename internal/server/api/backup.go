@@ -4,16 +4,22 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/robfig/cron/v3"
 	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/restic"
 	manager "zerosrealm.xyz/tergum/internal/server/manager"
 )
 
-func (api *API) GetBackups() http.HandlerFunc {
+func (api *API) GetBackups(man *manager.Manager) http.HandlerFunc {
+	type backup struct {
+		*entity.Backup
+		// NextRun is when the backup next runs once blackouts are accounted for.
+		NextRun *time.Time `json:"next_run"`
+	}
 	type response struct {
-		Backups []*entity.Backup `json:"backups"`
+		Backups []*backup `json:"backups"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -23,24 +29,91 @@ func (api *API) GetBackups() http.HandlerFunc {
 			return
 		}
 
-		if backups == nil {
-			backups = make([]*entity.Backup, 0)
+		now := time.Now()
+		resp := make([]*backup, 0, len(backups))
+		for _, b := range backups {
+			if !canBackup(r, b) {
+				continue
+			}
+
+			next, err := man.NextRun(b, now)
+			if err != nil {
+				api.error(w, r, "Could not get next run.", err, http.StatusInternalServerError)
+				return
+			}
+
+			resp = append(resp, &backup{Backup: b, NextRun: next})
 		}
 
-		api.respond(w, r, &response{Backups: backups}, 200)
+		api.respond(w, r, &response{Backups: resp}, 200)
 	}
 }
 
+// validateSchedules checks the schedules of a backup. A request may still send a
+// single legacy cron string, which becomes a schedule named "default".
+func validateSchedules(schedules []*entity.Schedule, legacy string) ([]*entity.Schedule, error) {
+	if schedules == nil && legacy != "" {
+		schedules = []*entity.Schedule{{Name: "default", Cron: legacy}}
+	}
+
+	if schedules == nil {
+		return make([]*entity.Schedule, 0), nil
+	}
+
+	names := make(map[string]bool)
+	for _, sch := range schedules {
+		if sch == nil {
+			return nil, fmt.Errorf("schedule can not be empty")
+		}
+
+		if sch.Name == "" {
+			return nil, fmt.Errorf("schedule must have a name")
+		}
+
+		if names[sch.Name] {
+			return nil, fmt.Errorf("duplicate schedule name %q", sch.Name)
+		}
+		names[sch.Name] = true
+
+		_, err := manager.ParseSchedule(sch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, opt := range sch.Options {
+			if err := restic.ValidateBackupOption(opt); err != nil {
+				return nil, err
+			}
+		}
+
+		if sch.Tags == nil {
+			sch.Tags = []string{}
+		}
+
+		if sch.Options == nil {
+			sch.Options = []string{}
+		}
+	}
+
+	return schedules, nil
+}
+
 func (api *API) CreateBackup(man *manager.Manager) http.HandlerFunc {
 	type request struct {
-		Target   int    `json:"target"`
-		Source   string `json:"source"`
-		Schedule string `json:"schedule"`
+		Target    int                `json:"target"`
+		Source    string             `json:"source"`
+		Schedule  string             `json:"schedule"`
+		Schedules []*entity.Schedule `json:"schedules"`
+		Selector  string             `json:"selector"`
 	}
 	type response struct {
 		Backup *entity.Backup `json:"backup"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		var req request
 		err := api.decode(w, r, &req)
 		if err != nil {
@@ -48,17 +121,25 @@ func (api *API) CreateBackup(man *manager.Manager) http.HandlerFunc {
 			return
 		}
 
-		_, err = cron.ParseStandard(req.Schedule)
+		schedules, err := validateSchedules(req.Schedules, req.Schedule)
+		if err != nil {
+			api.error(w, r, "Invalid schedule.", err, http.StatusBadRequest)
+			return
+		}
+
+		_, err = manager.ParseSelector(req.Selector)
 		if err != nil {
-			api.error(w, r, "Invalid cron schedule.", err, http.StatusBadRequest)
+			api.error(w, r, "Invalid selector.", err, http.StatusBadRequest)
 			return
 		}
 
 		backup := &entity.Backup{
-			Target:   req.Target,
-			Source:   req.Source,
-			Schedule: req.Schedule,
-			Exclude:  []string{},
+			Target:    req.Target,
+			Source:    req.Source,
+			Schedules: schedules,
+			Exclude:   []string{},
+			Enabled:   true,
+			Selector:  req.Selector,
 		}
 
 		backup, err = api.services.BackupSvc.Create(backup)
@@ -67,7 +148,11 @@ func (api *API) CreateBackup(man *manager.Manager) http.HandlerFunc {
 			return
 		}
 
-		man.AddSchedule(req.Schedule, backup.ID)
+		err = man.Scheduler().Set(backup)
+		if err != nil {
+			api.error(w, r, "Could not schedule backup.", err, http.StatusInternalServerError)
+			return
+		}
 
 		r.Header.Add("Location", fmt.Sprintf("/backup/%d", backup.ID))
 		api.respond(w, r, response{Backup: backup}, http.StatusCreated)
@@ -76,15 +161,21 @@ func (api *API) CreateBackup(man *manager.Manager) http.HandlerFunc {
 
 func (api *API) UpdateBackup(man *manager.Manager) http.HandlerFunc {
 	type request struct {
-		Target   int      `json:"target"`
-		Source   string   `json:"source"`
-		Schedule string   `json:"schedule"`
-		Exclude  []string `json:"exclude"`
+		Target    int                `json:"target"`
+		Source    string             `json:"source"`
+		Schedule  string             `json:"schedule"`
+		Schedules []*entity.Schedule `json:"schedules"`
+		Exclude   []string           `json:"exclude"`
+		Selector  string             `json:"selector"`
 	}
 	type response struct {
 		Backup *entity.Backup `json:"backup"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		backupID := vars["id"]
 
@@ -116,36 +207,55 @@ func (api *API) UpdateBackup(man *manager.Manager) http.HandlerFunc {
 		// 	savedData.Backups = append(savedData.Backups, foundBackup)
 		// }
 
-		_, err = cron.ParseStandard(req.Schedule)
+		schedules, err := validateSchedules(req.Schedules, req.Schedule)
+		if err != nil {
+			api.error(w, r, "Invalid schedule.", err, http.StatusBadRequest)
+			return
+		}
+
+		_, err = manager.ParseSelector(req.Selector)
 		if err != nil {
-			api.error(w, r, "Invalid cron schedule.", err, http.StatusBadRequest)
+			api.error(w, r, "Invalid selector.", err, http.StatusBadRequest)
 			return
 		}
 
-		backup.Target = req.Target
-		backup.Source = req.Source
-		backup.Schedule = req.Schedule
-		backup.Exclude = req.Exclude
+		backup, err = man.Scheduler().Update(backup.ID, func(backup *entity.Backup) {
+			// Keep when each schedule last ran, which clients don't manage.
+			for _, sch := range schedules {
+				sch.LastRun = time.Time{}
+				for _, old := range backup.Schedules {
+					if old.Name == sch.Name {
+						sch.LastRun = old.LastRun
+					}
+				}
+			}
 
-		backup, err = api.services.BackupSvc.Update(backup)
+			backup.Target = req.Target
+			backup.Source = req.Source
+			backup.Schedules = schedules
+			backup.Exclude = req.Exclude
+			backup.Selector = req.Selector
+		})
 		if err != nil {
 			api.error(w, r, "Could not update backup.", err, http.StatusInternalServerError)
 			return
 		}
 
-		schedule := manager.GetSchedule(backup.ID)
-		if schedule == nil {
-			man.AddSchedule(backup.Schedule, backup.ID)
-		} else {
-			schedule.NewScheduler(backup.Schedule)
+		if backup == nil {
+			api.error(w, r, "No backup with that ID.", fmt.Errorf("no backup with that ID"), http.StatusNotFound)
+			return
 		}
 
 		api.respond(w, r, response{Backup: backup}, status)
 	}
 }
 
-func (api *API) DeleteBackup() http.HandlerFunc {
+func (api *API) DeleteBackup(man *manager.Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		backupID := vars["id"]
 
@@ -165,7 +275,7 @@ func (api *API) DeleteBackup() http.HandlerFunc {
 			api.error(w, r, "Could not delete backup.", err, http.StatusInternalServerError)
 			return
 		}
-		manager.RemoveSchedule(backup.ID)
+		man.Scheduler().Remove(backup.ID)
 
 		api.respond(w, r, nil, http.StatusNoContent)
 	}
@@ -190,6 +300,11 @@ func (api *API) GetBackupAgents() http.HandlerFunc {
 			return
 		}
 
+		if !canBackup(r, backup) {
+			api.forbid(w, r)
+			return
+		}
+
 		// TODO: Use a different service for this.
 		// agents, ok := savedData.BackupSubscribers[backup.ID]
 		// if !ok || agents == nil {
@@ -216,7 +331,11 @@ func (api *API) GetBackupAgents() http.HandlerFunc {
 				api.error(w, r, "Could not get agent.", err, http.StatusInternalServerError)
 				return
 			}
-			agents = append(agents, agent)
+
+			if agent == nil || !canAgent(r, agent) {
+				continue
+			}
+			agents = append(agents, redactAgent(r, agent))
 		}
 
 		api.respond(w, r, response{Agents: agents}, http.StatusOK)
@@ -231,6 +350,10 @@ func (api *API) UpdateBackupAgents() http.HandlerFunc {
 		Agents []*entity.Agent `json:"agents"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		backupID := vars["id"]
 
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
+)
+
+// validateBlackout checks the window and that the agent or repo it is linked to
+// exists.
+func (api *API) validateBlackout(blackout *entity.Blackout) (int, error) {
+	err := manager.ParseBlackout(blackout)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if blackout.AgentID != 0 {
+		agent, err := api.services.AgentSvc.Get([]byte(strconv.Itoa(blackout.AgentID)))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		if agent == nil {
+			return http.StatusBadRequest, fmt.Errorf("no agent with the ID '%d'", blackout.AgentID)
+		}
+	}
+
+	if blackout.RepoID != 0 {
+		repo, err := api.services.RepoSvc.Get([]byte(strconv.Itoa(blackout.RepoID)))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		if repo == nil {
+			return http.StatusBadRequest, fmt.Errorf("no repo with the ID '%d'", blackout.RepoID)
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+func (api *API) GetBlackouts() http.HandlerFunc {
+	type response struct {
+		Blackouts []*entity.Blackout `json:"blackouts"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		blackouts, err := api.services.BlackoutSvc.GetAll()
+		if err != nil {
+			api.error(w, r, "Could not get blackouts.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if blackouts == nil {
+			blackouts = make([]*entity.Blackout, 0)
+		}
+
+		api.respond(w, r, response{Blackouts: blackouts}, http.StatusOK)
+	}
+}
+
+func (api *API) CreateBlackout() http.HandlerFunc {
+	type request struct {
+		entity.Blackout
+	}
+	type response struct {
+		Blackout *entity.Blackout `json:"blackout"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		blackout := req.Blackout
+		blackout.ID = 0
+
+		status, err := api.validateBlackout(&blackout)
+		if err != nil {
+			api.error(w, r, "Invalid blackout.", err, status)
+			return
+		}
+
+		created, err := api.services.BlackoutSvc.Create(&blackout)
+		if err != nil {
+			api.error(w, r, "Could not create blackout.", err, http.StatusInternalServerError)
+			return
+		}
+
+		r.Header.Add("Location", fmt.Sprintf("/blackout/%d", created.ID))
+		api.respond(w, r, response{Blackout: created}, http.StatusCreated)
+	}
+}
+
+func (api *API) GetBlackout() http.HandlerFunc {
+	type response struct {
+		Blackout *entity.Blackout `json:"blackout"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		blackoutID := vars["id"]
+
+		blackout, err := api.services.BlackoutSvc.Get([]byte(blackoutID))
+		if err != nil {
+			api.error(w, r, "Could not get blackout.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if blackout == nil {
+			api.error(w, r, "No blackout found with that ID.", fmt.Errorf("no blackout found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		api.respond(w, r, response{Blackout: blackout}, http.StatusOK)
+	}
+}
+
+func (api *API) UpdateBlackout() http.HandlerFunc {
+	type request struct {
+		entity.Blackout
+	}
+	type response struct {
+		Blackout *entity.Blackout `json:"blackout"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		blackoutID := vars["id"]
+
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		blackout, err := api.services.BlackoutSvc.Get([]byte(blackoutID))
+		if err != nil {
+			api.error(w, r, "Could not get blackout.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if blackout == nil {
+			api.error(w, r, "No blackout found with that ID.", fmt.Errorf("no blackout found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		updated := req.Blackout
+		updated.ID = blackout.ID
+
+		status, err := api.validateBlackout(&updated)
+		if err != nil {
+			api.error(w, r, "Invalid blackout.", err, status)
+			return
+		}
+
+		blackout, err = api.services.BlackoutSvc.Update(&updated)
+		if err != nil {
+			api.error(w, r, "Could not update blackout.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, response{Blackout: blackout}, http.StatusOK)
+	}
+}
+
+func (api *API) DeleteBlackout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		blackoutID := vars["id"]
+
+		blackout, err := api.services.BlackoutSvc.Get([]byte(blackoutID))
+		if err != nil {
+			api.error(w, r, "Could not get blackout.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if blackout == nil {
+			api.error(w, r, "No blackout found with that ID.", fmt.Errorf("no blackout found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		err = api.services.BlackoutSvc.Delete([]byte(blackoutID))
+		if err != nil {
+			api.error(w, r, "Could not delete blackout.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
@@ -1,13 +1,173 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	agentRequest "zerosrealm.xyz/tergum/internal/agent/api/request"
 	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/restic"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
 )
 
+var resticDuration = regexp.MustCompile(`^(\d+[ymdh])+$`)
+
+// validateForgetOptions checks the options restic can't validate before running.
+func validateForgetOptions(forget *entity.Forget) error {
+	if forget.Within != "" && !resticDuration.MatchString(forget.Within) {
+		return fmt.Errorf("invalid duration '%s' for within", forget.Within)
+	}
+
+	if forget.GroupBy != "" {
+		for _, group := range strings.Split(forget.GroupBy, ",") {
+			switch group {
+			case "host", "paths", "tags":
+			default:
+				return fmt.Errorf("invalid group_by value '%s'", group)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateForget checks the policy's options and that it links to at most one
+// existing backup or repository, which no other policy is linked to.
+func (api *API) validateForget(forget *entity.Forget) (int, error) {
+	if forget.BackupID != 0 && forget.RepoID != 0 {
+		return http.StatusBadRequest, fmt.Errorf("a forget policy can be linked to either a backup or a repo, not both")
+	}
+
+	err := validateForgetOptions(forget)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if forget.BackupID != 0 {
+		backup, err := api.services.BackupSvc.Get([]byte(strconv.Itoa(forget.BackupID)))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		if backup == nil {
+			return http.StatusBadRequest, fmt.Errorf("no backup with the ID '%d'", forget.BackupID)
+		}
+	}
+
+	if forget.RepoID != 0 {
+		repo, err := api.services.RepoSvc.Get([]byte(strconv.Itoa(forget.RepoID)))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		if repo == nil {
+			return http.StatusBadRequest, fmt.Errorf("no repo with the ID '%d'", forget.RepoID)
+		}
+	}
+
+	if forget.BackupID == 0 && forget.RepoID == 0 {
+		return http.StatusOK, nil
+	}
+
+	forgets, err := api.services.ForgetSvc.GetAll()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	for _, other := range forgets {
+		if other.ID == forget.ID {
+			continue
+		}
+
+		if forget.BackupID != 0 && other.BackupID == forget.BackupID {
+			return http.StatusConflict, fmt.Errorf("backup '%d' already has forget policy '%d'", forget.BackupID, other.ID)
+		}
+
+		if forget.RepoID != 0 && other.RepoID == forget.RepoID {
+			return http.StatusConflict, fmt.Errorf("repo '%d' already has forget policy '%d'", forget.RepoID, other.ID)
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+func (api *API) GetForgets() http.HandlerFunc {
+	type response struct {
+		Forgets []*entity.Forget `json:"forgets"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		forgets, err := api.services.ForgetSvc.GetAll()
+		if err != nil {
+			api.error(w, r, "Could not get forget policies.", err, http.StatusInternalServerError)
+			return
+		}
+
+		visible := make([]*entity.Forget, 0, len(forgets))
+		for _, forget := range forgets {
+			ok, err := api.canForget(r, forget)
+			if err != nil {
+				api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+				return
+			}
+
+			if ok {
+				visible = append(visible, forget)
+			}
+		}
+
+		api.respond(w, r, &response{Forgets: visible}, http.StatusOK)
+	}
+}
+
+func (api *API) CreateForget() http.HandlerFunc {
+	type request struct {
+		entity.Forget
+	}
+	type response struct {
+		Forget *entity.Forget `json:"forget"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		forget := req.Forget
+		forget.ID = 0
+
+		if forget.BackupID == 0 && forget.RepoID == 0 {
+			api.error(w, r, "A forget policy must be linked to a backup or a repo.", fmt.Errorf("no backup or repo given"), http.StatusBadRequest)
+			return
+		}
+
+		status, err := api.validateForget(&forget)
+		if err != nil {
+			api.error(w, r, "Invalid forget policy.", err, status)
+			return
+		}
+
+		created, err := api.services.ForgetSvc.Create(&forget)
+		if err != nil {
+			api.error(w, r, "Could not create forget policy.", err, http.StatusInternalServerError)
+			return
+		}
+
+		r.Header.Add("Location", fmt.Sprintf("/forget/%d", created.ID))
+		api.respond(w, r, response{Forget: created}, http.StatusCreated)
+	}
+}
+
 func (api *API) GetForget() http.HandlerFunc {
 	type request struct{}
 	type response struct {
@@ -28,6 +188,17 @@ func (api *API) GetForget() http.HandlerFunc {
 			return
 		}
 
+		ok, err := api.canForget(r, forget)
+		if err != nil {
+			api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			api.forbid(w, r)
+			return
+		}
+
 		api.respond(w, r, response{Forget: forget}, http.StatusOK)
 	}
 }
@@ -40,6 +211,10 @@ func (api *API) UpdateForget() http.HandlerFunc {
 		Forget *entity.Forget `json:"forget"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		forgetID := vars["id"]
 
@@ -61,15 +236,27 @@ func (api *API) UpdateForget() http.HandlerFunc {
 			return
 		}
 
-		forget.Enabled = req.Enabled
-		forget.LastX = req.LastX
-		forget.Hourly = req.Hourly
-		forget.Daily = req.Daily
-		forget.Weekly = req.Weekly
-		forget.Monthly = req.Monthly
-		forget.Yearly = req.Yearly
+		updated := req.Forget
+		updated.ID = forget.ID
+
+		// The default policy applies to every backup, so it can't be linked.
+		if updated.ID == 0 && (updated.BackupID != 0 || updated.RepoID != 0) {
+			api.error(w, r, "The default forget policy cannot be linked to a backup or repo.", fmt.Errorf("default forget policy cannot be linked"), http.StatusBadRequest)
+			return
+		}
+
+		if updated.ID != 0 && updated.BackupID == 0 && updated.RepoID == 0 {
+			api.error(w, r, "A forget policy must be linked to a backup or a repo.", fmt.Errorf("no backup or repo given"), http.StatusBadRequest)
+			return
+		}
 
-		forget, err = api.services.ForgetSvc.Update(forget)
+		status, err := api.validateForget(&updated)
+		if err != nil {
+			api.error(w, r, "Invalid forget policy.", err, status)
+			return
+		}
+
+		forget, err = api.services.ForgetSvc.Update(&updated)
 		if err != nil {
 			api.error(w, r, "Could not update forget policy.", err, http.StatusInternalServerError)
 			return
@@ -78,3 +265,275 @@ func (api *API) UpdateForget() http.HandlerFunc {
 		api.respond(w, r, response{Forget: forget}, http.StatusOK)
 	}
 }
+
+func (api *API) DeleteForget() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		forgetID := vars["id"]
+
+		forget, err := api.services.ForgetSvc.Get([]byte(forgetID))
+		if err != nil {
+			api.error(w, r, "Could not get forget policy.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if forget == nil {
+			api.error(w, r, "No forget policy found with that ID.", fmt.Errorf("no forget found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if forget.ID == 0 {
+			api.error(w, r, "The default forget policy cannot be deleted.", fmt.Errorf("default forget policy cannot be deleted"), http.StatusBadRequest)
+			return
+		}
+
+		err = api.services.ForgetSvc.Delete([]byte(forgetID))
+		if err != nil {
+			api.error(w, r, "Could not delete forget policy.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
+
+// previewForgets previews each of the policies, as scoped to the sources of a
+// backup, and returns all their groups.
+func (api *API) previewForgets(man *manager.Manager, resticExe *restic.Restic, repo *entity.Repo, policies []*entity.Forget) ([]*restic.ForgetPreview, error) {
+	groups := make([]*restic.ForgetPreview, 0)
+	for _, policy := range policies {
+		previews, err := api.previewForget(man, resticExe, repo, policy)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, previews...)
+	}
+
+	return groups, nil
+}
+
+// previewForget runs the policy with --dry-run against the repository, on the
+// server if it has restic and otherwise on the first agent able to.
+func (api *API) previewForget(man *manager.Manager, resticExe *restic.Restic, repo *entity.Repo, policy *entity.Forget) ([]*restic.ForgetPreview, error) {
+	forgetReq := &agentRequest.Forget{
+		Repo:   repo,
+		Policy: policy,
+		DryRun: true,
+	}
+
+	if resticExe != nil {
+		previews, err := resticExe.ForgetPreview(repo.Repo, repo.Password, forgetReq.Options(), repo.Settings...)
+		if err == nil {
+			return previews, nil
+		}
+		api.log.Debug("Server could not preview forget policy:", err)
+	}
+
+	agents, err := api.services.AgentSvc.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not get agents: %w", err)
+	}
+
+	for _, agent := range agents {
+		api.log.Debug("Sending request to agent", agent.Name)
+		jobRequest := &entity.JobRequest{
+			Type:  "forgetpreview",
+			Agent: agent,
+
+			Data: forgetReq,
+		}
+
+		body, err := man.SendRequest(jobRequest, agent)
+		if err != nil {
+			api.log.Debug("Agent returned error:", err)
+			continue
+		}
+
+		var agentResp struct {
+			Output string `json:"output"`
+		}
+		err = json.Unmarshal(body, &agentResp)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal agent response: %w", err)
+		}
+
+		return restic.ParseForgetPreview([]byte(agentResp.Output))
+	}
+
+	return nil, fmt.Errorf("no agents could preview the forget policy, check debug logs")
+}
+
+// PreviewForget runs the policy with --dry-run against its repository, or the
+// repository given by the "repo" query parameter for the default policy. It runs
+// restic against the repository, so is for operators.
+func (api *API) PreviewForget(man *manager.Manager, resticExe *restic.Restic) http.HandlerFunc {
+	type response struct {
+		Groups []*restic.ForgetPreview `json:"groups"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		forgetID := vars["id"]
+
+		forget, err := api.services.ForgetSvc.Get([]byte(forgetID))
+		if err != nil {
+			api.error(w, r, "Could not get forget policy.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if forget == nil {
+			api.error(w, r, "No forget policy found with that ID.", fmt.Errorf("no forget found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		ok, err := api.canForget(r, forget)
+		if err != nil {
+			api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			api.forbid(w, r)
+			return
+		}
+
+		var backup *entity.Backup
+		repoID := r.URL.Query().Get("repo")
+		if forget.RepoID != 0 {
+			repoID = strconv.Itoa(forget.RepoID)
+		}
+
+		if forget.BackupID != 0 {
+			backup, err = api.services.BackupSvc.Get([]byte(strconv.Itoa(forget.BackupID)))
+			if err != nil {
+				api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+				return
+			}
+
+			if backup == nil {
+				api.error(w, r, "No backup found for the forget policy.", fmt.Errorf("no backup with the ID '%d'", forget.BackupID), http.StatusNotFound)
+				return
+			}
+			repoID = strconv.Itoa(backup.Target)
+		}
+
+		if repoID == "" {
+			api.error(w, r, "No repository given to preview the forget policy against.", fmt.Errorf("no repo given"), http.StatusBadRequest)
+			return
+		}
+
+		repo, err := api.services.RepoSvc.Get([]byte(repoID))
+		if err != nil {
+			api.error(w, r, "Could not get repository.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if repo == nil {
+			api.error(w, r, "No repository found with that ID.", fmt.Errorf("no repo found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if !canRepo(r, repo.ID) {
+			api.forbid(w, r)
+			return
+		}
+
+		policies, err := man.ScopeForgetPreview(forget, backup)
+		if err != nil {
+			api.error(w, r, "Could not scope forget policy to the backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		groups, err := api.previewForgets(man, resticExe, repo, policies)
+		if err != nil {
+			api.error(w, r, "Could not preview forget policy.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, response{Groups: groups}, http.StatusOK)
+	}
+}
+
+// PreviewRepoForget shows which snapshots in the repository the given policy
+// would keep and remove, without saving the policy. Like PreviewForget it is for
+// operators.
+func (api *API) PreviewRepoForget(man *manager.Manager, resticExe *restic.Restic) http.HandlerFunc {
+	type request struct {
+		entity.Forget
+	}
+	type response struct {
+		Groups []*restic.ForgetPreview `json:"groups"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		repoID := vars["id"]
+
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		err = validateForgetOptions(&req.Forget)
+		if err != nil {
+			api.error(w, r, "Invalid forget policy.", err, http.StatusBadRequest)
+			return
+		}
+
+		repo, err := api.services.RepoSvc.Get([]byte(repoID))
+		if err != nil {
+			api.error(w, r, "Could not get repository.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if repo == nil {
+			api.error(w, r, "No repository found with that ID.", fmt.Errorf("no repo found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if !canRepo(r, repo.ID) {
+			api.forbid(w, r)
+			return
+		}
+
+		var backup *entity.Backup
+		if req.BackupID != 0 {
+			backup, err = api.services.BackupSvc.Get([]byte(strconv.Itoa(req.BackupID)))
+			if err != nil {
+				api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+				return
+			}
+
+			if backup == nil || backup.Target != repo.ID {
+				api.error(w, r, "No backup with that ID in the repository.", fmt.Errorf("no backup with the ID '%d' in repo '%d'", req.BackupID, repo.ID), http.StatusBadRequest)
+				return
+			}
+		}
+
+		policies, err := man.ScopeForgetPreview(&req.Forget, backup)
+		if err != nil {
+			api.error(w, r, "Could not scope forget policy to the backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		groups, err := api.previewForgets(man, resticExe, repo, policies)
+		if err != nil {
+			api.error(w, r, "Could not preview forget policy.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, response{Groups: groups}, http.StatusOK)
+	}
+}
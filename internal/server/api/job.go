@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/gorilla/mux"
@@ -33,7 +32,15 @@ func (api *API) GetJobs(man *manager.Manager) http.HandlerFunc {
 		}
 
 		for _, job := range jobs {
-			respJobs[job.ID] = job
+			ok, err := api.canJob(r, job)
+			if err != nil {
+				api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+				return
+			}
+
+			if ok {
+				respJobs[job.ID] = job
+			}
 		}
 
 		api.respond(w, r, &response{respJobs}, http.StatusOK)
@@ -42,6 +49,10 @@ func (api *API) GetJobs(man *manager.Manager) http.HandlerFunc {
 
 func (api *API) StopJob(man *manager.Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		jobID := vars["id"]
 
@@ -56,12 +67,33 @@ func (api *API) StopJob(man *manager.Manager) http.HandlerFunc {
 			return
 		}
 
-		backupRequest := job.Request.Data.(*agentRequest.Backup)
+		if job.Request == nil {
+			api.error(w, r, "Job is no longer running.", fmt.Errorf("job has no request"), http.StatusBadRequest)
+			return
+		}
+
+		backupRequest, ok := job.Request.Data.(*agentRequest.Backup)
+		if !ok {
+			api.error(w, r, "Only backup jobs can be stopped.", fmt.Errorf("cannot stop job of type %s", job.Request.Type), http.StatusBadRequest)
+			return
+		}
+
 		if backupRequest.ID == "" {
 			api.error(w, r, "No backup found with that ID.", fmt.Errorf("no backup found with that ID"), http.StatusNotFound)
 			return
 		}
 
+		ok, err = api.canBackupID(r, backupRequest.Backup.ID)
+		if err != nil {
+			api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			api.forbid(w, r)
+			return
+		}
+
 		agents, err := api.services.BackupSubSvc.Get([]byte(strconv.Itoa(backupRequest.Backup.ID)))
 		if err != nil {
 			api.error(w, r, "Could not get backup subscriptions.", err, http.StatusInternalServerError)
@@ -118,37 +150,13 @@ func (api *API) JobProgress(man *manager.Manager, resticExe *restic.Restic) http
 		Job  *entity.Job `json:"job"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("authorization")
-		auth := strings.SplitN(authHeader, " ", 2)
-		if len(auth) != 2 || strings.ToLower(auth[0]) != "psk" {
-			api.error(w, r, "Forbidden", fmt.Errorf("forbidden"), http.StatusForbidden)
-			return
-		}
-
-		psk := auth[1]
-		access := false
-
-		agents, err := api.services.AgentSvc.GetAll()
+		agent, err := api.authenticateAgent(r)
 		if err != nil {
 			api.error(w, r, "Could not get agents.", err, http.StatusInternalServerError)
 			return
 		}
 
-		if agents == nil {
-			api.error(w, r, "Forbidden", fmt.Errorf("forbidden"), http.StatusForbidden)
-			return
-		}
-
-		var authedAgent *entity.Agent
-		for _, agent := range agents {
-			if agent.PSK == psk {
-				access = true
-				authedAgent = agent
-				break
-			}
-		}
-
-		if !access {
+		if agent == nil {
 			api.error(w, r, "Forbidden", fmt.Errorf("forbidden"), http.StatusForbidden)
 			return
 		}
@@ -167,6 +175,12 @@ func (api *API) JobProgress(man *manager.Manager, resticExe *restic.Restic) http
 			return
 		}
 
+		// Agents only report on their own jobs.
+		if job.AgentID != agent.ID {
+			api.error(w, r, "Forbidden", fmt.Errorf("job %s belongs to agent %d, not agent %d", job.ID, job.AgentID, agent.ID), http.StatusForbidden)
+			return
+		}
+
 		var req request
 		err = api.decode(w, r, &req)
 		if err != nil {
@@ -174,7 +188,20 @@ func (api *API) JobProgress(man *manager.Manager, resticExe *restic.Restic) http
 			return
 		}
 
-		man.UpdateJobProgress(job, req.Msg)
+		delivered, err := man.Deliver(job.ID, r.Header.Get("X-Message-ID"), func(current *entity.Job) error {
+			job = current
+			man.UpdateJobProgress(job, req.Msg)
+			return nil
+		})
+		if err != nil {
+			api.error(w, r, "Could not update job.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if !delivered {
+			api.respond(w, r, nil, http.StatusNoContent)
+			return
+		}
 
 		wsResponse := wsResponse{
 			Type: "job_progress",
@@ -189,56 +216,31 @@ func (api *API) JobProgress(man *manager.Manager, resticExe *restic.Restic) http
 
 		api.log.WithFields("method", r.Method, "path", r.URL.Path, "src", r.RemoteAddr).Debug("Websocket data:", spew.Sdump(wsResponse))
 
-		man.WriteWS([]byte(jobJSON))
-
-		if job.Done {
-			forgetPolicy, err := api.services.ForgetSvc.Get([]byte("0"))
-			if err != nil {
-				api.error(w, r, "Could not get forget policy.", err, http.StatusInternalServerError)
-				return
-			}
-
-			if !forgetPolicy.Enabled {
-				api.respond(w, r, nil, http.StatusNoContent)
-				return
-			}
-
-			backupRequest := job.Request.Data.(*agentRequest.Backup)
-			if backupRequest.ID == "" {
-				api.error(w, r, "Running forget policy failed.", fmt.Errorf("backup request is invalid"), http.StatusBadRequest)
-				return
-			}
-
-			forgetReq := &agentRequest.Forget{
-				Repo:   backupRequest.Repo,
-				Policy: forgetPolicy,
-			}
-			jobRequest := &entity.JobRequest{
-				Type:  "forget",
-				Agent: authedAgent,
-
-				Data: forgetReq,
-			}
-
-			_, err = man.SendRequest(jobRequest, authedAgent)
-			if err != nil {
-				api.error(w, r, "Could not run forget policy.", err, http.StatusInternalServerError)
-				return
-			}
+		watchers, err := api.jobWatchers(job)
+		if err != nil {
+			api.error(w, r, "Could not get job's scope.", err, http.StatusInternalServerError)
+			return
 		}
 
+		man.WriteWS([]byte(jobJSON), watchers)
+
 		api.respond(w, r, nil, http.StatusNoContent)
 	}
 }
 
 func (api *API) CreateJob(man *manager.Manager) http.HandlerFunc {
 	type request struct {
-		Backup int `json:"backup"`
+		Backup   int    `json:"backup"`
+		Schedule string `json:"schedule"`
 	}
 	type response struct {
 		Jobs []*entity.Job `json:"jobs"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
 		var req request
 		err := api.decode(w, r, &req)
 		if err != nil {
@@ -246,15 +248,39 @@ func (api *API) CreateJob(man *manager.Manager) http.HandlerFunc {
 			return
 		}
 
-		// TODO: Does this mean it can only find the schedule of the first backup?
-		// So a backup can only have one schedule?
-		schedule := manager.GetSchedule(req.Backup)
-		if schedule == nil {
-			api.error(w, r, "Could not get schedule for backup.", fmt.Errorf("no schedule found for that backup"), http.StatusNotFound)
+		backup, err := api.services.BackupSvc.Get([]byte(strconv.Itoa(req.Backup)))
+		if err != nil {
+			api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
 			return
 		}
 
-		jobs, err := schedule.Start()
+		if backup == nil {
+			api.error(w, r, "No backup with that ID.", fmt.Errorf("no backup with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if !canBackup(r, backup) {
+			api.forbid(w, r)
+			return
+		}
+
+		// Without a schedule the backup runs as is, otherwise with the tags and
+		// options of the named schedule.
+		var schedule *entity.Schedule
+		if req.Schedule != "" {
+			for _, sch := range backup.Schedules {
+				if sch.Name == req.Schedule {
+					schedule = sch
+				}
+			}
+
+			if schedule == nil {
+				api.error(w, r, "No schedule with that name.", fmt.Errorf("no schedule named %q for that backup", req.Schedule), http.StatusNotFound)
+				return
+			}
+		}
+
+		jobs, err := man.StartBackup(backup.ID, schedule)
 		if err != nil {
 			api.error(w, r, "Could not start backup.", err, http.StatusInternalServerError)
 			return
@@ -282,36 +308,14 @@ func (api *API) JobError(man *manager.Manager) http.HandlerFunc {
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("authorization")
-		auth := strings.SplitN(authHeader, " ", 2)
-		if len(auth) != 2 || strings.ToLower(auth[0]) != "psk" {
-			w.WriteHeader(http.StatusForbidden)
-			return
-		}
-
-		psk := auth[1]
-		access := false
-
-		agents, err := api.services.AgentSvc.GetAll()
+		agent, err := api.authenticateAgent(r)
 		if err != nil {
 			api.error(w, r, "Could not get agents.", err, http.StatusInternalServerError)
 			return
 		}
 
-		if agents == nil {
-			w.WriteHeader(http.StatusForbidden)
-			return
-		}
-
-		for _, agent := range agents {
-			if agent.PSK == psk {
-				access = true
-				break
-			}
-		}
-
-		if !access {
-			w.WriteHeader(http.StatusForbidden)
+		if agent == nil {
+			api.error(w, r, "Forbidden", fmt.Errorf("forbidden"), http.StatusForbidden)
 			return
 		}
 
@@ -329,7 +333,11 @@ func (api *API) JobError(man *manager.Manager) http.HandlerFunc {
 			return
 		}
 
-		job.Aborted = true
+		// Agents only report on their own jobs.
+		if job.AgentID != agent.ID {
+			api.error(w, r, "Forbidden", fmt.Errorf("job %s belongs to agent %d, not agent %d", job.ID, job.AgentID, agent.ID), http.StatusForbidden)
+			return
+		}
 
 		var req request
 		err = api.decode(w, r, &req)
@@ -338,6 +346,20 @@ func (api *API) JobError(man *manager.Manager) http.HandlerFunc {
 			return
 		}
 
+		delivered, err := man.Deliver(job.ID, r.Header.Get("X-Message-ID"), func(current *entity.Job) error {
+			job = current
+			return man.JobFailed(current, req.Msg, req.Error)
+		})
+		if err != nil {
+			api.error(w, r, "Could not update job.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if !delivered {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
 		wsResponse := wsResponse{
 			Type:  "job_error",
 			Error: req.Error,
@@ -350,7 +372,13 @@ func (api *API) JobError(man *manager.Manager) http.HandlerFunc {
 			return
 		}
 
-		man.WriteWS([]byte(jobJSON))
+		watchers, err := api.jobWatchers(job)
+		if err != nil {
+			api.error(w, r, "Could not get job's scope.", err, http.StatusInternalServerError)
+			return
+		}
+
+		man.WriteWS([]byte(jobJSON), watchers)
 
 		w.WriteHeader(http.StatusOK)
 	}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"os"
 	"strings"
+
+	"zerosrealm.xyz/tergum/internal/entity"
 )
 
 func (api *API) GetLogs() http.HandlerFunc {
@@ -15,6 +17,10 @@ func (api *API) GetLogs() http.HandlerFunc {
 		Logs []logLine `json:"logs"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		file, err := os.OpenFile(api.log.GetFilePath(), os.O_RDONLY, 0666)
 		if err != nil {
 			api.error(w, r, "Could not open log file.", err, http.StatusInternalServerError)
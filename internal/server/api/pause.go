@@ -0,0 +1,240 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
+)
+
+type pauseRequest struct {
+	// Until is optional, without it the pause lasts until resumed.
+	Until time.Time `json:"until"`
+}
+
+// decodePause reads a pause request, allowing an empty body.
+func (api *API) decodePause(w http.ResponseWriter, r *http.Request) (*pauseRequest, error) {
+	var req pauseRequest
+	err := api.decode(w, r, &req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if !req.Until.IsZero() && !req.Until.After(time.Now()) {
+		return nil, fmt.Errorf("until must be in the future")
+	}
+
+	return &req, nil
+}
+
+func (api *API) PauseBackup(man *manager.Manager) http.HandlerFunc {
+	type response struct {
+		Backup *entity.Backup `json:"backup"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		backupID := vars["id"]
+
+		req, err := api.decodePause(w, r)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		backup, err := api.services.BackupSvc.Get([]byte(backupID))
+		if err != nil {
+			api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if backup == nil {
+			api.error(w, r, "No backup with that ID.", fmt.Errorf("no backup with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if !canBackup(r, backup) {
+			api.forbid(w, r)
+			return
+		}
+
+		backup, err = man.Scheduler().Update(backup.ID, func(backup *entity.Backup) {
+			backup.Enabled = !req.Until.IsZero()
+			backup.PausedUntil = req.Until
+		})
+		if err != nil {
+			api.error(w, r, "Could not pause backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if backup == nil {
+			api.error(w, r, "No backup with that ID.", fmt.Errorf("no backup with that ID"), http.StatusNotFound)
+			return
+		}
+
+		api.respond(w, r, response{Backup: backup}, http.StatusOK)
+	}
+}
+
+func (api *API) ResumeBackup(man *manager.Manager) http.HandlerFunc {
+	type response struct {
+		Backup *entity.Backup `json:"backup"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		backupID := vars["id"]
+
+		backup, err := api.services.BackupSvc.Get([]byte(backupID))
+		if err != nil {
+			api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if backup == nil {
+			api.error(w, r, "No backup with that ID.", fmt.Errorf("no backup with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if !canBackup(r, backup) {
+			api.forbid(w, r)
+			return
+		}
+
+		backup, err = man.Scheduler().Update(backup.ID, func(backup *entity.Backup) {
+			backup.Enabled = true
+			backup.PausedUntil = time.Time{}
+		})
+		if err != nil {
+			api.error(w, r, "Could not resume backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if backup == nil {
+			api.error(w, r, "No backup with that ID.", fmt.Errorf("no backup with that ID"), http.StatusNotFound)
+			return
+		}
+
+		api.respond(w, r, response{Backup: backup}, http.StatusOK)
+	}
+}
+
+func (api *API) PauseAgent() http.HandlerFunc {
+	type response struct {
+		Agent *entity.Agent `json:"agent"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		agentID := vars["id"]
+
+		req, err := api.decodePause(w, r)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		agent, err := api.services.AgentSvc.Get([]byte(agentID))
+		if err != nil {
+			api.error(w, r, "Could not get agent.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if agent == nil {
+			api.error(w, r, "No agent found with that ID.", fmt.Errorf("no agent with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if !canAgent(r, agent) {
+			api.forbid(w, r)
+			return
+		}
+
+		agent.SchedulesPaused = true
+		agent.PausedUntil = req.Until
+
+		agent, err = api.services.AgentSvc.Update(agent)
+		if err != nil {
+			api.error(w, r, "Could not pause agent.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, response{Agent: agent}, http.StatusOK)
+	}
+}
+
+func (api *API) ResumeAgent() http.HandlerFunc {
+	type response struct {
+		Agent *entity.Agent `json:"agent"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		agentID := vars["id"]
+
+		agent, err := api.services.AgentSvc.Get([]byte(agentID))
+		if err != nil {
+			api.error(w, r, "Could not get agent.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if agent == nil {
+			api.error(w, r, "No agent found with that ID.", fmt.Errorf("no agent with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if !canAgent(r, agent) {
+			api.forbid(w, r)
+			return
+		}
+
+		agent.SchedulesPaused = false
+		agent.PausedUntil = time.Time{}
+
+		agent, err = api.services.AgentSvc.Update(agent)
+		if err != nil {
+			api.error(w, r, "Could not resume agent.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, response{Agent: agent}, http.StatusOK)
+	}
+}
+
+// SetSchedulesPaused returns a handler that pauses or resumes every scheduled
+// backup at once.
+func (api *API) SetSchedulesPaused(man *manager.Manager, paused bool) http.HandlerFunc {
+	type response struct {
+		Paused bool `json:"paused"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		err := man.SetSchedulesPaused(paused)
+		if err != nil {
+			api.error(w, r, "Could not update schedules-paused setting.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, response{Paused: paused}, http.StatusOK)
+	}
+}
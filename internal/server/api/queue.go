@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/queue"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
+)
+
+func (api *API) GetQueues(man *manager.Manager) http.HandlerFunc {
+	type response struct {
+		Queues []queue.Stats `json:"queues"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		api.respond(w, r, response{Queues: man.QueueStats()}, http.StatusOK)
+	}
+}
@@ -1,33 +1,83 @@
 package api
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strings"
+	"time"
 
 	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
 )
 
-func generatePSK(n int) (string, error) {
-	bytes := make([]byte, n)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+// matchAgent finds the agent registering again, by its machine ID. Agents
+// registered before they had one are matched by host name, address and port,
+// and take on the machine ID. The match only tells which agent it would be,
+// the agent still has to prove it is that agent with its credentials.
+func matchAgent(agents []*entity.Agent, machineID, hostname, ip string, port int) *entity.Agent {
+	if machineID != "" {
+		for _, agent := range agents {
+			if agent.MachineID == machineID {
+				return agent
+			}
+		}
 	}
-	return hex.EncodeToString(bytes), nil
+
+	for _, agent := range agents {
+		if agent.MachineID == "" && agent.Name == hostname && agent.IP == ip && agent.Port == port {
+			return agent
+		}
+	}
+
+	return nil
 }
 
-func (api *API) RegisterAgent() http.HandlerFunc {
+func (api *API) RegisterAgent(man *manager.Manager) http.HandlerFunc {
 	type request struct {
-		Hostname string `json:"hostname"`
-		Port     int    `json:"port"`
-		Token    string `json:"token"`
+		MachineID string `json:"machine_id"`
+		Hostname  string `json:"hostname"`
+		Port      int    `json:"port"`
+		Token     string `json:"token"`
+
+		// Address the agent is reached at, if not the one it registers from.
+		Address string `json:"address"`
+
+		Labels map[string]string `json:"labels"`
+		Tunnel bool              `json:"tunnel"`
+		TLS    bool              `json:"tls"`
+
+		// CSR is a PEM encoded certificate request, for agents that want a
+		// certificate from the CA.
+		CSR string `json:"csr"`
+
+		entity.AgentInfo
 	}
 
 	type response struct {
 		*entity.Agent
+
+		// Certificate issued for the CSR, and the certificate of the CA the agent
+		// verifies the server with.
+		Certificate string `json:"certificate,omitempty"`
+		CA          string `json:"ca,omitempty"`
+	}
+
+	// respond issues the agent a certificate first if it asked for one.
+	respond := func(w http.ResponseWriter, r *http.Request, agent *entity.Agent, csr string) {
+		resp := &response{Agent: agent}
+		if csr != "" {
+			cert, err := man.SignAgent(agent, []byte(csr))
+			if err != nil {
+				api.error(w, r, "Could not issue certificate.", err, http.StatusBadRequest)
+				return
+			}
+			resp.Certificate = string(cert)
+			resp.CA = string(man.CACertificate())
+		}
+
+		api.respond(w, r, resp, http.StatusOK)
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req request
@@ -61,66 +111,134 @@ func (api *API) RegisterAgent() http.HandlerFunc {
 			return
 		}
 
-		// Get the token.
-		setting, err = api.services.SettingSvc.Get([]byte("registration-token"))
+		err = manager.ValidateLabels(req.Labels)
 		if err != nil {
-			api.error(w, r, "Could not get registration-token setting.", err, http.StatusInternalServerError)
+			api.error(w, r, "Invalid labels.", err, http.StatusBadRequest)
 			return
 		}
 
-		if setting == nil {
-			api.error(w, r, "registration-token setting not found.", fmt.Errorf("registration-token setting not found"), http.StatusInternalServerError)
+		// TODO: Optimize with filters.
+		agents, err := api.services.AgentSvc.GetAll()
+		if err != nil {
+			api.error(w, r, "Could not retrieve agents.", err, http.StatusInternalServerError)
 			return
 		}
 
-		var token string
-		err = json.Unmarshal(setting.Value, &token)
+		ip, err := man.ClientIP(r)
 		if err != nil {
-			api.error(w, r, "Could not parse registration-token setting.", err, http.StatusInternalServerError)
+			api.error(w, r, "Could not get client address.", err, http.StatusInternalServerError)
 			return
 		}
 
-		// Check if the token is valid.
-		if token != req.Token {
-			api.error(w, r, "Invalid token.", fmt.Errorf("invalid token"), http.StatusForbidden)
-			return
+		// Only a trusted proxy may tell where the agent is reached, anyone else
+		// could point the server at an address of their choosing.
+		if address := strings.TrimSpace(req.Address); address != "" {
+			proxied, err := man.FromTrustedProxy(r)
+			if err != nil {
+				api.error(w, r, "Could not get client address.", err, http.StatusInternalServerError)
+				return
+			}
+
+			if proxied {
+				ip = address
+			} else {
+				api.log.WithFields("address", address, "src", r.RemoteAddr).Warn("ignoring agent address, request did not come through a trusted proxy")
+			}
 		}
 
-		// TODO: Optimize with filters.
-		agents, err := api.services.AgentSvc.GetAll()
+		// An agent registering again authenticates with its PSK or certificate.
+		authed, err := api.authenticateAgent(r)
 		if err != nil {
-			api.error(w, r, "Could not retrieve agents.", err, http.StatusInternalServerError)
+			api.error(w, r, "Could not authenticate agent.", err, http.StatusInternalServerError)
 			return
 		}
 
-		ip := strings.Split(r.RemoteAddr, ":")[0]
+		agent := matchAgent(agents, req.MachineID, req.Hostname, ip, req.Port)
+		if authed != nil {
+			if agent != nil && agent.ID != authed.ID {
+				api.error(w, r, "Machine ID belongs to another agent.", fmt.Errorf("machine id of agent %d given by agent %d", agent.ID, authed.ID), http.StatusForbidden)
+				return
+			}
+			agent = authed
+		} else if agent != nil {
+			api.error(w, r, "Agent is already registered, it must authenticate to register again.", fmt.Errorf("unauthenticated registration as agent %d", agent.ID), http.StatusForbidden)
+			return
+		}
 
-		for _, agent := range agents {
-			if agent.Name == req.Hostname && agent.IP == ip && agent.Port == req.Port {
-				api.respond(w, r, &response{agent}, http.StatusOK)
+		if agent != nil {
+			labels, ok, err := man.ValidateRegistration(agent, req.Token, req.Labels)
+			if err != nil {
+				api.error(w, r, "Could not validate token.", err, http.StatusInternalServerError)
 				return
 			}
+
+			if !ok {
+				api.error(w, r, "Invalid token.", fmt.Errorf("invalid token"), http.StatusForbidden)
+				return
+			}
+
+			// The agent's config is the source of its labels, so a restarted agent
+			// can move between selectors. Its address and versions may have changed
+			// as well. It drops the next PSK of a rotation in progress when it takes
+			// the PSK it is given, so the server does too.
+			labelsChanged := labels != nil && !reflect.DeepEqual(agent.Labels, labels)
+			moved := agent.MachineID != req.MachineID || agent.Name != req.Hostname || agent.IP != ip || agent.Port != req.Port
+			if moved || labelsChanged || agent.NextPSK != "" || agent.AgentInfo != req.AgentInfo || agent.Tunnel != req.Tunnel || agent.TLS != req.TLS {
+				if labelsChanged {
+					agent.Labels = labels
+				}
+				agent.MachineID = req.MachineID
+				agent.Name = req.Hostname
+				agent.IP = ip
+				agent.Port = req.Port
+				agent.AgentInfo = req.AgentInfo
+				agent.Tunnel = req.Tunnel
+				agent.TLS = req.TLS
+				agent.NextPSK = ""
+				agent, err = api.services.AgentSvc.Update(agent)
+				if err != nil {
+					api.error(w, r, "Could not update agent.", err, http.StatusInternalServerError)
+					return
+				}
+			}
+
+			respond(w, r, agent, req.CSR)
+			return
 		}
 
-		psk, err := generatePSK(64)
+		psk, err := manager.GeneratePSK()
 		if err != nil {
 			api.error(w, r, "Could not generate PSK.", err, http.StatusInternalServerError)
 			return
 		}
 
-		agent := &entity.Agent{
+		agent = &entity.Agent{
+			MachineID: req.MachineID,
+
 			Name: req.Hostname,
 			IP:   ip,
 			Port: req.Port,
 			PSK:  psk,
+
+			PSKRotatedAt: time.Now(),
+
+			Tunnel:    req.Tunnel,
+			TLS:       req.TLS,
+			Labels:    req.Labels,
+			AgentInfo: req.AgentInfo,
 		}
 
-		agent, err = api.services.AgentSvc.Create(agent)
+		agent, ok, err := man.RegisterAgent(agent, req.Token)
 		if err != nil {
 			api.error(w, r, "Could not create agent.", err, http.StatusInternalServerError)
 			return
 		}
 
-		api.respond(w, r, response{agent}, http.StatusOK)
+		if !ok {
+			api.error(w, r, "Invalid token.", fmt.Errorf("invalid token"), http.StatusForbidden)
+			return
+		}
+
+		respond(w, r, agent, req.CSR)
 	}
 }
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
+)
+
+func (api *API) GetRegistrationTokens() http.HandlerFunc {
+	type response struct {
+		Tokens []*entity.RegistrationToken `json:"tokens"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		tokens, err := api.services.TokenSvc.GetAll()
+		if err != nil {
+			api.error(w, r, "Could not get registration tokens.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if tokens == nil {
+			tokens = make([]*entity.RegistrationToken, 0)
+		}
+
+		api.respond(w, r, response{Tokens: tokens}, http.StatusOK)
+	}
+}
+
+// CreateRegistrationToken creates a token for agents to register with. The
+// token itself is always generated, and an expiry can be given as a duration
+// from now instead of a time.
+func (api *API) CreateRegistrationToken() http.HandlerFunc {
+	type request struct {
+		Name      string            `json:"name"`
+		Labels    map[string]string `json:"labels"`
+		OneTime   bool              `json:"one_time"`
+		ExpiresAt time.Time         `json:"expires_at"`
+		ExpiresIn string            `json:"expires_in"`
+	}
+	type response struct {
+		Token *entity.RegistrationToken `json:"token"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		err = manager.ValidateLabels(req.Labels)
+		if err != nil {
+			api.error(w, r, "Invalid labels.", err, http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		expiresAt := req.ExpiresAt
+		if req.ExpiresIn != "" {
+			expiresIn, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || expiresIn <= 0 {
+				api.error(w, r, "Invalid expiry.", fmt.Errorf("invalid expires_in %q", req.ExpiresIn), http.StatusBadRequest)
+				return
+			}
+			expiresAt = now.Add(expiresIn)
+		}
+
+		value, err := manager.GeneratePSK()
+		if err != nil {
+			api.error(w, r, "Could not generate token.", err, http.StatusInternalServerError)
+			return
+		}
+
+		token := &entity.RegistrationToken{
+			Name:      req.Name,
+			Token:     value,
+			Labels:    req.Labels,
+			OneTime:   req.OneTime,
+			ExpiresAt: expiresAt,
+			CreatedAt: now,
+		}
+
+		created, err := api.services.TokenSvc.Create(token)
+		if err != nil {
+			api.error(w, r, "Could not create registration token.", err, http.StatusInternalServerError)
+			return
+		}
+
+		r.Header.Add("Location", fmt.Sprintf("/registration/token/%d", created.ID))
+		api.respond(w, r, response{Token: created}, http.StatusCreated)
+	}
+}
+
+// DeleteRegistrationToken revokes the token. Agents that already registered
+// with it keep their registration, but can't re-register with it.
+func (api *API) DeleteRegistrationToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		tokenID := vars["id"]
+
+		token, err := api.services.TokenSvc.Get([]byte(tokenID))
+		if err != nil {
+			api.error(w, r, "Could not get registration token.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if token == nil {
+			api.error(w, r, "No registration token found with that ID.", fmt.Errorf("no registration token found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		err = api.services.TokenSvc.Delete([]byte(tokenID))
+		if err != nil {
+			api.error(w, r, "Could not delete registration token.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
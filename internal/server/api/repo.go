@@ -19,11 +19,14 @@ func (api *API) GetRepos() http.HandlerFunc {
 			return
 		}
 
-		if repos == nil {
-			repos = make([]*entity.Repo, 0)
+		visible := make([]*entity.Repo, 0, len(repos))
+		for _, repo := range repos {
+			if canRepo(r, repo.ID) {
+				visible = append(visible, redactRepo(r, repo))
+			}
 		}
 
-		api.respond(w, r, &response{Repos: repos}, http.StatusOK)
+		api.respond(w, r, &response{Repos: visible}, http.StatusOK)
 	}
 }
 
@@ -38,6 +41,10 @@ func (api *API) CreateRepo() http.HandlerFunc {
 		Repo *entity.Repo `json:"repo"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		var req request
 		err := api.decode(w, r, &req)
 		if err != nil {
@@ -74,6 +81,10 @@ func (api *API) UpdateRepo() http.HandlerFunc {
 		Repo *entity.Repo `json:"repo"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		repoID := vars["id"]
 
@@ -123,6 +134,10 @@ func (api *API) UpdateRepo() http.HandlerFunc {
 
 func (api *API) DeleteRepo() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		repoID := vars["id"]
 
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
+)
+
+const (
+	defaultScheduleRuns = 5
+	maxScheduleRuns     = 50
+)
+
+type schedulePreview struct {
+	*entity.Schedule
+	Description string      `json:"description"`
+	NextRuns    []time.Time `json:"next_runs"`
+}
+
+// previewSchedule describes the schedule and lists its next n runs.
+func previewSchedule(sch *entity.Schedule, n int) (*schedulePreview, error) {
+	runs, err := manager.NextRuns(sch, time.Now(), n)
+	if err != nil {
+		return nil, err
+	}
+
+	description := manager.DescribeCron(sch.Cron)
+	if sch.TimeZone != "" {
+		description = fmt.Sprintf("%s (%s)", description, sch.TimeZone)
+	}
+
+	return &schedulePreview{
+		Schedule:    sch,
+		Description: description,
+		NextRuns:    runs,
+	}, nil
+}
+
+// scheduleRuns reads how many upcoming runs to return from the n query parameter.
+func scheduleRuns(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("n")
+	if value == "" {
+		return defaultScheduleRuns, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxScheduleRuns {
+		return 0, fmt.Errorf("n must be a number from 1 to %d", maxScheduleRuns)
+	}
+
+	return n, nil
+}
+
+func (api *API) GetBackupSchedule() http.HandlerFunc {
+	type response struct {
+		Schedules []*schedulePreview `json:"schedules"`
+		LastRun   time.Time          `json:"last_run"`
+		LastJob   *entity.Job        `json:"last_job"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		backupID := vars["id"]
+
+		n, err := scheduleRuns(r)
+		if err != nil {
+			api.error(w, r, "Invalid number of runs.", err, http.StatusBadRequest)
+			return
+		}
+
+		backup, err := api.services.BackupSvc.Get([]byte(backupID))
+		if err != nil {
+			api.error(w, r, "Could not get backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if backup == nil {
+			api.error(w, r, "No backup with that ID.", fmt.Errorf("no backup with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if !canBackup(r, backup) {
+			api.forbid(w, r)
+			return
+		}
+
+		schedules := make([]*schedulePreview, 0, len(backup.Schedules))
+		for _, sch := range backup.Schedules {
+			preview, err := previewSchedule(sch, n)
+			if err != nil {
+				api.error(w, r, "Invalid schedule.", err, http.StatusInternalServerError)
+				return
+			}
+			schedules = append(schedules, preview)
+		}
+
+		// TODO: Optimize with filters.
+		jobs, err := api.services.JobSvc.GetAll()
+		if err != nil {
+			api.error(w, r, "Could not get jobs.", err, http.StatusInternalServerError)
+			return
+		}
+
+		var lastJob *entity.Job
+		for _, job := range jobs {
+			if job.Type != "backup" || job.BackupID != backup.ID {
+				continue
+			}
+
+			if lastJob == nil || job.StartTime.After(lastJob.StartTime) {
+				lastJob = job
+			}
+		}
+
+		api.respond(w, r, response{Schedules: schedules, LastRun: backup.LastRun, LastJob: lastJob}, http.StatusOK)
+	}
+}
+
+func (api *API) ValidateSchedule() http.HandlerFunc {
+	type request struct {
+		Cron     string `json:"cron"`
+		TimeZone string `json:"time_zone"`
+		N        int    `json:"n"`
+	}
+	type response struct {
+		Description string      `json:"description"`
+		NextRuns    []time.Time `json:"next_runs"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		if req.N == 0 {
+			req.N = defaultScheduleRuns
+		}
+
+		if req.N < 1 || req.N > maxScheduleRuns {
+			api.error(w, r, "Invalid number of runs.", fmt.Errorf("n must be a number from 1 to %d", maxScheduleRuns), http.StatusBadRequest)
+			return
+		}
+
+		preview, err := previewSchedule(&entity.Schedule{Cron: req.Cron, TimeZone: req.TimeZone}, req.N)
+		if err != nil {
+			api.error(w, r, "Invalid schedule.", err, http.StatusBadRequest)
+			return
+		}
+
+		api.respond(w, r, response{Description: preview.Description, NextRuns: preview.NextRuns}, http.StatusOK)
+	}
+}
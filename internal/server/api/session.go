@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
+)
+
+type contextKey string
+
+const userKey contextKey = "user"
+
+// requestUser returns the user the request was made by, set by RequireSession.
+func requestUser(r *http.Request) *entity.User {
+	user, _ := r.Context().Value(userKey).(*entity.User)
+	return user
+}
+
+// RequireSession only lets requests from logged in users through.
+func (api *API) RequireSession(man *manager.Manager) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := man.RequestUser(r)
+			if err != nil {
+				api.error(w, r, "Could not get session.", err, http.StatusInternalServerError)
+				return
+			}
+
+			if user == nil {
+				api.error(w, r, "Not logged in.", fmt.Errorf("not logged in"), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+		})
+	}
+}
+
+func (api *API) Login(man *manager.Manager) http.HandlerFunc {
+	type request struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	type response struct {
+		User *entity.User `json:"user"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		ip, err := man.ClientIP(r)
+		if err != nil {
+			api.error(w, r, "Could not get client address.", err, http.StatusInternalServerError)
+			return
+		}
+
+		user, token, err := man.Login(req.Username, req.Password, ip)
+		if errors.Is(err, manager.ErrLoginThrottled) {
+			api.error(w, r, "Too many failed logins, try again later.", err, http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			api.error(w, r, "Could not log in.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if user == nil {
+			api.error(w, r, "Wrong username or password.", fmt.Errorf("wrong username or password"), http.StatusUnauthorized)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     manager.SessionCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   api.secureCookies || r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+
+		api.respond(w, r, response{User: user}, http.StatusOK)
+	}
+}
+
+func (api *API) Logout(man *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(manager.SessionCookie)
+		if err == nil {
+			man.Logout(cookie.Value)
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     manager.SessionCookie,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   api.secureCookies || r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
+
+// GetSession returns the user who is logged in.
+func (api *API) GetSession() http.HandlerFunc {
+	type response struct {
+		User *entity.User `json:"user"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		api.respond(w, r, response{User: requestUser(r)}, http.StatusOK)
+	}
+}
@@ -13,6 +13,10 @@ func (api *API) GetSettings() http.HandlerFunc {
 		Settings []*entity.Setting `json:"settings"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		settings, err := api.services.SettingSvc.GetAll()
 		if err != nil {
 			api.error(w, r, "Could not get settings.", err, http.StatusInternalServerError)
@@ -32,6 +36,10 @@ func (api *API) GetSetting() http.HandlerFunc {
 		*entity.Setting
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		settingKey := vars["id"]
 
@@ -58,6 +66,10 @@ func (api *API) CreateSetting() http.HandlerFunc {
 		*entity.Setting
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		var req request
 		err := api.decode(w, r, &req)
 		if err != nil {
@@ -76,7 +88,7 @@ func (api *API) CreateSetting() http.HandlerFunc {
 			return
 		}
 
-		r.Header.Add("Location", fmt.Sprintf("/setting/%d", setting.Key))
+		r.Header.Add("Location", fmt.Sprintf("/setting/%s", setting.Key))
 		api.respond(w, r, response{setting}, http.StatusCreated)
 	}
 }
@@ -89,6 +101,10 @@ func (api *API) UpdateSetting() http.HandlerFunc {
 		*entity.Setting
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		settingKey := vars["id"]
 
@@ -135,6 +151,10 @@ func (api *API) UpdateSetting() http.HandlerFunc {
 
 func (api *API) DeleteSetting() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		settingKey := vars["id"]
 
@@ -3,6 +3,8 @@ package api
 import (
 	"fmt"
 	"net/http"
+
+	"zerosrealm.xyz/tergum/internal/entity"
 )
 
 func (api *API) SettingsLoggingGet() http.HandlerFunc {
@@ -10,6 +12,10 @@ func (api *API) SettingsLoggingGet() http.HandlerFunc {
 		Level string `json:"level"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		resp := response{
 			Level: api.log.GetLevel(),
 		}
@@ -26,6 +32,10 @@ func (api *API) SettingsLoggingSet() http.HandlerFunc {
 		Level string `json:"level"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
 		var req request
 		err := api.decode(w, r, &req)
 		if err != nil {
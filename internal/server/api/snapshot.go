@@ -33,6 +33,11 @@ func (api *API) GetSnapshots(man *manager.Manager, resticExe *restic.Restic) htt
 			return
 		}
 
+		if !canRepo(r, repo.ID) {
+			api.forbid(w, r)
+			return
+		}
+
 		log := api.log.WithFields("method", r.Method, "path", r.URL.Path, "src", r.RemoteAddr)
 
 		if resticExe != nil {
@@ -91,6 +96,10 @@ func (api *API) GetSnapshots(man *manager.Manager, resticExe *restic.Restic) htt
 
 func (api *API) DeleteSnapshot(man *manager.Manager, resticExe *restic.Restic) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		repoID := vars["id"]
 		snapshot := vars["snapshot"]
@@ -106,6 +115,11 @@ func (api *API) DeleteSnapshot(man *manager.Manager, resticExe *restic.Restic) h
 			return
 		}
 
+		if !canRepo(r, repo.ID) {
+			api.forbid(w, r)
+			return
+		}
+
 		log := api.log.WithFields("method", r.Method, "path", r.URL.Path, "src", r.RemoteAddr)
 
 		if resticExe != nil {
@@ -168,6 +182,10 @@ func (api *API) RestoreSnapshot(manager *manager.Manager) http.HandlerFunc {
 		Job *entity.Job `json:"job"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleOperator) {
+			return
+		}
+
 		vars := mux.Vars(r)
 		repoID := vars["id"]
 		snapshot := vars["snapshot"]
@@ -190,12 +208,28 @@ func (api *API) RestoreSnapshot(manager *manager.Manager) http.HandlerFunc {
 			return
 		}
 
+		if !canRepo(r, repo.ID) {
+			api.forbid(w, r)
+			return
+		}
+
 		agent, err := api.services.AgentSvc.Get([]byte(strconv.Itoa(req.Agent)))
 		if err != nil {
 			api.error(w, r, "Could not get agent.", err, http.StatusInternalServerError)
 			return
 		}
 
+		if agent == nil {
+			api.error(w, r, "No agent found with that ID.", fmt.Errorf("no agent with that ID"), http.StatusNotFound)
+			return
+		}
+
+		// Operators only restore to agents they own.
+		if !canAgent(r, agent) {
+			api.forbid(w, r)
+			return
+		}
+
 		restoreReq := &agentRequest.Restore{
 			Repo:     repo,
 			Snapshot: snapshot,
@@ -216,7 +250,7 @@ func (api *API) RestoreSnapshot(manager *manager.Manager) http.HandlerFunc {
 			api.error(w, r, "Could not create job.", err, http.StatusInternalServerError)
 			return
 		}
-		api.log.Debug("Enqueuing job %s for %s", job.ID, agent.Name)
+		api.log.Debug("Enqueuing job", job.ID, "for", agent.Name)
 
 		api.respond(w, r, response{Job: job}, http.StatusOK)
 	}
@@ -297,6 +331,11 @@ func (api *API) ListSnapshot(man *manager.Manager, resticExe *restic.Restic) htt
 			return
 		}
 
+		if !canRepo(r, repo.ID) {
+			api.forbid(w, r)
+			return
+		}
+
 		log := api.log.WithFields("method", r.Method, "path", r.URL.Path, "src", r.RemoteAddr)
 
 		if resticExe != nil {
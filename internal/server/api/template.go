@@ -0,0 +1,281 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
+)
+
+func (api *API) validateTemplate(tmpl *entity.Template) (int, error) {
+	if tmpl.Name == "" {
+		return http.StatusBadRequest, fmt.Errorf("a template must have a name")
+	}
+
+	if tmpl.Source == "" {
+		return http.StatusBadRequest, fmt.Errorf("a template must have a source")
+	}
+
+	err := manager.ParseTemplate(tmpl)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	schedules, err := validateSchedules(tmpl.Schedules, "")
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	tmpl.Schedules = schedules
+
+	if tmpl.Exclude == nil {
+		tmpl.Exclude = []string{}
+	}
+
+	_, err = manager.ParseSelector(tmpl.Selector)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	repo, err := api.services.RepoSvc.Get([]byte(strconv.Itoa(tmpl.Target)))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if repo == nil {
+		return http.StatusBadRequest, fmt.Errorf("no repo with the ID '%d'", tmpl.Target)
+	}
+
+	return http.StatusOK, nil
+}
+
+func (api *API) GetTemplates() http.HandlerFunc {
+	type response struct {
+		Templates []*entity.Template `json:"templates"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		templates, err := api.services.TemplateSvc.GetAll()
+		if err != nil {
+			api.error(w, r, "Could not get templates.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if templates == nil {
+			templates = make([]*entity.Template, 0)
+		}
+
+		api.respond(w, r, response{Templates: templates}, http.StatusOK)
+	}
+}
+
+func (api *API) CreateTemplate() http.HandlerFunc {
+	type request struct {
+		entity.Template
+	}
+	type response struct {
+		Template *entity.Template `json:"template"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		tmpl := req.Template
+		tmpl.ID = 0
+
+		status, err := api.validateTemplate(&tmpl)
+		if err != nil {
+			api.error(w, r, "Invalid template.", err, status)
+			return
+		}
+
+		created, err := api.services.TemplateSvc.Create(&tmpl)
+		if err != nil {
+			api.error(w, r, "Could not create template.", err, http.StatusInternalServerError)
+			return
+		}
+
+		r.Header.Add("Location", fmt.Sprintf("/template/%d", created.ID))
+		api.respond(w, r, response{Template: created}, http.StatusCreated)
+	}
+}
+
+func (api *API) GetTemplate() http.HandlerFunc {
+	type response struct {
+		Template *entity.Template `json:"template"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		templateID := vars["id"]
+
+		tmpl, err := api.services.TemplateSvc.Get([]byte(templateID))
+		if err != nil {
+			api.error(w, r, "Could not get template.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if tmpl == nil {
+			api.error(w, r, "No template found with that ID.", fmt.Errorf("no template found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		api.respond(w, r, response{Template: tmpl}, http.StatusOK)
+	}
+}
+
+func (api *API) UpdateTemplate(man *manager.Manager) http.HandlerFunc {
+	type request struct {
+		entity.Template
+	}
+	type response struct {
+		Template *entity.Template `json:"template"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		templateID := vars["id"]
+
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		tmpl, err := api.services.TemplateSvc.Get([]byte(templateID))
+		if err != nil {
+			api.error(w, r, "Could not get template.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if tmpl == nil {
+			api.error(w, r, "No template found with that ID.", fmt.Errorf("no template found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		updated := req.Template
+		updated.ID = tmpl.ID
+
+		status, err := api.validateTemplate(&updated)
+		if err != nil {
+			api.error(w, r, "Invalid template.", err, status)
+			return
+		}
+
+		tmpl, err = api.services.TemplateSvc.Update(&updated)
+		if err != nil {
+			api.error(w, r, "Could not update template.", err, http.StatusInternalServerError)
+			return
+		}
+
+		err = man.SyncTemplate(tmpl)
+		if err != nil {
+			api.error(w, r, "Could not update backups from template.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, response{Template: tmpl}, http.StatusOK)
+	}
+}
+
+func (api *API) DeleteTemplate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		templateID := vars["id"]
+
+		tmpl, err := api.services.TemplateSvc.Get([]byte(templateID))
+		if err != nil {
+			api.error(w, r, "Could not get template.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if tmpl == nil {
+			api.error(w, r, "No template found with that ID.", fmt.Errorf("no template found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		// Backups keep the unrendered template in their source, so they can't
+		// outlive it.
+		backups, err := api.services.BackupSvc.GetAll()
+		if err != nil {
+			api.error(w, r, "Could not get backups.", err, http.StatusInternalServerError)
+			return
+		}
+
+		for _, backup := range backups {
+			if backup.TemplateID == tmpl.ID {
+				api.error(w, r, "Template is still used by backups.", fmt.Errorf("template is used by backup %d", backup.ID), http.StatusConflict)
+				return
+			}
+		}
+
+		err = api.services.TemplateSvc.Delete([]byte(templateID))
+		if err != nil {
+			api.error(w, r, "Could not delete template.", err, http.StatusInternalServerError)
+			return
+		}
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
+
+func (api *API) CreateTemplateBackup(man *manager.Manager) http.HandlerFunc {
+	type response struct {
+		Backup *entity.Backup `json:"backup"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		templateID := vars["id"]
+
+		tmpl, err := api.services.TemplateSvc.Get([]byte(templateID))
+		if err != nil {
+			api.error(w, r, "Could not get template.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if tmpl == nil {
+			api.error(w, r, "No template found with that ID.", fmt.Errorf("no template found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		backup := &entity.Backup{
+			Enabled: true,
+		}
+		manager.ApplyTemplate(backup, tmpl)
+
+		backup, err = api.services.BackupSvc.Create(backup)
+		if err != nil {
+			api.error(w, r, "Could not create backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		err = man.Scheduler().Set(backup)
+		if err != nil {
+			api.error(w, r, "Could not schedule backup.", err, http.StatusInternalServerError)
+			return
+		}
+
+		r.Header.Add("Location", fmt.Sprintf("/backup/%d", backup.ID))
+		api.respond(w, r, response{Backup: backup}, http.StatusCreated)
+	}
+}
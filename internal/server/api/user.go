@@ -0,0 +1,339 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"zerosrealm.xyz/tergum/internal/entity"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
+)
+
+// validateUser checks the user's role and scope. Scope lists are never nil.
+// Admins manage users and settings, which no scope limits, so they can't have
+// one.
+func validateUser(user *entity.User) error {
+	if !validRole(user.Role) {
+		return fmt.Errorf("invalid role %q", user.Role)
+	}
+
+	if user.Scope == nil {
+		return nil
+	}
+
+	if user.Role == entity.RoleAdmin {
+		return fmt.Errorf("admins can't have a scope")
+	}
+
+	if user.Scope.Repos == nil {
+		user.Scope.Repos = make([]int, 0)
+	}
+
+	if user.Scope.Backups == nil {
+		user.Scope.Backups = make([]int, 0)
+	}
+
+	_, err := manager.ParseSelector(user.Scope.Agents)
+	return err
+}
+
+// otherAdmins reports whether there are admins other than the user, so the
+// user may stop being one.
+func (api *API) otherAdmins(user *entity.User) (bool, error) {
+	users, err := api.services.UserSvc.GetAll()
+	if err != nil {
+		return false, err
+	}
+
+	for _, u := range users {
+		if u.ID != user.ID && u.Role == entity.RoleAdmin {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (api *API) GetUsers() http.HandlerFunc {
+	type response struct {
+		Users []*entity.User `json:"users"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		users, err := api.services.UserSvc.GetAll()
+		if err != nil {
+			api.error(w, r, "Could not get users.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if users == nil {
+			users = make([]*entity.User, 0)
+		}
+
+		api.respond(w, r, response{Users: users}, http.StatusOK)
+	}
+}
+
+func (api *API) CreateUser() http.HandlerFunc {
+	type request struct {
+		Username string            `json:"username"`
+		Password string            `json:"password"`
+		Role     string            `json:"role"`
+		Scope    *entity.UserScope `json:"scope"`
+	}
+	type response struct {
+		User *entity.User `json:"user"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		req.Username = strings.TrimSpace(req.Username)
+		if req.Username == "" || req.Password == "" {
+			api.error(w, r, "Username and password are required.", fmt.Errorf("username and password are required"), http.StatusBadRequest)
+			return
+		}
+
+		if req.Role == "" {
+			req.Role = entity.RoleViewer
+		}
+
+		user := &entity.User{
+			Username:  req.Username,
+			CreatedAt: time.Now(),
+			Role:      req.Role,
+			Scope:     req.Scope,
+		}
+
+		err = validateUser(user)
+		if err != nil {
+			api.error(w, r, "Invalid user.", err, http.StatusBadRequest)
+			return
+		}
+
+		existing, err := api.services.UserSvc.GetByUsername(req.Username)
+		if err != nil {
+			api.error(w, r, "Could not get user.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if existing != nil {
+			api.error(w, r, "Username is taken.", fmt.Errorf("username %q is taken", req.Username), http.StatusConflict)
+			return
+		}
+
+		hash, err := manager.HashPassword(req.Password)
+		if err != nil {
+			api.error(w, r, "Could not hash password.", err, http.StatusInternalServerError)
+			return
+		}
+
+		user.Password = hash
+		created, err := api.services.UserSvc.Create(user)
+		if err != nil {
+			api.error(w, r, "Could not create user.", err, http.StatusInternalServerError)
+			return
+		}
+
+		r.Header.Add("Location", fmt.Sprintf("/user/%d", created.ID))
+		api.respond(w, r, response{User: created}, http.StatusCreated)
+	}
+}
+
+// UpdateUser changes the user's password, role or scope, leaving out what isn't
+// given. Users who aren't admins may only change their own password, and must
+// give their current one. A new password ends the user's other sessions, the
+// session the change was made from stays. The last admin can't stop being one.
+func (api *API) UpdateUser(man *manager.Manager) http.HandlerFunc {
+	type request struct {
+		Password        string          `json:"password"`
+		CurrentPassword string          `json:"current_password"`
+		Role            string          `json:"role"`
+		Scope           json.RawMessage `json:"scope"`
+	}
+	type response struct {
+		User *entity.User `json:"user"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID := vars["id"]
+
+		var req request
+		err := api.decode(w, r, &req)
+		if err != nil {
+			api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+			return
+		}
+
+		if req.Password == "" && req.Role == "" && req.Scope == nil {
+			api.error(w, r, "Nothing to update.", fmt.Errorf("no password, role or scope given"), http.StatusBadRequest)
+			return
+		}
+
+		self := requestUser(r)
+		if !hasRole(self, entity.RoleAdmin) && (strconv.Itoa(self.ID) != userID || req.Role != "" || req.Scope != nil) {
+			api.error(w, r, "Not allowed.", fmt.Errorf("requires role %s", entity.RoleAdmin), http.StatusForbidden)
+			return
+		}
+
+		user, err := api.services.UserSvc.Get([]byte(userID))
+		if err != nil {
+			api.error(w, r, "Could not get user.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if user == nil {
+			api.error(w, r, "No user found with that ID.", fmt.Errorf("no user found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		// The session alone isn't enough to take over the account for good.
+		if !hasRole(self, entity.RoleAdmin) && req.Password != "" {
+			ip, err := man.ClientIP(r)
+			if err != nil {
+				api.error(w, r, "Could not get client address.", err, http.StatusInternalServerError)
+				return
+			}
+
+			ok, err := man.CheckPassword(user, req.CurrentPassword, ip)
+			if errors.Is(err, manager.ErrLoginThrottled) {
+				api.error(w, r, "Too many wrong passwords, try again later.", err, http.StatusTooManyRequests)
+				return
+			}
+			if err != nil {
+				api.error(w, r, "Could not check password.", err, http.StatusInternalServerError)
+				return
+			}
+
+			if !ok {
+				api.error(w, r, "Wrong current password.", fmt.Errorf("wrong current password"), http.StatusForbidden)
+				return
+			}
+		}
+
+		updated := *user
+		if req.Role != "" {
+			updated.Role = req.Role
+		}
+
+		// A user made admin loses their scope, unless it is given anyway.
+		if req.Role == entity.RoleAdmin && req.Scope == nil {
+			updated.Scope = nil
+		}
+
+		if req.Scope != nil {
+			updated.Scope = nil
+			err = json.Unmarshal(req.Scope, &updated.Scope)
+			if err != nil {
+				api.error(w, r, msgDecodeError, err, http.StatusBadRequest)
+				return
+			}
+		}
+
+		err = validateUser(&updated)
+		if err != nil {
+			api.error(w, r, "Invalid user.", err, http.StatusBadRequest)
+			return
+		}
+
+		if user.Role == entity.RoleAdmin && updated.Role != entity.RoleAdmin {
+			ok, err := api.otherAdmins(user)
+			if err != nil {
+				api.error(w, r, "Could not get users.", err, http.StatusInternalServerError)
+				return
+			}
+
+			if !ok {
+				api.error(w, r, "Can't demote the last admin.", fmt.Errorf("can't demote the last admin"), http.StatusConflict)
+				return
+			}
+		}
+
+		if req.Password != "" {
+			updated.Password, err = manager.HashPassword(req.Password)
+			if err != nil {
+				api.error(w, r, "Invalid password.", err, http.StatusBadRequest)
+				return
+			}
+		}
+
+		user, err = api.services.UserSvc.Update(&updated)
+		if err != nil {
+			api.error(w, r, "Could not update user.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if req.Password != "" {
+			keep := ""
+			if cookie, err := r.Cookie(manager.SessionCookie); err == nil {
+				keep = cookie.Value
+			}
+			man.EndSessions(user.ID, keep)
+		}
+
+		api.respond(w, r, response{User: user}, http.StatusOK)
+	}
+}
+
+// DeleteUser deletes the user and ends their sessions. The last admin can't be
+// deleted, as no one could manage users after.
+func (api *API) DeleteUser(man *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.allow(w, r, entity.RoleAdmin) {
+			return
+		}
+
+		vars := mux.Vars(r)
+		userID := vars["id"]
+
+		user, err := api.services.UserSvc.Get([]byte(userID))
+		if err != nil {
+			api.error(w, r, "Could not get user.", err, http.StatusInternalServerError)
+			return
+		}
+
+		if user == nil {
+			api.error(w, r, "No user found with that ID.", fmt.Errorf("no user found with that ID"), http.StatusNotFound)
+			return
+		}
+
+		if user.Role == entity.RoleAdmin {
+			ok, err := api.otherAdmins(user)
+			if err != nil {
+				api.error(w, r, "Could not get users.", err, http.StatusInternalServerError)
+				return
+			}
+
+			if !ok {
+				api.error(w, r, "Can't delete the last admin.", fmt.Errorf("can't delete the last admin"), http.StatusConflict)
+				return
+			}
+		}
+
+		err = api.services.UserSvc.Delete([]byte(userID))
+		if err != nil {
+			api.error(w, r, "Could not delete user.", err, http.StatusInternalServerError)
+			return
+		}
+
+		man.EndSessions(user.ID, "")
+
+		api.respond(w, r, nil, http.StatusNoContent)
+	}
+}
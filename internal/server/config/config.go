@@ -24,6 +24,31 @@ type Config struct {
 	Cache    string
 	Database dbConfig
 	Log      log.Config
+
+	// CA is the directory of the CA issuing the agents their certificates.
+	CA string `default:"ca"`
+
+	// TLS serves the API over HTTPS when Cert and Key are set. CA is a PEM file
+	// of the certificates that agents serving HTTPS without a certificate from
+	// the server's CA are verified against, instead of the system's.
+	TLS struct {
+		Cert string
+		Key  string
+		CA   string
+	}
+
+	// SecureCookies marks the session cookie secure even when the API is served
+	// over plain HTTP, as behind a proxy that terminates TLS.
+	SecureCookies bool
+
+	// Admin is the user created on first start, when there are no users yet. If
+	// no password is set one is generated and written to PasswordFile, or to
+	// stdout without one.
+	Admin struct {
+		Username     string `default:"admin"`
+		Password     string
+		PasswordFile string
+	}
 }
 
 // Load config.
@@ -36,6 +61,14 @@ func Load() (*Config, error) {
 	ip := os.Getenv("TERGUM_IP")
 	port := os.Getenv("TERGUM_PORT")
 	restic := os.Getenv("TERGUM_RESTIC")
+	tlsCert := os.Getenv("TERGUM_TLS_CERT")
+	tlsKey := os.Getenv("TERGUM_TLS_KEY")
+	tlsCA := os.Getenv("TERGUM_TLS_CA")
+	caDir := os.Getenv("TERGUM_CA")
+	adminUsername := os.Getenv("TERGUM_ADMIN_USERNAME")
+	adminPassword := os.Getenv("TERGUM_ADMIN_PASSWORD")
+	adminPasswordFile := os.Getenv("TERGUM_ADMIN_PASSWORD_FILE")
+	secureCookies := os.Getenv("TERGUM_SECURE_COOKIES")
 
 	if ip != "" {
 		conf.Listen.IP = ip
@@ -50,6 +83,47 @@ func Load() (*Config, error) {
 	if restic != "" {
 		conf.Restic = restic
 	}
+	if tlsCert != "" {
+		conf.TLS.Cert = tlsCert
+	}
+	if tlsKey != "" {
+		conf.TLS.Key = tlsKey
+	}
+	if tlsCA != "" {
+		conf.TLS.CA = tlsCA
+	}
+
+	if caDir != "" {
+		conf.CA = caDir
+	}
+	if conf.CA == "" {
+		conf.CA = "ca"
+	}
+
+	if adminUsername != "" {
+		conf.Admin.Username = adminUsername
+	}
+	if adminPassword != "" {
+		conf.Admin.Password = adminPassword
+	}
+	if adminPasswordFile != "" {
+		conf.Admin.PasswordFile = adminPasswordFile
+	}
+	if conf.Admin.Username == "" {
+		conf.Admin.Username = "admin"
+	}
+
+	if secureCookies != "" {
+		secure, err := strconv.ParseBool(secureCookies)
+		if err != nil {
+			return nil, fmt.Errorf("TERGUM_SECURE_COOKIES is not a boolean")
+		}
+		conf.SecureCookies = secure
+	}
+
+	if (conf.TLS.Cert == "") != (conf.TLS.Key == "") {
+		return nil, fmt.Errorf("TLS cert and key must be set together")
+	}
 
 	return &conf, nil
 }
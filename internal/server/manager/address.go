@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies returns the networks of the proxies whose X-Forwarded-For
+// header is trusted, from the trusted-proxies setting. Entries are IP addresses
+// or CIDR ranges.
+func (man *Manager) trustedProxies() ([]*net.IPNet, error) {
+	var entries []string
+	_, err := man.getSetting("trusted-proxies", &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("manager.trustedProxies: invalid address %q", entry)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("manager.trustedProxies: invalid network %q", entry)
+		}
+
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+// trusted reports whether the address is one of the proxies.
+func trusted(proxies []*net.IPNet, addr string) bool {
+	parsed := net.ParseIP(addr)
+	if parsed == nil {
+		return false
+	}
+
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the address of the other end of the request's connection.
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
+// FromTrustedProxy reports whether the request came through a trusted proxy.
+func (man *Manager) FromTrustedProxy(r *http.Request) (bool, error) {
+	proxies, err := man.trustedProxies()
+	if err != nil {
+		return false, err
+	}
+
+	return trusted(proxies, remoteIP(r)), nil
+}
+
+// ClientIP returns the address the request came from. Behind trusted proxies
+// that is the last address in X-Forwarded-For that isn't one of them, as any
+// before it could have been set by the client.
+func (man *Manager) ClientIP(r *http.Request) (string, error) {
+	ip := remoteIP(r)
+
+	proxies, err := man.trustedProxies()
+	if err != nil {
+		return "", err
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0 && trusted(proxies, ip); i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(addr) == nil {
+			break
+		}
+		ip = addr
+	}
+
+	return ip, nil
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// defaultOfflineAfter is used when the agent-offline-after setting is missing.
+const defaultOfflineAfter = 90 * time.Second
+
+// AgentStatus returns the status of the agent at t. An agent is offline once it
+// has not sent a heartbeat for longer than offlineAfter.
+func AgentStatus(agent *entity.Agent, t time.Time, offlineAfter time.Duration) string {
+	if agent.LastSeen.IsZero() {
+		return entity.AgentUnknown
+	}
+
+	if t.Sub(agent.LastSeen) > offlineAfter {
+		return entity.AgentOffline
+	}
+
+	return entity.AgentOnline
+}
+
+// offlineAfter returns how long an agent may go without a heartbeat before it is
+// considered offline, from the agent-offline-after setting.
+func (man *Manager) offlineAfter() (time.Duration, error) {
+	value := ""
+	ok, err := man.getSetting("agent-offline-after", &value)
+	if err != nil {
+		return 0, err
+	}
+
+	if !ok || value == "" {
+		return defaultOfflineAfter, nil
+	}
+
+	after, err := time.ParseDuration(value)
+	if err != nil || after <= 0 {
+		return 0, fmt.Errorf("manager.offlineAfter: invalid agent-offline-after %q", value)
+	}
+
+	return after, nil
+}
+
+// skipOffline reports whether scheduled runs skip offline agents, as set by the
+// offline-agents setting. Otherwise they are only flagged in the log and their
+// jobs are sent regardless.
+func (man *Manager) skipOffline() (bool, error) {
+	policy := "flag"
+	_, err := man.getSetting("offline-agents", &policy)
+	if err != nil {
+		return false, err
+	}
+
+	switch policy {
+	case "skip":
+		return true, nil
+	case "flag", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("manager.skipOffline: invalid offline-agents policy %q", policy)
+	}
+}
+
+// SetAgentStatus sets the status of each agent from its last heartbeat.
+func (man *Manager) SetAgentStatus(agents ...*entity.Agent) error {
+	after, err := man.offlineAfter()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, agent := range agents {
+		agent.Status = AgentStatus(agent, now, after)
+	}
+
+	return nil
+}
+
+// Heartbeat records a heartbeat from the agent.
+func (man *Manager) Heartbeat(agent *entity.Agent, heartbeat *entity.Heartbeat) (*entity.Agent, error) {
+	// Only the heartbeat's own columns are written, so changes made to the agent
+	// since it was read, such as a PSK rotation or new labels, aren't undone.
+	updated := *agent
+	updated.LastSeen = time.Now()
+	updated.AgentInfo = heartbeat.AgentInfo
+	updated.Uptime = heartbeat.Uptime
+	updated.RunningJobs = heartbeat.RunningJobs
+	updated.FreeDisk = heartbeat.FreeDisk
+	updated.Status = entity.AgentOnline
+
+	agent, err := man.services.AgentSvc.UpdateHeartbeat(&updated)
+	if err != nil {
+		return nil, fmt.Errorf("manager.Heartbeat: could not update agent: %w", err)
+	}
+
+	return agent, nil
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// maxBlackoutSteps bounds how many windows and cron runs are walked through when
+// looking for a time outside every blackout.
+const maxBlackoutSteps = 1000
+
+// ParseBlackout validates the blackout window.
+func ParseBlackout(blackout *entity.Blackout) error {
+	switch blackout.Action {
+	case "defer", "skip":
+	default:
+		return fmt.Errorf("invalid action %q, must be defer or skip", blackout.Action)
+	}
+
+	if blackout.AgentID != 0 && blackout.RepoID != 0 {
+		return fmt.Errorf("a blackout can be linked to either an agent or a repo, not both")
+	}
+
+	if blackout.Cron == "" {
+		if blackout.Start.IsZero() || !blackout.End.After(blackout.Start) {
+			return fmt.Errorf("a blackout needs either a cron and duration, or a start before its end")
+		}
+		return nil
+	}
+
+	if !blackout.Start.IsZero() || !blackout.End.IsZero() {
+		return fmt.Errorf("a recurring blackout can not have a start or end")
+	}
+
+	_, _, err := blackoutSchedule(blackout)
+	return err
+}
+
+func blackoutSchedule(blackout *entity.Blackout) (cron.Schedule, time.Duration, error) {
+	spec, err := ParseSchedule(&entity.Schedule{Cron: blackout.Cron, TimeZone: blackout.TimeZone})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	duration, err := time.ParseDuration(blackout.Duration)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid duration %q: %w", blackout.Duration, err)
+	}
+
+	if duration <= 0 {
+		return nil, 0, fmt.Errorf("invalid duration %q: must be positive", blackout.Duration)
+	}
+
+	return schedule, duration, nil
+}
+
+// blackoutEnd returns when the window closes if it is open at t.
+func blackoutEnd(blackout *entity.Blackout, t time.Time) (time.Time, bool) {
+	if blackout.Cron == "" {
+		if !t.Before(blackout.Start) && t.Before(blackout.End) {
+			return blackout.End, true
+		}
+		return time.Time{}, false
+	}
+
+	schedule, duration, err := blackoutSchedule(blackout)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// Any occurrence that opened less than a duration ago still covers t.
+	var end time.Time
+	start := schedule.Next(t.Add(-duration))
+	for i := 0; i < maxBlackoutSteps && !start.IsZero() && !start.After(t); i++ {
+		if closes := start.Add(duration); closes.After(end) {
+			end = closes
+		}
+		start = schedule.Next(start)
+	}
+
+	if !end.After(t) {
+		return time.Time{}, false
+	}
+
+	return end, true
+}
+
+// deferBlackouts returns when a run due at t may start given the windows. It
+// returns false if a window with the skip action drops the run.
+func deferBlackouts(blackouts []*entity.Blackout, t time.Time) (time.Time, bool) {
+	for i := 0; i < maxBlackoutSteps; i++ {
+		moved := false
+		for _, blackout := range blackouts {
+			end, ok := blackoutEnd(blackout, t)
+			if !ok {
+				continue
+			}
+
+			if blackout.Action == "skip" {
+				return time.Time{}, false
+			}
+
+			t = end
+			moved = true
+		}
+
+		if !moved {
+			break
+		}
+	}
+
+	return t, true
+}
+
+// blackoutOpens returns when the window next opens after t.
+func blackoutOpens(blackout *entity.Blackout, t time.Time) (time.Time, bool) {
+	if blackout.Cron == "" {
+		return blackout.Start, blackout.Start.After(t)
+	}
+
+	schedule, _, err := blackoutSchedule(blackout)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	opens := schedule.Next(t)
+	return opens, !opens.IsZero()
+}
+
+// clampJitter shortens the jitter of a run starting at t so it can't be delayed
+// into a window that opens after it.
+func clampJitter(blackouts []*entity.Blackout, t time.Time, jitter time.Duration) time.Duration {
+	for _, blackout := range blackouts {
+		opens, ok := blackoutOpens(blackout, t)
+		if ok && opens.Sub(t) < jitter {
+			jitter = opens.Sub(t)
+		}
+	}
+
+	return jitter
+}
+
+// getBlackouts returns the windows that apply to backups into the repo. Agent
+// windows are only included for the given agent, an agent ID of 0 leaves them out.
+func (man *Manager) getBlackouts(agentID, repoID int) ([]*entity.Blackout, error) {
+	// TODO: Optimize with filters.
+	all, err := man.services.BlackoutSvc.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("manager.getBlackouts: could not get blackouts: %w", err)
+	}
+
+	return filterBlackouts(all, agentID, repoID), nil
+}
+
+func filterBlackouts(all []*entity.Blackout, agentID, repoID int) []*entity.Blackout {
+	blackouts := make([]*entity.Blackout, 0)
+	for _, blackout := range all {
+		switch {
+		case blackout.AgentID != 0:
+			if agentID == 0 || blackout.AgentID != agentID {
+				continue
+			}
+		case blackout.RepoID != 0:
+			if blackout.RepoID != repoID {
+				continue
+			}
+		}
+		blackouts = append(blackouts, blackout)
+	}
+
+	return blackouts
+}
+
+// NextRun returns when the backup will next run on its schedules, taking pauses
+// and global and repository blackouts into account. Agent blackouts and pauses
+// may delay the run on single agents further. It returns nil if no run could be
+// found or the backup is paused indefinitely.
+func (man *Manager) NextRun(backup *entity.Backup, now time.Time) (*time.Time, error) {
+	paused, err := man.SchedulesPaused()
+	if err != nil {
+		return nil, err
+	}
+
+	if paused || !backup.Enabled {
+		return nil, nil
+	}
+
+	if now.Before(backup.PausedUntil) {
+		now = backup.PausedUntil
+	}
+
+	blackouts, err := man.getBlackouts(0, backup.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	var next *time.Time
+	for _, sch := range backup.Schedules {
+		spec, err := ParseSchedule(sch)
+		if err != nil {
+			continue
+		}
+
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			continue
+		}
+
+		due := schedule.Next(now)
+		for i := 0; i < maxBlackoutSteps && !due.IsZero(); i++ {
+			start, ok := deferBlackouts(blackouts, due)
+			if ok {
+				if next == nil || start.Before(*next) {
+					next = &start
+				}
+				break
+			}
+			due = schedule.Next(due)
+		}
+	}
+
+	return next, nil
+}
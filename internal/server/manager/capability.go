@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/restic"
+)
+
+// optionVersions maps backup options to the restic version that introduced them.
+var optionVersions = map[string]string{
+	"--compression":       "0.14.0",
+	"--pack-size":         "0.14.0",
+	"--read-concurrency":  "0.14.0",
+	"--no-scan":           "0.15.0",
+	"--skip-if-unchanged": "0.17.0",
+}
+
+// UnsupportedOptions returns the options that the given restic version does not
+// support. Nothing is known about agents that have not reported a version we
+// can parse, so all options are assumed to be supported.
+func UnsupportedOptions(options []string, resticVersion string) ([]string, error) {
+	if _, err := restic.ParseVersion(resticVersion); err != nil {
+		return nil, nil
+	}
+
+	var unsupported []string
+	for _, opt := range options {
+		name := strings.SplitN(opt, "=", 2)[0]
+		min, ok := optionVersions[name]
+		if !ok {
+			continue
+		}
+
+		supported, err := restic.VersionAtLeast(resticVersion, min)
+		if err != nil {
+			return nil, err
+		}
+
+		if !supported {
+			unsupported = append(unsupported, opt)
+		}
+	}
+
+	return unsupported, nil
+}
+
+// refuseUnsupported reports whether jobs with options the agent's restic does
+// not support are refused, as set by the unsupported-options setting. Otherwise
+// the options are dropped from the job.
+func (man *Manager) refuseUnsupported() (bool, error) {
+	policy := "drop"
+	_, err := man.getSetting("unsupported-options", &policy)
+	if err != nil {
+		return false, err
+	}
+
+	switch policy {
+	case "refuse":
+		return true, nil
+	case "drop", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("manager.refuseUnsupported: invalid unsupported-options policy %q", policy)
+	}
+}
+
+// agentSchedule returns the schedule to send to the agent, without the options
+// its restic does not support, along with the dropped options. It returns an
+// error instead if refuse is set.
+func agentSchedule(sch *entity.Schedule, agent *entity.Agent, refuse bool) (*entity.Schedule, []string, error) {
+	if sch == nil {
+		return nil, nil, nil
+	}
+
+	unsupported, err := UnsupportedOptions(sch.Options, agent.ResticVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(unsupported) == 0 {
+		return sch, nil, nil
+	}
+
+	if refuse {
+		return nil, nil, fmt.Errorf("restic %s does not support options %s", agent.ResticVersion, strings.Join(unsupported, " "))
+	}
+
+	adjusted := *sch
+	adjusted.Options = make([]string, 0, len(sch.Options))
+	for _, opt := range sch.Options {
+		if !contains(unsupported, opt) {
+			adjusted.Options = append(adjusted.Options, opt)
+		}
+	}
+
+	return &adjusted, unsupported, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
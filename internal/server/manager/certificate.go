@@ -0,0 +1,153 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/ca"
+	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/tlsconfig"
+)
+
+// agentClient returns the client for requests to agents. It authenticates with
+// the server's certificate from the CA, and accepts agents serving either a
+// certificate from the CA or one verified by the given config. Which agent
+// answered is checked per request by verifyAgent.
+func (man *Manager) agentClient(base *tls.Config) *http.Client {
+	conf := base.Clone()
+	conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return man.ca.ServerCertificate(), nil
+	}
+
+	// Agent certificates are issued to their IDs rather than their addresses,
+	// so the usual verification is done by hand instead.
+	conf.InsecureSkipVerify = true
+	conf.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return fmt.Errorf("agent sent no certificate")
+		}
+
+		leaf := state.PeerCertificates[0]
+		if man.ca.Verify(leaf) == nil {
+			return nil
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         base.RootCAs,
+			Intermediates: intermediates,
+			DNSName:       state.ServerName,
+		})
+		return err
+	}
+
+	return tlsconfig.HTTPClient(conf)
+}
+
+// verifyAgent checks that the response came from the agent. A certificate from
+// the CA is only accepted if it is the one the agent was issued, as it would
+// otherwise be that of another agent. Agents that were issued a certificate
+// must answer with it, the others over plain HTTP or with a certificate that
+// was verified for their address.
+func (man *Manager) verifyAgent(agent *entity.Agent, resp *http.Response) error {
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		if agent.CertSerial != "" || agent.TLS {
+			return fmt.Errorf("agent %s did not authenticate with its certificate", agent.Name)
+		}
+		return nil
+	}
+
+	cert := resp.TLS.PeerCertificates[0]
+	if man.ca.Verify(cert) != nil {
+		if agent.CertSerial != "" {
+			return fmt.Errorf("agent %s did not authenticate with its certificate", agent.Name)
+		}
+		return nil
+	}
+
+	if agent.CertSerial == "" {
+		return fmt.Errorf("agent %s was issued no certificate", agent.Name)
+	}
+
+	if cert.Subject.CommonName != ca.AgentName(agent.ID) || ca.Serial(cert) != agent.CertSerial {
+		return fmt.Errorf("agent %s authenticated with the wrong certificate", agent.Name)
+	}
+
+	return nil
+}
+
+// certificateCheck is how often the server's certificate is checked for renewal.
+const certificateCheck = 12 * time.Hour
+
+// certificateHandler renews the certificate the server authenticates with to
+// agents as it nears expiry, until the context is done.
+func (man *Manager) certificateHandler() {
+	ticker := time.NewTicker(certificateCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-man.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewed, err := man.ca.RenewServer()
+		if err != nil {
+			man.log.WithFields("function", "certificateHandler").Error("could not renew server certificate:", err)
+			continue
+		}
+
+		if renewed {
+			man.log.Info("Renewed the server's certificate")
+		}
+	}
+}
+
+// CACertificate returns the PEM encoded certificate of the server's CA.
+func (man *Manager) CACertificate() []byte {
+	return man.ca.CertPEM()
+}
+
+// SignAgent issues the agent a certificate for the PEM encoded certificate
+// request, replacing and so revoking any certificate it had before.
+func (man *Manager) SignAgent(agent *entity.Agent, csr []byte) ([]byte, error) {
+	cert, serial, err := man.ca.SignAgent(agent.ID, csr)
+	if err != nil {
+		return nil, fmt.Errorf("manager.SignAgent: %w", err)
+	}
+
+	agent.CertSerial = serial
+	_, err = man.services.AgentSvc.Update(agent)
+	if err != nil {
+		return nil, fmt.Errorf("manager.SignAgent: could not update agent: %w", err)
+	}
+
+	man.log.WithFields("agent", agent.ID).Info("Issued certificate", serial, "to agent", agent.Name)
+
+	return cert, nil
+}
+
+// RevokeAgent cuts off the deleted agent. Its certificate is no longer accepted
+// once the agent is gone, but a tunnel it has open stays up until closed here.
+func (man *Manager) RevokeAgent(agent *entity.Agent) {
+	man.tunnelsMutex.Lock()
+	conn, ok := man.tunnels[agent.ID]
+	delete(man.tunnels, agent.ID)
+	man.tunnelsMutex.Unlock()
+
+	if ok {
+		conn.Close()
+	}
+
+	if agent.CertSerial != "" {
+		man.log.WithFields("agent", agent.ID).Info("Revoked certificate", agent.CertSerial, "of agent", agent.Name)
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// deliveryLock serializes the messages for a job, counting the deliveries
+// holding or waiting for it so it can be dropped after the last.
+type deliveryLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockDelivery locks the messages for the job, returning the function that
+// unlocks them.
+func (man *Manager) lockDelivery(jobID string) func() {
+	man.deliveryMutex.Lock()
+	lock, ok := man.deliveryLocks[jobID]
+	if !ok {
+		lock = &deliveryLock{}
+		man.deliveryLocks[jobID] = lock
+	}
+	lock.refs++
+	man.deliveryMutex.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		man.deliveryMutex.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(man.deliveryLocks, jobID)
+		}
+		man.deliveryMutex.Unlock()
+	}
+}
+
+// Deliver handles the message with the ID from an agent, unless it already
+// was, and reports whether it did. Agents retry messages from their outbox
+// until they get an answer, so one may arrive again after its response was
+// lost, even while the first is still being handled or after a restart.
+//
+// The IDs of the messages handled are stored with the job, and the messages for
+// a job are handled one at a time. Empty IDs, sent by agents without an outbox,
+// are never duplicates.
+func (man *Manager) Deliver(jobID, id string, handle func(job *entity.Job) error) (bool, error) {
+	unlock := man.lockDelivery(jobID)
+	defer unlock()
+
+	job, err := man.services.JobSvc.Get([]byte(jobID))
+	if err != nil {
+		return false, fmt.Errorf("manager.Deliver: could not get job: %w", err)
+	}
+
+	if job == nil {
+		return false, fmt.Errorf("manager.Deliver: no job with ID %s", jobID)
+	}
+
+	if id != "" && containsString(job.Delivered, id) {
+		return false, nil
+	}
+
+	err = handle(job)
+	if err != nil {
+		return false, err
+	}
+
+	if id == "" {
+		return true, nil
+	}
+
+	man.jobsMutex.Lock()
+	defer man.jobsMutex.Unlock()
+
+	// The handler may have written the job, so it is read again.
+	job, err = man.services.JobSvc.Get([]byte(jobID))
+	if err != nil {
+		return true, fmt.Errorf("manager.Deliver: could not get job to mark message delivered: %w", err)
+	}
+
+	if job == nil {
+		return true, nil
+	}
+
+	job.Delivered = append(job.Delivered, id)
+	_, err = man.services.JobSvc.Update(job)
+	if err != nil {
+		return true, fmt.Errorf("manager.Deliver: could not mark message delivered: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	monthNames   = []string{"", "January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	weekdayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "at 00:00 on January 1",
+	"@annually": "at 00:00 on January 1",
+	"@monthly":  "at 00:00 on day 1 of every month",
+	"@weekly":   "at 00:00 on Sunday",
+	"@daily":    "at 00:00 every day",
+	"@midnight": "at 00:00 every day",
+	"@hourly":   "at minute 0 of every hour",
+}
+
+// DescribeCron returns a human readable description of a standard cron
+// expression, such as "at 02:30 on Monday through Friday". The expression is
+// expected to be valid already, see ParseSchedule.
+func DescribeCron(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if desc, ok := cronDescriptors[expr]; ok {
+		return desc
+	}
+
+	if strings.HasPrefix(expr, "@every ") {
+		return "every " + strings.TrimPrefix(expr, "@every ")
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return expr
+	}
+	minute, hour, dom, month, dow := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	var parts []string
+	_, minErr := strconv.Atoi(minute)
+	_, hourErr := strconv.Atoi(hour)
+	switch {
+	case minErr == nil && hourErr == nil:
+		m, _ := strconv.Atoi(minute)
+		h, _ := strconv.Atoi(hour)
+		parts = append(parts, fmt.Sprintf("at %02d:%02d", h, m))
+	case minute == "*" && hour == "*":
+		parts = append(parts, "every minute")
+	case hour == "*" && strings.HasPrefix(minute, "*"):
+		parts = append(parts, describeField(minute, "minute", nil))
+	case hour == "*":
+		parts = append(parts, "at "+describeField(minute, "minute", nil)+" of every hour")
+	default:
+		minutes := describeField(minute, "minute", nil)
+		if !strings.HasPrefix(minutes, "every") {
+			minutes = "at " + minutes
+		}
+		parts = append(parts, minutes+" of "+describeField(hour, "hour", nil))
+	}
+
+	if dom != "*" && dom != "?" {
+		parts = append(parts, "on "+describeField(dom, "day", nil))
+	}
+
+	if month != "*" {
+		parts = append(parts, "in "+describeField(month, "month", monthNames))
+	}
+
+	if dow != "*" && dow != "?" {
+		parts = append(parts, "on "+describeField(dow, "weekday", weekdayNames))
+	}
+
+	if len(parts) == 1 && dom == "*" && month == "*" && dow == "*" && minErr == nil && hourErr == nil {
+		parts = append(parts, "every day")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// describeField describes a single cron field. Values are printed with the unit
+// in front, or as names when names are given.
+func describeField(field, unit string, names []string) string {
+	items := strings.Split(field, ",")
+	described := make([]string, 0, len(items))
+	for _, item := range items {
+		described = append(described, describeItem(item, unit, names))
+	}
+
+	if len(described) == 1 {
+		return described[0]
+	}
+
+	return strings.Join(described[:len(described)-1], ", ") + " and " + described[len(described)-1]
+}
+
+func describeItem(item, unit string, names []string) string {
+	value, step := item, ""
+	if i := strings.Index(item, "/"); i >= 0 {
+		value, step = item[:i], item[i+1:]
+	}
+
+	var desc string
+	switch {
+	case value == "*" && step != "":
+		return fmt.Sprintf("every %s %ss", step, unit)
+	case value == "*":
+		return "every " + unit
+	case strings.Contains(value, "-"):
+		bounds := strings.SplitN(value, "-", 2)
+		desc = fmt.Sprintf("%s through %s", cronName(bounds[0], unit, names), cronName(bounds[1], "", names))
+	default:
+		desc = cronName(value, unit, names)
+	}
+
+	if step != "" {
+		desc = fmt.Sprintf("every %s %ss from %s", step, unit, desc)
+	}
+
+	return desc
+}
+
+func cronName(value, unit string, names []string) string {
+	if names != nil {
+		n, err := strconv.Atoi(value)
+		if err == nil {
+			// Sunday may be written as 7.
+			if len(names) == 7 {
+				n %= 7
+			}
+			if n >= 0 && n < len(names) {
+				return names[n]
+			}
+		}
+		// Names such as MON or JAN are expanded to the full name.
+		for _, name := range names {
+			if len(value) == 3 && strings.HasPrefix(strings.ToLower(name), strings.ToLower(value)) {
+				return name
+			}
+		}
+		return value
+	}
+
+	if unit == "" {
+		return value
+	}
+	return unit + " " + value
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	agentRequest "zerosrealm.xyz/tergum/internal/agent/api/request"
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// GetForgetPolicy returns the forget policy that applies to the backup. A policy
+// linked to the backup wins over one linked to its repository, which in turn wins
+// over the default policy.
+func (man *Manager) GetForgetPolicy(backup *entity.Backup) (*entity.Forget, error) {
+	// TODO: Optimize with filters.
+	policies, err := man.services.ForgetSvc.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("manager.GetForgetPolicy: could not get forget policies: %w", err)
+	}
+
+	var repoPolicy, defaultPolicy *entity.Forget
+	for _, policy := range policies {
+		switch {
+		case policy.BackupID != 0:
+			if policy.BackupID == backup.ID {
+				return policy, nil
+			}
+		case policy.RepoID != 0:
+			if policy.RepoID == backup.Target {
+				repoPolicy = policy
+			}
+		case policy.ID == 0:
+			defaultPolicy = policy
+		}
+	}
+
+	if repoPolicy != nil {
+		return repoPolicy, nil
+	}
+
+	return defaultPolicy, nil
+}
+
+// ScopeForgetPolicy returns a copy of the policy to run for the backup. Policies
+// linked to a backup only apply to the backup's source unless they list their own
+// paths, so they don't prune snapshots of other backups sharing the repository.
+func ScopeForgetPolicy(policy *entity.Forget, backup *entity.Backup) *entity.Forget {
+	scoped := *policy
+	if policy.BackupID != 0 && len(policy.Paths) == 0 && backup != nil {
+		scoped.Paths = []string{backup.Source}
+	}
+
+	return &scoped
+}
+
+// ScopeForgetPreview returns the policies that would run for the backup, one per
+// source its agents back up. The source of a backup created from a template is
+// rendered for each agent, as it is when the policy runs after a backup.
+func (man *Manager) ScopeForgetPreview(policy *entity.Forget, backup *entity.Backup) ([]*entity.Forget, error) {
+	if backup == nil || backup.TemplateID == 0 || policy.BackupID == 0 || len(policy.Paths) != 0 {
+		return []*entity.Forget{ScopeForgetPolicy(policy, backup)}, nil
+	}
+
+	agents, err := man.BackupAgents(backup)
+	if err != nil {
+		return nil, fmt.Errorf("manager.ScopeForgetPreview: could not get agents of backup: %w", err)
+	}
+
+	sources := make(map[string]struct{})
+	policies := make([]*entity.Forget, 0)
+	for _, agent := range agents {
+		rendered, err := RenderBackup(backup, agent)
+		if err != nil {
+			man.log.WithFields("backup", backup.ID).Debug("Could not render backup for agent", agent.Name, err)
+			continue
+		}
+
+		if _, ok := sources[rendered.Source]; ok {
+			continue
+		}
+		sources[rendered.Source] = struct{}{}
+
+		policies = append(policies, ScopeForgetPolicy(policy, rendered))
+	}
+
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("manager.ScopeForgetPreview: backup %d has no agents to render its source for", backup.ID)
+	}
+
+	return policies, nil
+}
+
+// enqueueForget queues the forget policy of the backup the job ran as a new job on
+// the same agent. It returns nil if no policy is enabled for the backup. The
+// request is built again from the job's backup and agent, as the job's own
+// request isn't stored and is gone once the job was loaded from storage.
+func (man *Manager) enqueueForget(backupJob *entity.Job) (*entity.Job, error) {
+	if backupJob.BackupID == 0 {
+		return nil, nil
+	}
+
+	backup, err := man.services.BackupSvc.Get([]byte(strconv.Itoa(backupJob.BackupID)))
+	if err != nil {
+		return nil, fmt.Errorf("manager.enqueueForget: could not get backup: %w", err)
+	}
+
+	if backup == nil {
+		return nil, fmt.Errorf("manager.enqueueForget: backup %d of job %s no longer exists", backupJob.BackupID, backupJob.ID)
+	}
+
+	policy, err := man.GetForgetPolicy(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy == nil || !policy.Enabled {
+		return nil, nil
+	}
+
+	agent, err := man.services.AgentSvc.Get([]byte(strconv.Itoa(backupJob.AgentID)))
+	if err != nil {
+		return nil, fmt.Errorf("manager.enqueueForget: could not get agent: %w", err)
+	}
+
+	if agent == nil {
+		return nil, fmt.Errorf("manager.enqueueForget: agent %d of job %s no longer exists", backupJob.AgentID, backupJob.ID)
+	}
+
+	repo, err := man.services.RepoSvc.Get([]byte(strconv.Itoa(backup.Target)))
+	if err != nil {
+		return nil, fmt.Errorf("manager.enqueueForget: could not get repo: %w", err)
+	}
+
+	if repo == nil {
+		return nil, fmt.Errorf("manager.enqueueForget: repo %d of backup %d no longer exists", backup.Target, backup.ID)
+	}
+
+	rendered, err := RenderBackup(backup, agent)
+	if err != nil {
+		return nil, fmt.Errorf("manager.enqueueForget: could not render backup for agent %s: %w", agent.Name, err)
+	}
+
+	jobRequest := &entity.JobRequest{
+		Type:  "forget",
+		Agent: agent,
+
+		Data: &agentRequest.Forget{
+			Repo:   repo,
+			Policy: ScopeForgetPolicy(policy, rendered),
+		},
+	}
+
+	job, err := man.NewJob(jobRequest)
+	if err != nil {
+		return nil, err
+	}
+	man.log.WithFields("job", backupJob.ID).Debug("Enqueued forget job", job.ID)
+
+	return job, nil
+}
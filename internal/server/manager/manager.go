@@ -3,9 +3,11 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"path"
 	"strconv"
@@ -16,9 +18,11 @@ import (
 	"github.com/rs/xid"
 
 	agentRequest "zerosrealm.xyz/tergum/internal/agent/api/request"
+	"zerosrealm.xyz/tergum/internal/ca"
 	"zerosrealm.xyz/tergum/internal/entity"
 	"zerosrealm.xyz/tergum/internal/log"
 	"zerosrealm.xyz/tergum/internal/server/service"
+	"zerosrealm.xyz/tergum/internal/tunnel"
 )
 
 type Manager struct {
@@ -29,32 +33,113 @@ type Manager struct {
 
 	log *log.Logger
 
-	wsWrite       chan []byte
-	jobQueue      chan *entity.JobRequest
-	wsConnections *map[string]*websocket.Conn
+	// ca issues the agents their certificates, and client sends requests to the
+	// agents reached over HTTP.
+	ca     *ca.CA
+	client *http.Client
+
+	jobQueue  chan *queuedJob
+	queueWake chan struct{}
+
+	// wsClients holds the websocket clients of the UI, each with its own sender.
+	wsClients map[*websocket.Conn]*wsClient
+	wsMutex   *sync.Mutex
+
+	// running maps the ID of each sent backup job to the repository slot it
+	// holds, with repoRunning counting them per repository.
+	running      map[string]*repoSlot
+	repoRunning  map[int]int
+	runningMutex *sync.Mutex
+
+	scheduler *Scheduler
+
+	// tunnels maps agent IDs to the tunnels they have open.
+	tunnels      map[int]*tunnel.Conn
+	tunnelsMutex *sync.Mutex
+
+	// rotationMutex keeps PSK rotations from running at the same time.
+	rotationMutex *sync.Mutex
+
+	// registrationMutex keeps one-time registration tokens from being used by
+	// agents registering at the same time.
+	registrationMutex *sync.Mutex
+
+	// sessions of the users logged in, by their token.
+	sessions *sessions
+
+	// logins throttles failed logins by username and address.
+	logins *loginThrottle
+
+	// deliveryLocks serialize the messages from agents for each job, by its ID.
+	deliveryLocks map[string]*deliveryLock
+	deliveryMutex *sync.Mutex
+
+	// progressWrites holds when the progress of each running job was last
+	// written to the database.
+	progressWrites map[string]time.Time
+	progressMutex  *sync.Mutex
 }
 
-func NewManager(ctx context.Context, services *service.Services, logger *log.Logger, wsConns *map[string]*websocket.Conn) *Manager {
-	return &Manager{
+func NewManager(ctx context.Context, services *service.Services, logger *log.Logger, authority *ca.CA, tlsConf *tls.Config) *Manager {
+	man := &Manager{
 		ctx: ctx,
 		// jobs:      make([]*entity.Job, 0),
 		jobsMutex: &sync.Mutex{},
 		services:  services,
 
 		log: logger.WithFields("component", "manager"),
+		ca:  authority,
+
+		jobQueue:  make(chan *queuedJob, 100),
+		queueWake: make(chan struct{}, 1),
+
+		wsClients: make(map[*websocket.Conn]*wsClient),
+		wsMutex:   &sync.Mutex{},
+
+		running:      make(map[string]*repoSlot),
+		repoRunning:  make(map[int]int),
+		runningMutex: &sync.Mutex{},
+
+		tunnels:      make(map[int]*tunnel.Conn),
+		tunnelsMutex: &sync.Mutex{},
+
+		rotationMutex:     &sync.Mutex{},
+		registrationMutex: &sync.Mutex{},
 
-		wsWrite:       make(chan []byte, 100),
-		jobQueue:      make(chan *entity.JobRequest, 100),
-		wsConnections: wsConns,
+		sessions: &sessions{sessions: make(map[string]*session)},
+		logins:   newLoginThrottle(),
+
+		deliveryLocks: make(map[string]*deliveryLock),
+		deliveryMutex: &sync.Mutex{},
+
+		progressWrites: make(map[string]time.Time),
+		progressMutex:  &sync.Mutex{},
 	}
+	man.scheduler = newScheduler(man)
+	man.client = man.agentClient(tlsConf)
+
+	return man
+}
+
+// Scheduler returns the scheduler running the backup schedules.
+func (man *Manager) Scheduler() *Scheduler {
+	return man.scheduler
 }
 
 func (man *Manager) Start() {
-	go man.wsWriter()
 	go man.queueHandler()
+	go man.rotationHandler()
+	go man.certificateHandler()
+
+	man.resumeDeferred()
 }
 
 func (man *Manager) NewJob(jobRequest *entity.JobRequest) (*entity.Job, error) {
+	return man.newJob(jobRequest, 0)
+}
+
+// newJob creates the job and queues it to be sent once the delay has passed.
+func (man *Manager) newJob(jobRequest *entity.JobRequest, delay time.Duration) (*entity.Job, error) {
 	man.jobsMutex.Lock()
 	defer man.jobsMutex.Unlock()
 
@@ -64,6 +149,7 @@ func (man *Manager) NewJob(jobRequest *entity.JobRequest) (*entity.Job, error) {
 
 	job := &entity.Job{
 		ID:        id,
+		Type:      jobRequest.Type,
 		Done:      false,
 		Aborted:   false,
 		Progress:  json.RawMessage([]byte(`{}`)),
@@ -71,6 +157,10 @@ func (man *Manager) NewJob(jobRequest *entity.JobRequest) (*entity.Job, error) {
 		Request:   jobRequest,
 	}
 
+	if jobRequest.Agent != nil {
+		job.AgentID = jobRequest.Agent.ID
+	}
+
 	switch jobRequest.Type {
 	case "backup":
 		req := jobRequest.Data.(*agentRequest.Backup)
@@ -80,16 +170,24 @@ func (man *Manager) NewJob(jobRequest *entity.JobRequest) (*entity.Job, error) {
 		}
 
 		req.Job.ID = id
+		job.BackupID = req.Backup.ID
 
-		backup, err := man.services.BackupSvc.Get([]byte(strconv.Itoa(req.Backup.ID)))
+		err := man.scheduler.recordLastRun(req.Backup.ID, req.Schedule, time.Now())
 		if err != nil {
-			return nil, fmt.Errorf("manager.newJob: job %s could not get backup %d error: %w", id, req.Backup.ID, err)
+			return nil, fmt.Errorf("manager.newJob: job %s could not record run of backup %d: %w", id, req.Backup.ID, err)
 		}
 
-		backup.LastRun = time.Now()
-		man.services.BackupSvc.Update(backup)
-
 		jobRequest.Data = req
+
+		if delay > 0 {
+			deferred, err := json.Marshal(req)
+			if err != nil {
+				return nil, fmt.Errorf("manager.newJob: job %s could not be deferred: %w", id, err)
+			}
+
+			job.NotBefore = job.StartTime.Add(delay)
+			job.Deferred = deferred
+		}
 	case "stop":
 		req := jobRequest.Data.(*agentRequest.Stop)
 		req.Job.ID = id
@@ -98,6 +196,10 @@ func (man *Manager) NewJob(jobRequest *entity.JobRequest) (*entity.Job, error) {
 		req := jobRequest.Data.(*agentRequest.Restore)
 		req.Job.ID = id
 		jobRequest.Data = req
+	case "forget":
+		req := jobRequest.Data.(*agentRequest.Forget)
+		req.Job.ID = id
+		jobRequest.Data = req
 	default:
 		return nil, fmt.Errorf("manager.newJob: unknown job type %s", jobRequest.Type)
 	}
@@ -107,7 +209,7 @@ func (man *Manager) NewJob(jobRequest *entity.JobRequest) (*entity.Job, error) {
 		return nil, fmt.Errorf("manager.newJob: job %s could not be created: %w", id, err)
 	}
 
-	ok := man.enqueue(jobRequest)
+	ok := man.enqueueAt(jobRequest, job.StartTime.Add(delay), delay > 0)
 	if !ok {
 		job.Aborted = true
 
@@ -124,7 +226,15 @@ func (man *Manager) NewJob(jobRequest *entity.JobRequest) (*entity.Job, error) {
 
 func (man *Manager) UpdateJobProgress(job *entity.Job, data []byte) {
 	man.jobsMutex.Lock()
-	defer man.jobsMutex.Unlock()
+
+	// Status updates sent directly can overtake the summary, which is delivered
+	// through the agent's outbox, so they must not overwrite the final progress.
+	if job.Done {
+		man.jobsMutex.Unlock()
+		man.log.WithFields("job", job.ID).Debug("updateJobProgress: job already ended, ignoring update")
+		return
+	}
+
 	job.Progress = json.RawMessage(data)
 
 	var msgType struct {
@@ -132,6 +242,7 @@ func (man *Manager) UpdateJobProgress(job *entity.Job, data []byte) {
 	}
 	err := json.Unmarshal(data, &msgType)
 	if err != nil {
+		man.jobsMutex.Unlock()
 		man.log.WithFields("job", job.ID).Error("updateJobProgress: error unmarshalling data", err)
 		return
 	}
@@ -139,15 +250,74 @@ func (man *Manager) UpdateJobProgress(job *entity.Job, data []byte) {
 	switch msgType.MessageType {
 	case "summary":
 		man.log.WithFields("job", job.ID).Debug("updateJobProgress: job done")
-		man.jobDone(job)
+		err = man.jobDone(job)
+		man.jobsMutex.Unlock()
+		if err != nil {
+			man.log.WithFields("job", job.ID).Error("updateJobProgress:", err)
+			return
+		}
 
-	case "error":
+		// Retention runs as its own job, so a failing forget doesn't fail the backup.
+		if job.Type == "backup" {
+			_, err = man.enqueueForget(job)
+			if err != nil {
+				man.log.WithFields("job", job.ID).Error("updateJobProgress: could not enqueue forget policy:", err)
+			}
+		}
+		return
+
+	case "exit_error":
 		man.log.WithFields("job", job.ID).Warn("updateJobProgress: restic returned error", string(data))
-		man.jobAborted(job.ID)
+		err = man.jobExited(job)
+		if err != nil {
+			man.log.WithFields("job", job.ID).Error("updateJobProgress:", err)
+		}
+	case "error":
+		// Errors about single files don't stop restic, the job goes on.
+		man.log.WithFields("job", job.ID).Warn("updateJobProgress: restic reported error", string(data))
+		man.saveProgress(job)
+	default:
+		man.saveProgress(job)
 	}
+	man.jobsMutex.Unlock()
+}
+
+// JobFailed marks the job as aborted with the error the agent reported.
+func (man *Manager) JobFailed(job *entity.Job, msg, errMsg string) error {
+	man.releaseJob(job.ID)
+	man.forgetProgress(job.ID)
+
+	man.jobsMutex.Lock()
+	defer man.jobsMutex.Unlock()
+
+	progress, err := json.Marshal(struct {
+		MessageType string `json:"message_type"`
+		Error       string `json:"error"`
+		Msg         string `json:"msg"`
+	}{
+		MessageType: "error",
+		Error:       errMsg,
+		Msg:         msg,
+	})
+	if err != nil {
+		return fmt.Errorf("jobFailed: could not marshal error: %w", err)
+	}
+
+	job.Progress = json.RawMessage(progress)
+	job.Aborted = true
+	job.EndTime = time.Now()
+
+	_, err = man.services.JobSvc.Update(job)
+	if err != nil {
+		return fmt.Errorf("jobFailed: could not update job: %w", err)
+	}
+
+	return nil
 }
 
 func (man *Manager) jobDone(job *entity.Job) error {
+	man.releaseJob(job.ID)
+	man.forgetProgress(job.ID)
 	job.Done = true
 	job.EndTime = time.Now()
 
@@ -159,7 +329,26 @@ func (man *Manager) jobDone(job *entity.Job) error {
 	return nil
 }
 
+// jobExited marks the job as aborted after restic exited with an error, keeping
+// the error as its progress.
+func (man *Manager) jobExited(job *entity.Job) error {
+	man.releaseJob(job.ID)
+	man.forgetProgress(job.ID)
+	job.Aborted = true
+	job.EndTime = time.Now()
+
+	_, err := man.services.JobSvc.Update(job)
+	if err != nil {
+		return fmt.Errorf("jobExited: could not update job: %w", err)
+	}
+
+	return nil
+}
+
 func (man *Manager) jobAborted(jobID string) error {
+	man.releaseJob(jobID)
+	man.forgetProgress(jobID)
+
 	job, err := man.services.JobSvc.Get([]byte(jobID))
 	if err != nil {
 		return fmt.Errorf("abortJob: could not get job: %w", err)
@@ -192,6 +381,7 @@ type errorResponse struct {
 	Message string `json:"message"`
 }
 
+// WriteErrorWS shows the error to the admins, as it may be about anything.
 func (man *Manager) WriteErrorWS(err error, msg string) {
 	resp := wsToast{
 		Type:  "error",
@@ -205,10 +395,16 @@ func (man *Manager) WriteErrorWS(err error, msg string) {
 		return
 	}
 
-	man.WriteWS([]byte(errorJSON))
+	man.WriteWS([]byte(errorJSON), func(user *entity.User) bool {
+		return user.Role == entity.RoleAdmin
+	})
 }
 
 func (man *Manager) SendRequest(job *entity.JobRequest, agent *entity.Agent) ([]byte, error) {
+	if agent.Pending {
+		return nil, fmt.Errorf("manager.sendRequest: agent %s is pending approval", agent.Name)
+	}
+
 	msg, err := json.Marshal(job.Data)
 	if err != nil {
 		return nil, fmt.Errorf("manager.sendRequest: error marshalling agent stop request: %w", err)
@@ -231,6 +427,9 @@ func (man *Manager) SendRequest(job *entity.JobRequest, agent *entity.Agent) ([]
 		endpoint = "/snapshot/list"
 		method = "POST"
 	case "forget":
+		endpoint = "/forget"
+		method = "POST"
+	case "forgetpreview":
 		endpoint = "/snapshot/forget"
 		method = "POST"
 	case "deletesnapshot":
@@ -243,73 +442,96 @@ func (man *Manager) SendRequest(job *entity.JobRequest, agent *entity.Agent) ([]
 		return nil, fmt.Errorf("manager.sendRequest: unknown job type %s", job.Type)
 	}
 
-	// TODO: Change to HTTPS when we have a proper TLS support.
-	req, err := http.NewRequest(method, "http://"+path.Join(fmt.Sprintf("%s:%d", agent.IP, agent.Port), "/api/"+endpoint), bytes.NewReader(msg))
-	if err != nil {
-		return nil, fmt.Errorf("manager.sendRequest: error creating request: %w", err)
+	var status int
+	var body []byte
+	if agent.Tunnel {
+		status, body, err = man.sendTunnel(agent, method, "/api"+endpoint, msg)
+	} else {
+		status, body, err = man.sendHTTP(agent, method, endpoint, msg)
 	}
-	req.Header.Set("X-PSK", agent.PSK)
-
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("manager.sendRequest: error sending request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	man.log.WithFields("job", job.ID).Debug("successfully sent to", agent.Name)
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		err = fmt.Errorf("manager.sendRequest: error reading response body: %w", err)
 		man.log.WithFields("job", job.ID).Error(err)
 		return nil, err
 	}
-	man.log.WithFields("job", job.ID).Debug("manager.sendRequest: status:", resp.Status, "body:", string(body))
+
+	man.log.WithFields("job", job.ID).Debug("successfully sent to", agent.Name)
+	man.log.WithFields("job", job.ID).Debug("manager.sendRequest: status:", status, "body:", string(body))
 
 	// If we got an error back from the agent, return this error.
-	if resp.StatusCode > 299 {
+	if status > 299 {
 		var errResp errorResponse
 		err := json.Unmarshal(body, &errResp)
 		if err != nil {
 			return nil, fmt.Errorf("manager.sendRequest: error unmarshalling error response: %w", err)
 		}
-		man.log.WithFields("job", job.ID).Warn("non-2XX status:", resp.Status, "error:", errResp.Error)
+		man.log.WithFields("job", job.ID).Warn("non-2XX status:", status, "error:", errResp.Error)
 		return nil, fmt.Errorf(errResp.Error)
 	}
 
 	return body, nil
 }
 
-func (man *Manager) wsWriter() {
-	for {
-		select {
-		case <-man.ctx.Done():
-			man.log.Debug("wsWriter canceled")
-			return
-		case msg := <-man.wsWrite:
-			if man.ctx.Err() != nil {
-				man.log.Debug("wsWriter canceled")
-				return
-			}
-			for _, c := range *man.wsConnections {
-				err := c.WriteMessage(websocket.TextMessage, msg)
-				if err != nil {
-					man.log.Error("wsWriter: ", err)
-					continue
-				}
-			}
-		default:
-			if man.ctx.Err() != nil {
-				man.log.Debug("wsWriter canceled")
-				return
-			}
-		}
+// sendHTTP sends the request to the agent's API at its IP and port, over HTTPS
+// if the agent serves it. An agent that refuses its PSK during a rotation is
+// tried with the next one, which it switched to if the server never heard back
+// from the commit, and which then becomes its PSK.
+func (man *Manager) sendHTTP(agent *entity.Agent, method, endpoint string, msg []byte) (int, []byte, error) {
+	status, body, err := man.doHTTP(agent, agent.PSK, method, endpoint, msg)
+	if err != nil || status != http.StatusUnauthorized || agent.NextPSK == "" || agent.NextPSK == agent.PSK {
+		return status, body, err
+	}
+
+	status, body, err = man.doHTTP(agent, agent.NextPSK, method, endpoint, msg)
+	if err == nil && status != http.StatusUnauthorized {
+		man.promotePSK(agent.ID, agent.NextPSK)
 	}
+
+	return status, body, err
 }
 
-func (man *Manager) WriteWS(data []byte) {
-	select {
-	case man.wsWrite <- data:
-	default:
+// doHTTP sends the request authenticated with the PSK.
+func (man *Manager) doHTTP(agent *entity.Agent, psk, method, endpoint string, msg []byte) (int, []byte, error) {
+	scheme := "http://"
+	if agent.TLS {
+		scheme = "https://"
+	}
+
+	req, err := http.NewRequest(method, scheme+path.Join(net.JoinHostPort(agent.IP, strconv.Itoa(agent.Port)), "/api/"+endpoint), bytes.NewReader(msg))
+	if err != nil {
+		return 0, nil, fmt.Errorf("manager.sendRequest: error creating request: %w", err)
 	}
+	req.Header.Set("X-PSK", psk)
+
+	resp, err := man.client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("manager.sendRequest: error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = man.verifyAgent(agent, resp)
+	if err != nil {
+		return 0, nil, fmt.Errorf("manager.sendRequest: %w", err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("manager.sendRequest: error reading response body: %w", err)
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// sendTunnel sends the request over the tunnel the agent has open.
+func (man *Manager) sendTunnel(agent *entity.Agent, method, path string, msg []byte) (int, []byte, error) {
+	conn := man.agentTunnel(agent.ID)
+	if conn == nil {
+		return 0, nil, fmt.Errorf("manager.sendRequest: agent %s is not connected", agent.Name)
+	}
+
+	status, body, err := conn.Do(man.ctx, method, path, nil, msg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("manager.sendRequest: error sending request over tunnel: %w", err)
+	}
+
+	return status, body, nil
 }
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// BackupPaused reports whether the backup's schedules are paused at t.
+func BackupPaused(backup *entity.Backup, t time.Time) bool {
+	return !backup.Enabled || t.Before(backup.PausedUntil)
+}
+
+// AgentPaused reports whether scheduled backups on the agent are paused at t. A
+// pause with an end time lifts by itself once that time has passed.
+func AgentPaused(agent *entity.Agent, t time.Time) bool {
+	if !agent.SchedulesPaused {
+		return false
+	}
+
+	return agent.PausedUntil.IsZero() || t.Before(agent.PausedUntil)
+}
+
+// SchedulesPaused reports whether all scheduled backups are paused by the
+// schedules-paused setting.
+func (man *Manager) SchedulesPaused() (bool, error) {
+	paused := false
+	_, err := man.getSetting("schedules-paused", &paused)
+	if err != nil {
+		return false, err
+	}
+
+	return paused, nil
+}
+
+// SetSchedulesPaused pauses or resumes all scheduled backups.
+func (man *Manager) SetSchedulesPaused(paused bool) error {
+	return man.setSetting("schedules-paused", paused)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// progressWriteInterval is the least time between two writes of a running job's
+// progress to the database. The latest progress is always kept on the job in
+// between, and the final one is written when the job ends.
+const progressWriteInterval = 10 * time.Second
+
+// saveProgress writes the job's progress to the database, unless it was written
+// less than progressWriteInterval ago.
+func (man *Manager) saveProgress(job *entity.Job) {
+	now := time.Now()
+
+	man.progressMutex.Lock()
+	last, ok := man.progressWrites[job.ID]
+	if ok && now.Sub(last) < progressWriteInterval {
+		man.progressMutex.Unlock()
+		return
+	}
+	man.progressWrites[job.ID] = now
+	man.progressMutex.Unlock()
+
+	_, err := man.services.JobSvc.Update(job)
+	if err != nil {
+		man.log.WithFields("job", job.ID).Error("saveProgress: could not update job:", err)
+	}
+}
+
+// forgetProgress stops tracking progress writes for the job once it has ended.
+func (man *Manager) forgetProgress(jobID string) {
+	man.progressMutex.Lock()
+	delete(man.progressWrites, jobID)
+	man.progressMutex.Unlock()
+}
@@ -1,23 +1,200 @@
 package server
 
 import (
-	"fmt"
+	"encoding/json"
+	"net"
+	"strconv"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	agentRequest "zerosrealm.xyz/tergum/internal/agent/api/request"
 	"zerosrealm.xyz/tergum/internal/entity"
 )
 
+// queuedJob is a job request waiting in the queue until it may be sent.
+type queuedJob struct {
+	request   *entity.JobRequest
+	notBefore time.Time
+	// repoID is set for backups, which count towards the repository's concurrency cap.
+	repoID int
+	// deferred jobs are stored with their request until they are sent.
+	deferred bool
+}
+
 func (man *Manager) enqueue(job *entity.JobRequest) bool {
+	return man.enqueueAt(job, time.Now(), false)
+}
+
+// enqueueAt queues the job to be sent no earlier than notBefore.
+func (man *Manager) enqueueAt(job *entity.JobRequest, notBefore time.Time, deferred bool) bool {
+	queued := &queuedJob{
+		request:   job,
+		notBefore: notBefore,
+		deferred:  deferred,
+	}
+
+	if req, ok := job.Data.(*agentRequest.Backup); ok && req.Repo != nil {
+		queued.repoID = req.Repo.ID
+	}
+
 	select {
-	case man.jobQueue <- job:
+	case man.jobQueue <- queued:
 		return true
 	default:
 		return false
 	}
 }
 
+const (
+	// repoSlotTimeout is how long a job holds its repository slot on an agent
+	// that doesn't send heartbeats, which can't tell whether it still runs it.
+	repoSlotTimeout = 24 * time.Hour
+
+	// repoSlotCheck is how often slots are checked while jobs wait for one.
+	repoSlotCheck = 30 * time.Second
+)
+
+// repoSlot is held by a backup job running against a repository with a
+// concurrency cap. The job normally gives it back when it ends, but that never
+// happens for jobs lost along with their agent.
+type repoSlot struct {
+	repoID   int
+	agentID  int
+	acquired time.Time
+}
+
+// releaseJob frees the repository slot held by the job, if any, so jobs held back
+// by the concurrency cap can be sent.
+func (man *Manager) releaseJob(jobID string) {
+	man.runningMutex.Lock()
+	ok := man.releaseSlot(jobID)
+	man.runningMutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	man.wakeQueue()
+}
+
+// releaseSlot frees the job's slot, reporting whether it held one. The mutex
+// must be held.
+func (man *Manager) releaseSlot(jobID string) bool {
+	slot, ok := man.running[jobID]
+	if !ok {
+		return false
+	}
+
+	delete(man.running, jobID)
+	man.repoRunning[slot.repoID]--
+	if man.repoRunning[slot.repoID] <= 0 {
+		delete(man.repoRunning, slot.repoID)
+	}
+
+	return true
+}
+
+// reclaimSlots frees the slots of jobs whose agent went offline, was deleted or
+// no longer reports running them in its heartbeats. Agents without heartbeats
+// hold their slots until repoSlotTimeout.
+func (man *Manager) reclaimSlots() {
+	man.runningMutex.Lock()
+	slots := make(map[string]repoSlot, len(man.running))
+	for jobID, slot := range man.running {
+		slots[jobID] = *slot
+	}
+	man.runningMutex.Unlock()
+
+	if len(slots) == 0 {
+		return
+	}
+
+	offlineAfter, err := man.offlineAfter()
+	if err != nil {
+		man.log.WithFields("function", "reclaimSlots").Error(err)
+		return
+	}
+
+	now := time.Now()
+	for jobID, slot := range slots {
+		agent, err := man.services.AgentSvc.Get([]byte(strconv.Itoa(slot.agentID)))
+		if err != nil {
+			man.log.WithFields("function", "reclaimSlots", "agent", slot.agentID).Error(err)
+			continue
+		}
+
+		reason := ""
+		switch {
+		case agent == nil:
+			reason = "agent was deleted"
+		case AgentStatus(agent, now, offlineAfter) == entity.AgentOffline:
+			reason = "agent is offline"
+		case agent.LastSeen.IsZero():
+			if now.Sub(slot.acquired) > repoSlotTimeout {
+				reason = "slot timed out"
+			}
+		case agent.LastSeen.Sub(slot.acquired) > offlineAfter && !containsString(agent.RunningJobs, jobID):
+			reason = "agent no longer runs the job"
+		}
+
+		if reason == "" {
+			continue
+		}
+
+		man.runningMutex.Lock()
+		current, ok := man.running[jobID]
+		if ok && current.acquired.Equal(slot.acquired) {
+			man.releaseSlot(jobID)
+		}
+		man.runningMutex.Unlock()
+
+		if ok {
+			man.log.WithFields("job", jobID, "repo", slot.repoID).Warn("Released repository slot:", reason)
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// wakeQueue makes the queue handler look at the pending jobs again.
+func (man *Manager) wakeQueue() {
+	select {
+	case man.queueWake <- struct{}{}:
+	default:
+	}
+}
+
+// repoConcurrency returns the maximum number of backups allowed to run at once
+// against a single repository, 0 meaning no limit.
+func (man *Manager) repoConcurrency() int {
+	limit := 0
+	_, err := man.getSetting("repo-concurrency", &limit)
+	if err != nil {
+		man.log.Error("queueHandler: could not get repo-concurrency, running without limit:", err)
+		return 0
+	}
+
+	if limit < 0 {
+		return 0
+	}
+
+	return limit
+}
+
 func (man *Manager) queueHandler() {
 	man.log.Debug("queueHandler: starting")
+
+	pending := []*queuedJob{}
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
 	for {
 		select {
 		case <-man.ctx.Done():
@@ -25,43 +202,208 @@ func (man *Manager) queueHandler() {
 			return
 
 		case job := <-man.jobQueue:
-			if man.ctx.Err() != nil {
-				return
+			pending = append(pending, job)
+
+		case <-man.queueWake:
+		case <-timer.C:
+		}
+
+		if man.ctx.Err() != nil {
+			return
+		}
+
+		var wait time.Duration
+		pending, wait = man.dispatch(pending)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if wait > 0 {
+			timer.Reset(wait)
+		} else {
+			timer.Reset(time.Hour)
+		}
+	}
+}
+
+// dispatch sends every pending job that is due and fits under its repository's
+// concurrency cap, keeping the rest in order. Jobs for agents whose tunnel is
+// down wait for the agent to reconnect. It returns the jobs left waiting and
+// how long until the next one becomes due.
+func (man *Manager) dispatch(pending []*queuedJob) ([]*queuedJob, time.Duration) {
+	limit := man.repoConcurrency()
+	if limit > 0 {
+		man.reclaimSlots()
+	}
+	now := time.Now()
+
+	var wait time.Duration
+	waiting := pending[:0]
+	for _, queued := range pending {
+		if queued.notBefore.After(now) {
+			if until := queued.notBefore.Sub(now); wait == 0 || until < wait {
+				wait = until
+			}
+			waiting = append(waiting, queued)
+			continue
+		}
+
+		// The agent may have changed since the job was queued, its address or PSK
+		// among others, or be gone.
+		agent, err := man.services.AgentSvc.Get([]byte(strconv.Itoa(queued.request.Agent.ID)))
+		if err != nil {
+			man.log.WithFields("job", queued.request.ID).Error("dispatch: could not get agent", err)
+			if wait == 0 || repoSlotCheck < wait {
+				wait = repoSlotCheck
 			}
-			man.log.WithFields("job", job.ID).Debug("Sending to", job.Agent.Name, "at", fmt.Sprintf("%s:%d", job.Agent.IP, job.Agent.Port))
+			waiting = append(waiting, queued)
+			continue
+		}
 
-			man.log.WithFields("job", job.ID).Debug("Request:", spew.Sdump(job))
-			_, err := man.SendRequest(job, job.Agent)
+		if agent == nil {
+			man.log.WithFields("job", queued.request.ID).Warn("Dropping job for deleted agent", queued.request.Agent.Name)
+			err = man.jobAborted(queued.request.ID)
 			if err != nil {
-				man.log.WithFields("job", job.ID).Error("Sending request returned error:", err)
-				return
+				man.log.WithFields("job", queued.request.ID).Error("dispatch:", err)
+			}
+			continue
+		}
+		queued.request.Agent = agent
+
+		if !man.reachable(queued.request.Agent) {
+			waiting = append(waiting, queued)
+			continue
+		}
+
+		if queued.repoID != 0 && !man.acquireRepo(queued.request.ID, queued.repoID, queued.request.Agent.ID, limit) {
+			// Slots of lost jobs are only freed by checking on them.
+			if wait == 0 || repoSlotCheck < wait {
+				wait = repoSlotCheck
 			}
+			waiting = append(waiting, queued)
+			continue
+		}
+
+		if queued.deferred {
+			man.clearDeferred(queued.request.ID)
+		}
+		man.send(queued.request)
+	}
+
+	return waiting, wait
+}
 
-			// agentAddr, err := net.ResolveTCPAddr("tcp4", fmt.Sprintf("%s:%d", job.Agent.IP, job.Agent.Port))
-			// if err != nil {
-			// 	man.log.WithFields("job", job.ID).Error("queueHandler: could not resolve agent address:", err)
-			// 	man.jobAborted(job.ID)
-			// 	continue
-			// }
+// acquireRepo reserves a slot on the repository for the job, failing if the
+// repository is already at the limit.
+func (man *Manager) acquireRepo(jobID string, repoID, agentID, limit int) bool {
+	man.runningMutex.Lock()
+	defer man.runningMutex.Unlock()
 
-			// conn, err := net.DialTCP("tcp4", nil, agentAddr)
-			// if err != nil {
-			// 	man.log.WithFields("job", job.ID).Error("queueHandler: could not connect to agent:", err)
-			// 	man.jobAborted(job.ID)
-			// 	continue
-			// }
-			// defer conn.Close()
+	if limit > 0 && man.repoRunning[repoID] >= limit {
+		return false
+	}
 
-			// enc := gob.NewEncoder(conn)
-			// err = enc.Encode(job)
-			// if err != nil {
-			// 	man.log.WithFields("job", job.ID).Error("queueHandler: could not encode job to connection:", err)
-			// 	man.jobAborted(job.ID)
-			// 	continue
-			// }
+	man.running[jobID] = &repoSlot{
+		repoID:   repoID,
+		agentID:  agentID,
+		acquired: time.Now(),
+	}
+	man.repoRunning[repoID]++
 
-			// man.log.WithFields("job", job.ID).Debug("successfully sent to", job.Agent.Name)
+	return true
+}
 
+func (man *Manager) send(job *entity.JobRequest) {
+	if job.Agent.Tunnel {
+		man.log.WithFields("job", job.ID).Debug("Sending to", job.Agent.Name, "over tunnel")
+	} else {
+		man.log.WithFields("job", job.ID).Debug("Sending to", job.Agent.Name, "at", net.JoinHostPort(job.Agent.IP, strconv.Itoa(job.Agent.Port)))
+	}
+
+	man.log.WithFields("job", job.ID).Debug("Request:", spew.Sdump(job))
+	_, err := man.SendRequest(job, job.Agent)
+	if err != nil {
+		man.log.WithFields("job", job.ID).Error("Sending request returned error:", err)
+
+		err = man.jobAborted(job.ID)
+		if err != nil {
+			man.log.WithFields("job", job.ID).Error("queueHandler:", err)
 		}
 	}
 }
+
+// clearDeferred drops the stored request of a deferred job about to be sent, so
+// it isn't sent again after a restart.
+func (man *Manager) clearDeferred(jobID string) {
+	man.jobsMutex.Lock()
+	defer man.jobsMutex.Unlock()
+
+	job, err := man.services.JobSvc.Get([]byte(jobID))
+	if err != nil || job == nil {
+		man.log.WithFields("job", jobID).Error("clearDeferred: could not get job", err)
+		return
+	}
+
+	job.NotBefore = time.Time{}
+	job.Deferred = nil
+
+	_, err = man.services.JobSvc.Update(job)
+	if err != nil {
+		man.log.WithFields("job", jobID).Error("clearDeferred: could not update job", err)
+	}
+}
+
+// resumeDeferred queues the deferred backup jobs that were still waiting when
+// the server stopped. Those whose agent is gone are aborted.
+func (man *Manager) resumeDeferred() {
+	jobs, err := man.services.JobSvc.GetAll()
+	if err != nil {
+		man.log.Error("resumeDeferred: could not get jobs", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if job.Done || job.Aborted || job.Type != "backup" || len(job.Deferred) == 0 {
+			continue
+		}
+
+		ok := man.requeueDeferred(job)
+		if !ok {
+			err := man.jobAborted(job.ID)
+			if err != nil {
+				man.log.WithFields("job", job.ID).Error("resumeDeferred:", err)
+			}
+			continue
+		}
+
+		man.log.WithFields("job", job.ID).Info("Resuming job deferred until", job.NotBefore)
+	}
+}
+
+func (man *Manager) requeueDeferred(job *entity.Job) bool {
+	req := &agentRequest.Backup{}
+	err := json.Unmarshal(job.Deferred, req)
+	if err != nil {
+		man.log.WithFields("job", job.ID).Error("resumeDeferred: could not decode deferred request", err)
+		return false
+	}
+
+	agent, err := man.services.AgentSvc.Get([]byte(strconv.Itoa(job.AgentID)))
+	if err != nil || agent == nil {
+		man.log.WithFields("job", job.ID).Error("resumeDeferred: could not get agent", job.AgentID, err)
+		return false
+	}
+
+	jobRequest := &entity.JobRequest{
+		ID:    job.ID,
+		Agent: agent,
+		Type:  job.Type,
+		Data:  req,
+	}
+	job.Request = jobRequest
+
+	return man.enqueueAt(jobRequest, job.NotBefore, true)
+}
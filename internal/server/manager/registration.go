@@ -0,0 +1,205 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// findRegistrationToken checks the token an agent registers with. It is either
+// the registration-token setting, which any number of agents can use, or one
+// of the registration tokens, which is returned. agent is the agent
+// re-registering, or nil for a new agent.
+//
+// Expired tokens stop every agent. A used one-time token only lets the agent
+// that used it register again, and an agent that registered with a token can
+// only register again with that one.
+func (man *Manager) findRegistrationToken(value string, agent *entity.Agent) (*entity.RegistrationToken, bool, error) {
+	if value == "" {
+		return nil, false, nil
+	}
+
+	shared := ""
+	_, err := man.getSetting("registration-token", &shared)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if shared != "" && subtle.ConstantTimeCompare([]byte(shared), []byte(value)) == 1 {
+		return nil, true, nil
+	}
+
+	tokens, err := man.services.TokenSvc.GetAll()
+	if err != nil {
+		return nil, false, fmt.Errorf("manager.findRegistrationToken: could not get registration tokens: %w", err)
+	}
+
+	for _, token := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(value)) != 1 {
+			continue
+		}
+
+		if !token.ExpiresAt.IsZero() && time.Now().After(token.ExpiresAt) {
+			return nil, false, nil
+		}
+
+		if agent != nil {
+			return token, registeredWith(agent, token), nil
+		}
+
+		if token.OneTime && token.UsedBy != 0 {
+			return nil, false, nil
+		}
+
+		return token, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// registeredWith reports whether the agent registered with the token. Agents
+// registered before their token was recorded are known by having used it.
+func registeredWith(agent *entity.Agent, token *entity.RegistrationToken) bool {
+	if agent.TokenID != 0 {
+		return agent.TokenID == token.ID
+	}
+
+	return token.UsedBy == agent.ID
+}
+
+// agentToken returns the token the agent registered with, nil if none or if it
+// was deleted.
+func (man *Manager) agentToken(agent *entity.Agent) (*entity.RegistrationToken, error) {
+	tokens, err := man.services.TokenSvc.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("manager.agentToken: could not get registration tokens: %w", err)
+	}
+
+	for _, token := range tokens {
+		if registeredWith(agent, token) {
+			return token, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// scopeLabels sets the labels of the token on the agent's labels, overriding
+// any the agent asked for.
+func scopeLabels(labels map[string]string, token *entity.RegistrationToken) map[string]string {
+	if token == nil || len(token.Labels) == 0 {
+		return labels
+	}
+
+	scoped := make(map[string]string, len(labels)+len(token.Labels))
+	for key, value := range labels {
+		scoped[key] = value
+	}
+	for key, value := range token.Labels {
+		scoped[key] = value
+	}
+
+	return scoped
+}
+
+// ValidateRegistration checks the token an existing agent re-registers with,
+// and returns its labels scoped by the token it first registered with. Those of
+// the token presented don't apply, it may be any other the agent was given. The
+// labels returned are nil if they are to stay as they are, as they do for an
+// agent whose token was deleted.
+func (man *Manager) ValidateRegistration(agent *entity.Agent, value string, labels map[string]string) (map[string]string, bool, error) {
+	man.registrationMutex.Lock()
+	defer man.registrationMutex.Unlock()
+
+	_, ok, err := man.findRegistrationToken(value, agent)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	if labels == nil {
+		return nil, true, nil
+	}
+
+	token, err := man.agentToken(agent)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if token == nil && agent.TokenID != 0 {
+		return nil, true, nil
+	}
+
+	return scopeLabels(labels, token), true, nil
+}
+
+// approvalRequired returns whether new agents wait for an admin to approve
+// them, from the registration-approval setting.
+func (man *Manager) approvalRequired() (bool, error) {
+	required := false
+	_, err := man.getSetting("registration-approval", &required)
+	if err != nil {
+		return false, err
+	}
+
+	return required, nil
+}
+
+// RegisterAgent creates the agent if the token is valid, with the labels of the
+// token and pending approval if that is required. A one-time token is used up
+// by the agent.
+func (man *Manager) RegisterAgent(agent *entity.Agent, value string) (*entity.Agent, bool, error) {
+	man.registrationMutex.Lock()
+	defer man.registrationMutex.Unlock()
+
+	token, ok, err := man.findRegistrationToken(value, nil)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	agent.Labels = scopeLabels(agent.Labels, token)
+	if token != nil {
+		agent.TokenID = token.ID
+	}
+
+	agent.Pending, err = man.approvalRequired()
+	if err != nil {
+		return nil, false, err
+	}
+
+	agent, err = man.services.AgentSvc.Create(agent)
+	if err != nil {
+		return nil, false, fmt.Errorf("manager.RegisterAgent: could not create agent: %w", err)
+	}
+
+	if token != nil && token.UsedBy == 0 {
+		token.UsedBy = agent.ID
+		token.UsedAt = time.Now()
+		_, err = man.services.TokenSvc.Update(token)
+		if err != nil {
+			return nil, false, fmt.Errorf("manager.RegisterAgent: could not update registration token: %w", err)
+		}
+	}
+
+	if agent.Pending {
+		man.log.WithFields("agent", agent.ID, "name", agent.Name).Info("Agent registered, pending approval")
+	}
+
+	return agent, true, nil
+}
+
+// ApproveAgent lets a pending agent be given jobs.
+func (man *Manager) ApproveAgent(agent *entity.Agent) (*entity.Agent, error) {
+	if !agent.Pending {
+		return agent, nil
+	}
+
+	agent.Pending = false
+	agent, err := man.services.AgentSvc.Update(agent)
+	if err != nil {
+		return nil, fmt.Errorf("manager.ApproveAgent: could not update agent: %w", err)
+	}
+
+	return agent, nil
+}
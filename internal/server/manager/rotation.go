@@ -0,0 +1,221 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/agent/api/request"
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// rotationCheckInterval is how often agents are checked for a PSK that is due
+// to be rotated, or a rotation that didn't finish.
+const rotationCheckInterval = time.Hour
+
+// GeneratePSK returns a new random PSK.
+func GeneratePSK() (string, error) {
+	bytes := make([]byte, 64)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// rotationInterval returns how old a PSK may get before it is rotated, from the
+// psk-rotation-interval setting. Zero means PSKs are only rotated on demand.
+func (man *Manager) rotationInterval() (time.Duration, error) {
+	value := ""
+	ok, err := man.getSetting("psk-rotation-interval", &value)
+	if err != nil {
+		return 0, err
+	}
+
+	if !ok || value == "" {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("manager.rotationInterval: invalid psk-rotation-interval %q", value)
+	}
+
+	return interval, nil
+}
+
+// RotatePSK gives the agent a new PSK in two phases, so requests in either
+// direction keep working throughout. First the agent is sent the next PSK,
+// which it accepts from then on alongside the current one. Then it is told to
+// switch, while the server still accepts both, and only once it has the
+// server drops the old PSK. A rotation that fails after the first phase is
+// finished by the next one.
+func (man *Manager) RotatePSK(agent *entity.Agent) (*entity.Agent, error) {
+	man.rotationMutex.Lock()
+	defer man.rotationMutex.Unlock()
+
+	if agent.NextPSK == "" {
+		psk, err := GeneratePSK()
+		if err != nil {
+			return nil, fmt.Errorf("manager.RotatePSK: could not generate PSK: %w", err)
+		}
+
+		// The next PSK is saved first, so the agent is never left with one the
+		// server doesn't know.
+		agent.NextPSK = psk
+		agent, err = man.services.AgentSvc.Update(agent)
+		if err != nil {
+			return nil, fmt.Errorf("manager.RotatePSK: could not update agent: %w", err)
+		}
+
+		err = man.sendPSK(agent, agent.PSK, "/psk", agent.NextPSK)
+		if err != nil {
+			agent.NextPSK = ""
+			_, updateErr := man.services.AgentSvc.Update(agent)
+			if updateErr != nil {
+				man.log.WithFields("agent", agent.ID).Error("could not clear next PSK:", updateErr)
+			}
+			return nil, fmt.Errorf("manager.RotatePSK: could not prepare PSK: %w", err)
+		}
+	}
+
+	err := man.sendPSK(agent, agent.NextPSK, "/psk/commit", agent.NextPSK)
+	if err != nil {
+		// An agent that lost the next PSK, as by registering again, never takes
+		// it, so the next rotation starts over with a new one.
+		if errors.Is(err, errRejected) {
+			agent.NextPSK = ""
+			_, updateErr := man.services.AgentSvc.Update(agent)
+			if updateErr != nil {
+				man.log.WithFields("agent", agent.ID).Error("could not clear next PSK:", updateErr)
+			}
+		}
+		return nil, fmt.Errorf("manager.RotatePSK: could not commit PSK: %w", err)
+	}
+
+	agent.PSK = agent.NextPSK
+	agent.NextPSK = ""
+	agent.PSKRotatedAt = time.Now()
+	agent, err = man.services.AgentSvc.Update(agent)
+	if err != nil {
+		return nil, fmt.Errorf("manager.RotatePSK: could not update agent: %w", err)
+	}
+
+	man.log.WithFields("agent", agent.ID).Info("Rotated PSK of agent", agent.Name)
+
+	return agent, nil
+}
+
+// promotePSK makes the next PSK the agent's PSK once the agent was found to use
+// it, finishing a rotation whose commit the server never heard back from.
+func (man *Manager) promotePSK(agentID int, psk string) {
+	agent, err := man.services.AgentSvc.Get([]byte(strconv.Itoa(agentID)))
+	if err != nil || agent == nil {
+		man.log.WithFields("agent", agentID).Error("promotePSK: could not get agent", err)
+		return
+	}
+
+	if agent.NextPSK != psk {
+		return
+	}
+
+	agent.PSK = psk
+	agent.NextPSK = ""
+	agent.PSKRotatedAt = time.Now()
+	_, err = man.services.AgentSvc.Update(agent)
+	if err != nil {
+		man.log.WithFields("agent", agentID).Error("promotePSK: could not update agent", err)
+		return
+	}
+
+	man.log.WithFields("agent", agentID).Info("Finished rotating PSK of agent", agent.Name)
+}
+
+// errRejected is returned by sendPSK when the agent answered, but refused.
+var errRejected = errors.New("rejected by agent")
+
+// sendPSK sends one phase of a rotation to the agent, authenticated with the
+// given PSK.
+func (man *Manager) sendPSK(agent *entity.Agent, auth, endpoint, psk string) error {
+	msg, err := json.Marshal(request.PSK{PSK: psk})
+	if err != nil {
+		return err
+	}
+
+	authed := *agent
+	authed.PSK = auth
+
+	var status int
+	var body []byte
+	if agent.Tunnel {
+		status, body, err = man.sendTunnel(&authed, "POST", "/api"+endpoint, msg)
+	} else {
+		status, body, err = man.sendHTTP(&authed, "POST", endpoint, msg)
+	}
+	if err != nil {
+		return err
+	}
+
+	if status > 299 {
+		return fmt.Errorf("%w with status %d: %s", errRejected, status, string(body))
+	}
+
+	return nil
+}
+
+// rotationHandler rotates PSKs as they come due and finishes rotations that
+// were interrupted.
+func (man *Manager) rotationHandler() {
+	ticker := time.NewTicker(rotationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		man.rotateDue()
+
+		select {
+		case <-man.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (man *Manager) rotateDue() {
+	interval, err := man.rotationInterval()
+	if err != nil {
+		man.log.WithFields("function", "rotateDue").Error(err)
+		return
+	}
+
+	agents, err := man.services.AgentSvc.GetAll()
+	if err != nil {
+		man.log.WithFields("function", "rotateDue").Error("could not get agents:", err)
+		return
+	}
+
+	err = man.SetAgentStatus(agents...)
+	if err != nil {
+		man.log.WithFields("function", "rotateDue").Error(err)
+		return
+	}
+
+	for _, agent := range agents {
+		due := interval > 0 && time.Since(agent.PSKRotatedAt) >= interval
+		if !due && agent.NextPSK == "" {
+			continue
+		}
+
+		// Agents that are away get their turn once they are back.
+		if agent.Status == entity.AgentOffline || !man.reachable(agent) {
+			continue
+		}
+
+		_, err := man.RotatePSK(agent)
+		if err != nil {
+			man.log.WithFields("function", "rotateDue", "agent", agent.ID).Warn("could not rotate PSK:", err)
+		}
+	}
+}
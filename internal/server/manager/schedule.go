@@ -2,168 +2,328 @@ package server
 
 import (
 	"fmt"
+	"math/rand"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/robfig/cron/v3"
 	agentRequest "zerosrealm.xyz/tergum/internal/agent/api/request"
 	"zerosrealm.xyz/tergum/internal/entity"
 )
 
-type schedule struct {
-	BackupID  int
-	Schedule  string
-	Scheduler *cron.Cron
+// catchUp starts the runs of the backup's schedules that were missed while the
+// server was down, as their catch-up policies allow. A schedule that missed
+// several runs still only runs once.
+func (man *Manager) catchUp(backup *entity.Backup, now time.Time) {
+	for _, sch := range backup.Schedules {
+		missed, ok := missedRun(backup, sch, now)
+		if !ok {
+			continue
+		}
+
+		switch sch.CatchUp {
+		case "once":
+		case "overdue":
+			after, _ := time.ParseDuration(sch.CatchUpAfter)
+			if now.Sub(missed) <= after {
+				continue
+			}
+		default:
+			man.log.WithFields("backup", backup.ID, "schedule", sch.Name).Debug("Skipping run missed at", missed)
+			continue
+		}
+
+		man.log.WithFields("backup", backup.ID, "schedule", sch.Name).Info("Catching up on run missed at", missed)
+		_, err := man.startBackup(backup.ID, sch, true)
+		if err != nil {
+			man.log.WithFields("backup", backup.ID, "schedule", sch.Name).Error("catchUp: could not start backup", err)
+		}
+	}
+}
+
+// missedRun returns the first run of the schedule after its last run, if that run
+// is already in the past. Schedules that have never run have nothing to catch up.
+func missedRun(backup *entity.Backup, sch *entity.Schedule, now time.Time) (time.Time, bool) {
+	lastRun := sch.LastRun
+	if lastRun.IsZero() {
+		lastRun = backup.LastRun
+	}
+
+	if lastRun.IsZero() {
+		return time.Time{}, false
+	}
+
+	spec, err := ParseSchedule(sch)
+	if err != nil {
+		return time.Time{}, false
+	}
 
-	manager *Manager
+	parsed, err := cron.ParseStandard(spec)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	next := parsed.Next(lastRun)
+	if next.IsZero() || !next.Before(now) {
+		return time.Time{}, false
+	}
+
+	return next, true
 }
 
-var schedules = []*schedule{}
+// ParseSchedule validates the cron expression and time zone of the schedule and
+// returns the spec to give the cron scheduler. Schedules without a time zone run
+// in the server's local time.
+func ParseSchedule(sch *entity.Schedule) (string, error) {
+	spec := sch.Cron
+	if sch.TimeZone != "" {
+		_, err := time.LoadLocation(sch.TimeZone)
+		if err != nil {
+			return "", fmt.Errorf("invalid time zone %q: %w", sch.TimeZone, err)
+		}
+		spec = fmt.Sprintf("CRON_TZ=%s %s", sch.TimeZone, sch.Cron)
+	}
 
-func (man *Manager) BuildSchedules() {
-	man.log.Debug("Building schedules")
-	backups, err := man.services.BackupSvc.GetAll()
+	_, err := cron.ParseStandard(spec)
 	if err != nil {
-		man.log.Error("buildSchedules: could not get backups", err)
-		return
+		return "", fmt.Errorf("invalid cron schedule %q: %w", sch.Cron, err)
 	}
 
-	for _, backup := range backups {
-		man.log.Debug("Adding schedule for backup", fmt.Sprintf("#%d", backup.ID))
-		man.AddSchedule(backup.Schedule, backup.ID)
+	_, err = scheduleJitter(sch)
+	if err != nil {
+		return "", err
 	}
+
+	switch sch.CatchUp {
+	case "", "skip", "once":
+	case "overdue":
+		after, err := time.ParseDuration(sch.CatchUpAfter)
+		if err != nil || after < 0 {
+			return "", fmt.Errorf("invalid catch-up delay %q", sch.CatchUpAfter)
+		}
+	default:
+		return "", fmt.Errorf("invalid catch-up policy %q", sch.CatchUp)
+	}
+
+	return spec, nil
 }
 
-func (schedule *schedule) Start() ([]*entity.Job, error) {
-	backup, err := schedule.manager.services.BackupSvc.Get([]byte(strconv.Itoa(schedule.BackupID)))
+// NextRuns returns the next n times the schedule fires after from.
+func NextRuns(sch *entity.Schedule, from time.Time, n int) ([]time.Time, error) {
+	spec, err := ParseSchedule(sch)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := cron.ParseStandard(spec)
 	if err != nil {
 		return nil, err
 	}
 
-	schedule.manager.log.WithFields("backup", backup.ID).Debug("Starting backup")
+	runs := make([]time.Time, 0, n)
+	next := from
+	for i := 0; i < n; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		runs = append(runs, next)
+	}
+
+	return runs, nil
+}
+
+// scheduleJitter returns the jitter window of the schedule, 0 if it has none.
+func scheduleJitter(sch *entity.Schedule) (time.Duration, error) {
+	if sch.Jitter == "" {
+		return 0, nil
+	}
+
+	jitter, err := time.ParseDuration(sch.Jitter)
+	if err != nil {
+		return 0, fmt.Errorf("invalid jitter %q: %w", sch.Jitter, err)
+	}
+
+	if jitter < 0 {
+		return 0, fmt.Errorf("invalid jitter %q: must not be negative", sch.Jitter)
+	}
+
+	return jitter, nil
+}
+
+var (
+	jitterRand  = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterMutex sync.Mutex
+)
+
+// randomDelay returns a random delay in [0, window).
+func randomDelay(window time.Duration) time.Duration {
+	if window <= 0 {
+		return 0
+	}
+
+	jitterMutex.Lock()
+	defer jitterMutex.Unlock()
 
-	subcribers, err := schedule.manager.services.BackupSubSvc.Get([]byte(strconv.Itoa(schedule.BackupID)))
+	return time.Duration(jitterRand.Int63n(int64(window)))
+}
+
+// StartBackup creates a backup job for every agent subscribed to the backup. The
+// schedule is optional and adds its tags and options to the jobs when given.
+func (man *Manager) StartBackup(backupID int, sch *entity.Schedule) ([]*entity.Job, error) {
+	return man.startBackup(backupID, sch, false)
+}
+
+// startBackup creates the backup jobs. Only scheduled runs are spread out by the
+// schedule's jitter, manual runs are sent straight away.
+func (man *Manager) startBackup(backupID int, sch *entity.Schedule, scheduled bool) ([]*entity.Job, error) {
+	var jitter time.Duration
+	if scheduled && sch != nil {
+		var err error
+		jitter, err = scheduleJitter(sch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	backup, err := man.services.BackupSvc.Get([]byte(strconv.Itoa(backupID)))
 	if err != nil {
 		return nil, err
 	}
 
-	if subcribers == nil || len(subcribers.AgentIDs) == 0 {
-		schedule.manager.log.WithFields("backup", backup.ID).Debug("No subscribers, skipping backup")
+	if backup == nil {
+		return nil, fmt.Errorf("manager.StartBackup: no backup with ID %d", backupID)
+	}
+
+	// Pauses only hold back scheduled runs, so a backup can still be run by hand.
+	if scheduled {
+		paused, err := man.SchedulesPaused()
+		if err != nil {
+			return nil, err
+		}
+
+		if paused || BackupPaused(backup, time.Now()) {
+			man.log.WithFields("backup", backup.ID).Debug("Schedules paused, skipping backup")
+			return nil, nil
+		}
+	}
+
+	man.log.WithFields("backup", backup.ID).Debug("Starting backup")
+
+	agents, err := man.BackupAgents(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(agents) == 0 {
+		man.log.WithFields("backup", backup.ID).Debug("No subscribers, skipping backup")
 		return nil, nil
 	}
 
-	agents := make([]*entity.Agent, 0)
-	for _, agentID := range subcribers.AgentIDs {
-		agent, err := schedule.manager.services.AgentSvc.Get([]byte(strconv.Itoa(agentID)))
+	// Blackouts and offline agents only hold back scheduled runs, a manual run is
+	// always sent.
+	var blackouts []*entity.Blackout
+	var skipOffline bool
+	if scheduled {
+		blackouts, err = man.services.BlackoutSvc.GetAll()
 		if err != nil {
-			schedule.manager.log.WithFields("backup", backup.ID).Error("schedule.Start: could not get agent", err)
-			continue
+			return nil, err
 		}
 
-		if agent == nil {
-			schedule.manager.log.WithFields("backup", backup.ID).Error("schedule.Start: no agent found with ID defined as backup subscriber")
-			continue
+		skipOffline, err = man.skipOffline()
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	err = man.SetAgentStatus(agents...)
+	if err != nil {
+		return nil, err
+	}
 
-		agents = append(agents, agent)
+	refuseUnsupported, err := man.refuseUnsupported()
+	if err != nil {
+		return nil, err
 	}
 
+	now := time.Now()
 	jobs := []*entity.Job{}
 	for _, agent := range agents {
+		if agent.Pending {
+			man.log.WithFields("backup", backup.ID).Info("Skipping agent", agent.Name, "pending approval")
+			continue
+		}
+
+		if scheduled && AgentPaused(agent, now) {
+			man.log.WithFields("backup", backup.ID).Debug("Schedules paused on agent", agent.Name, "skipping")
+			continue
+		}
+
+		if agent.Status == entity.AgentOffline {
+			if scheduled && skipOffline {
+				man.log.WithFields("backup", backup.ID).Info("Skipping offline agent", agent.Name, "last seen at", agent.LastSeen)
+				continue
+			}
+			man.log.WithFields("backup", backup.ID).Warn("Agent", agent.Name, "is offline, last seen at", agent.LastSeen)
+		}
+
+		agentBlackouts := filterBlackouts(blackouts, agent.ID, backup.Target)
+		start, ok := deferBlackouts(agentBlackouts, now)
+		if !ok {
+			man.log.WithFields("backup", backup.ID).Info("Skipping run for agent", agent.Name, "during blackout")
+			continue
+		}
+
 		target := strconv.Itoa(backup.Target)
-		repo, err := schedule.manager.services.RepoSvc.Get([]byte(target))
+		repo, err := man.services.RepoSvc.Get([]byte(target))
 		if err != nil {
-			schedule.manager.log.WithFields("backup", backup.ID).Error("schedule.Start: could not get repos", err)
+			man.log.WithFields("backup", backup.ID).Error("manager.StartBackup: could not get repos", err)
 			continue
 		}
 
 		if repo == nil {
-			// log.Println("No repo found with ID defined in backup target")
-			schedule.manager.log.WithFields("backup", backup.ID).Error("schedule.Start: no repo found with ID defined in backup target")
+			man.log.WithFields("backup", backup.ID).Error("manager.StartBackup: no repo found with ID defined in backup target")
 			break
 		}
 
+		rendered, err := RenderBackup(backup, agent)
+		if err != nil {
+			man.log.WithFields("backup", backup.ID).Error("manager.StartBackup: could not render backup for agent", agent.Name, err)
+			continue
+		}
+
+		agentSch, dropped, err := agentSchedule(sch, agent, refuseUnsupported)
+		if err != nil {
+			man.log.WithFields("backup", backup.ID).Error("manager.StartBackup: refusing job for agent", agent.Name, err)
+			continue
+		}
+
+		if len(dropped) != 0 {
+			man.log.WithFields("backup", backup.ID).Warn("Dropping options", dropped, "unsupported by restic", agent.ResticVersion, "on agent", agent.Name)
+		}
+
 		backupReq := &agentRequest.Backup{
-			Repo:   repo,
-			Backup: backup,
+			Repo:     repo,
+			Backup:   rendered,
+			Schedule: agentSch,
 		}
 		jobRequest := &entity.JobRequest{
 			Type:  "backup",
 			Agent: agent,
-			// Repo:  repo,
 
 			Data: backupReq,
 		}
 
-		job, err := schedule.manager.NewJob(jobRequest)
+		delay := start.Sub(now) + randomDelay(clampJitter(agentBlackouts, start, jitter))
+		job, err := man.newJob(jobRequest, delay)
 		if err != nil {
-			schedule.manager.log.WithFields("backup", backup.ID).Error("schedule.Start: could not create new job", err)
+			man.log.WithFields("backup", backup.ID).Error("manager.StartBackup: could not create new job", err)
 			return nil, err
 		}
-		schedule.manager.log.WithFields("backup", backup.ID).Debug("Enqueuing job", job.ID, "for agent", agent.Name)
+		man.log.WithFields("backup", backup.ID).Debug("Enqueuing job", job.ID, "for agent", agent.Name)
 		jobs = append(jobs, job)
 	}
 
 	return jobs, nil
 }
-
-func GetSchedule(backupID int) *schedule {
-	for _, sch := range schedules {
-		if sch.BackupID == backupID {
-			return sch
-		}
-	}
-	return nil
-}
-
-func GetSchedules(cronSchedule string) []*schedule {
-	matches := []*schedule{}
-	for _, sch := range schedules {
-		if sch.Schedule == cronSchedule {
-			matches = append(matches, sch)
-		}
-	}
-	return matches
-}
-
-func (man *Manager) AddSchedule(cronSchedule string, backupID int) *schedule {
-	schedule := schedule{
-		BackupID: backupID,
-		manager:  man,
-	}
-
-	schedule.NewScheduler(cronSchedule)
-	schedules = append(schedules, &schedule)
-
-	return &schedule
-}
-
-func (sch *schedule) NewScheduler(cronSchedule string) {
-	if sch.Scheduler != nil {
-		sch.Scheduler.Stop()
-	}
-	sch.Schedule = cronSchedule
-
-	scheduler := cron.New()
-	sch.Scheduler = scheduler
-
-	scheduler.AddFunc(sch.Schedule, func() {
-		sch.Start()
-	})
-
-	scheduler.Start()
-}
-
-func StopSchedulers() {
-	for _, schedule := range schedules {
-		schedule.Scheduler.Stop()
-	}
-}
-
-func RemoveSchedule(backupID int) {
-	for i, schedule := range schedules {
-		if schedule.BackupID == backupID {
-			schedule.Scheduler.Stop()
-			schedules = append(schedules[:i], schedules[i+1:]...)
-		}
-	}
-}
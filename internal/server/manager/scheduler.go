@@ -0,0 +1,250 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// Scheduler runs the schedules of every backup on a single cron instance. Backup
+// changes must go through it so the cron entries match what is stored, and so
+// they don't overwrite the run times it records or have them overwritten.
+type Scheduler struct {
+	manager *Manager
+	cron    *cron.Cron
+
+	mutex sync.Mutex
+	// entries of each backup, by schedule name.
+	entries map[int]map[string]cron.EntryID
+}
+
+func newScheduler(man *Manager) *Scheduler {
+	return &Scheduler{
+		manager: man,
+		cron:    cron.New(),
+		entries: make(map[int]map[string]cron.EntryID),
+	}
+}
+
+// Start registers the schedules of all stored backups, catches up on runs missed
+// while the server was down and starts running them.
+func (s *Scheduler) Start() {
+	man := s.manager
+	man.log.Debug("Building schedules")
+
+	backups, err := man.services.BackupSvc.GetAll()
+	if err != nil {
+		man.log.Error("scheduler.Start: could not get backups", err)
+		return
+	}
+
+	// Catch-up has to look at the last runs before they are overwritten.
+	now := time.Now()
+	for _, backup := range backups {
+		man.catchUp(backup, now)
+	}
+
+	for _, backup := range backups {
+		man.log.Debug("Adding schedules for backup", fmt.Sprintf("#%d", backup.ID))
+		err := s.Set(backup)
+		if err != nil {
+			man.log.WithFields("backup", backup.ID).Error("scheduler.Start: could not set schedules", err)
+		}
+	}
+
+	s.cron.Start()
+}
+
+// Stop the scheduler, waiting for runs in progress to be queued.
+func (s *Scheduler) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// Set replaces the cron entries of the backup with its current schedules and
+// records when each of them runs next.
+func (s *Scheduler) Set(backup *entity.Backup) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.set(backup)
+}
+
+// Update applies the change to the backup as currently stored, saves it and
+// reschedules it. It returns nil if there is no backup with the ID.
+func (s *Scheduler) Update(backupID int, change func(backup *entity.Backup)) (*entity.Backup, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	backup, err := s.manager.services.BackupSvc.Get([]byte(strconv.Itoa(backupID)))
+	if err != nil {
+		return nil, fmt.Errorf("scheduler.Update: could not get backup: %w", err)
+	}
+
+	if backup == nil {
+		return nil, nil
+	}
+
+	change(backup)
+
+	backup, err = s.manager.services.BackupSvc.Update(backup)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler.Update: could not update backup: %w", err)
+	}
+
+	err = s.set(backup)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler.Update: could not schedule backup: %w", err)
+	}
+
+	return backup, nil
+}
+
+// set replaces the cron entries of the backup. The caller must hold the mutex.
+func (s *Scheduler) set(backup *entity.Backup) error {
+	s.remove(backup.ID)
+
+	entries := make(map[string]cron.EntryID, len(backup.Schedules))
+	for _, sch := range backup.Schedules {
+		spec, err := ParseSchedule(sch)
+		if err != nil {
+			s.entries[backup.ID] = entries
+			return err
+		}
+
+		backupID, name := backup.ID, sch.Name
+		id, err := s.cron.AddFunc(spec, func() {
+			s.run(backupID, name)
+		})
+		if err != nil {
+			s.entries[backup.ID] = entries
+			return err
+		}
+		entries[sch.Name] = id
+	}
+	s.entries[backup.ID] = entries
+
+	return s.recordNextRuns(backup.ID)
+}
+
+// Remove the cron entries of the backup.
+func (s *Scheduler) Remove(backupID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.remove(backupID)
+}
+
+func (s *Scheduler) remove(backupID int) {
+	for _, id := range s.entries[backupID] {
+		s.cron.Remove(id)
+	}
+	delete(s.entries, backupID)
+}
+
+// run starts the named schedule of the backup. The backup is read again so the
+// run uses the schedule as currently stored.
+func (s *Scheduler) run(backupID int, name string) {
+	man := s.manager
+
+	backup, err := man.services.BackupSvc.Get([]byte(strconv.Itoa(backupID)))
+	if err != nil || backup == nil {
+		man.log.WithFields("backup", backupID, "schedule", name).Error("scheduler.run: could not get backup", err)
+		return
+	}
+
+	var sch *entity.Schedule
+	for _, candidate := range backup.Schedules {
+		if candidate.Name == name {
+			sch = candidate
+		}
+	}
+
+	if sch == nil {
+		man.log.WithFields("backup", backupID, "schedule", name).Warn("scheduler.run: schedule no longer exists")
+		return
+	}
+
+	_, err = man.startBackup(backupID, sch, true)
+	if err != nil {
+		man.log.WithFields("backup", backupID, "schedule", name).Error("scheduler.run: could not start scheduled backup", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err = s.recordNextRuns(backupID)
+	if err != nil {
+		man.log.WithFields("backup", backupID, "schedule", name).Error("scheduler.run:", err)
+	}
+}
+
+// recordLastRun stores that the backup, and the schedule that started it if
+// any, ran at t.
+func (s *Scheduler) recordLastRun(backupID int, sch *entity.Schedule, t time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	backup, err := s.manager.services.BackupSvc.Get([]byte(strconv.Itoa(backupID)))
+	if err != nil {
+		return fmt.Errorf("scheduler.recordLastRun: could not get backup: %w", err)
+	}
+
+	if backup == nil {
+		return nil
+	}
+
+	backup.LastRun = t
+	if sch != nil {
+		for _, stored := range backup.Schedules {
+			if stored.Name == sch.Name {
+				stored.LastRun = t
+			}
+		}
+	}
+
+	_, err = s.manager.services.BackupSvc.Update(backup)
+	if err != nil {
+		return fmt.Errorf("scheduler.recordLastRun: could not update backup: %w", err)
+	}
+
+	return nil
+}
+
+// recordNextRuns stores the next run of each of the backup's schedules. The
+// caller must hold the mutex.
+func (s *Scheduler) recordNextRuns(backupID int) error {
+	backup, err := s.manager.services.BackupSvc.Get([]byte(strconv.Itoa(backupID)))
+	if err != nil {
+		return fmt.Errorf("scheduler.recordNextRuns: could not get backup: %w", err)
+	}
+
+	if backup == nil {
+		return nil
+	}
+
+	now := time.Now()
+	for _, sch := range backup.Schedules {
+		sch.NextRun = time.Time{}
+
+		if _, ok := s.entries[backupID][sch.Name]; !ok {
+			continue
+		}
+
+		runs, err := NextRuns(sch, now, 1)
+		if err != nil || len(runs) == 0 {
+			continue
+		}
+		sch.NextRun = runs[0]
+	}
+
+	_, err = s.manager.services.BackupSvc.Update(backup)
+	if err != nil {
+		return fmt.Errorf("scheduler.recordNextRuns: could not update backup: %w", err)
+	}
+
+	return nil
+}
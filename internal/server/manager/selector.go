@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// Selector matches agents by their labels. It is written as comma separated
+// requirements, all of which must hold:
+//
+//	env=prod     the label env is prod
+//	env!=prod    the label env is missing or not prod
+//	role         the label role is set
+//	!role        the label role is not set
+type Selector []selectorRequirement
+
+type selectorRequirement struct {
+	key   string
+	op    string
+	value string
+}
+
+// ParseSelector parses a label selector. An empty selector matches no agents.
+func ParseSelector(selector string) (Selector, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return nil, nil
+	}
+
+	parsed := make(Selector, 0)
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+
+		var req selectorRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			req = selectorRequirement{key: kv[0], op: "!=", value: kv[1]}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(strings.Replace(part, "==", "=", 1), "=", 2)
+			req = selectorRequirement{key: kv[0], op: "=", value: kv[1]}
+		case strings.HasPrefix(part, "!"):
+			req = selectorRequirement{key: part[1:], op: "!"}
+		default:
+			req = selectorRequirement{key: part, op: "exists"}
+		}
+
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+
+		err := ValidateLabel(req.key, req.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", part, err)
+		}
+
+		parsed = append(parsed, req)
+	}
+
+	return parsed, nil
+}
+
+// Matches reports whether the labels satisfy every requirement of the selector.
+func (s Selector) Matches(labels map[string]string) bool {
+	if len(s) == 0 {
+		return false
+	}
+
+	for _, req := range s {
+		value, ok := labels[req.key]
+		switch req.op {
+		case "=":
+			if !ok || value != req.value {
+				return false
+			}
+		case "!=":
+			if ok && value == req.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!":
+			if ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// ValidateLabel checks that a label can be used in selectors.
+func ValidateLabel(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("label key can not be empty")
+	}
+
+	if strings.ContainsAny(key, "=!, ") {
+		return fmt.Errorf("label key %q can not contain '=', '!', ',' or spaces", key)
+	}
+
+	if strings.ContainsAny(value, "=!,") {
+		return fmt.Errorf("label value %q can not contain '=', '!' or ','", value)
+	}
+
+	return nil
+}
+
+// ValidateLabels checks every label of an agent.
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		err := ValidateLabel(key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BackupAgents returns the agents the backup runs on: its explicit subscribers
+// and every agent matching its label selector.
+func (man *Manager) BackupAgents(backup *entity.Backup) ([]*entity.Agent, error) {
+	selector, err := ParseSelector(backup.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribers, err := man.services.BackupSubSvc.Get([]byte(fmt.Sprint(backup.ID)))
+	if err != nil {
+		return nil, err
+	}
+
+	subscribed := make(map[int]bool)
+	if subscribers != nil {
+		for _, agentID := range subscribers.AgentIDs {
+			subscribed[agentID] = true
+		}
+	}
+
+	if len(subscribed) == 0 && len(selector) == 0 {
+		return nil, nil
+	}
+
+	// TODO: Optimize with filters.
+	all, err := man.services.AgentSvc.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]*entity.Agent, 0)
+	for _, agent := range all {
+		if subscribed[agent.ID] || selector.Matches(agent.Labels) {
+			agents = append(agents, agent)
+			delete(subscribed, agent.ID)
+		}
+	}
+
+	for agentID := range subscribed {
+		man.log.WithFields("backup", backup.ID).Error("manager.BackupAgents: no agent found with ID", agentID, "defined as backup subscriber")
+	}
+
+	return agents, nil
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+const (
+	// SessionCookie is the name of the cookie holding the session token.
+	SessionCookie = "tergum_session"
+
+	// sessionTimeout is how long a session lasts without being used.
+	sessionTimeout = 24 * time.Hour
+)
+
+// dummyHash is compared against when logging in as a user that doesn't exist,
+// so that takes as long as a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("tergum"), bcrypt.DefaultCost)
+
+// session of a logged in user. Sessions are only kept in memory, so users log
+// in again after the server restarts.
+type session struct {
+	userID  int
+	expires time.Time
+}
+
+type sessions struct {
+	mutex    sync.Mutex
+	sessions map[string]*session
+}
+
+// HashPassword returns the bcrypt hash of the password.
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("manager.HashPassword: empty password")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("manager.HashPassword: %w", err)
+	}
+
+	return string(hash), nil
+}
+
+func randomToken(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// BootstrapAdmin creates the first user when there are none. Without a
+// password one is generated, and written once to the file, or to stdout without
+// one, so it stays out of the logs.
+func (man *Manager) BootstrapAdmin(username, password, passwordFile string) error {
+	users, err := man.services.UserSvc.GetAll()
+	if err != nil {
+		return fmt.Errorf("manager.BootstrapAdmin: could not get users: %w", err)
+	}
+
+	if len(users) > 0 {
+		return nil
+	}
+
+	generated := password == ""
+	if generated {
+		password, err = randomToken(12)
+		if err != nil {
+			return fmt.Errorf("manager.BootstrapAdmin: could not generate password: %w", err)
+		}
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// The file is written before the user is created, so a user whose password
+	// got lost isn't left behind.
+	if generated && passwordFile != "" {
+		err = writePassword(passwordFile, password)
+		if err != nil {
+			return fmt.Errorf("manager.BootstrapAdmin: could not write password: %w", err)
+		}
+	}
+
+	_, err = man.services.UserSvc.Create(&entity.User{
+		Username:  username,
+		Password:  hash,
+		CreatedAt: time.Now(),
+		Role:      entity.RoleAdmin,
+	})
+	if err != nil {
+		if generated && passwordFile != "" {
+			os.Remove(passwordFile)
+		}
+		return fmt.Errorf("manager.BootstrapAdmin: could not create user: %w", err)
+	}
+
+	switch {
+	case !generated:
+		man.log.Info("Created user", username)
+	case passwordFile != "":
+		man.log.Info("Created user", username, "- password written to", passwordFile)
+	default:
+		fmt.Fprintf(os.Stdout, "Created user %s with password %s - change it after logging in\n", username, password)
+		man.log.Info("Created user", username, "- password written to stdout")
+	}
+
+	return nil
+}
+
+// writePassword writes the password to a new file only the owner can read.
+func writePassword(name, password string) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(file, password)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Login checks the username and password of a login from the address, and
+// starts a session for the user. The session token is returned, or nil for the
+// user if the credentials are wrong. ErrLoginThrottled is returned without
+// checking them after too many failed logins.
+func (man *Manager) Login(username, password, address string) (*entity.User, string, error) {
+	if !man.logins.allowed(username, address) {
+		return nil, "", ErrLoginThrottled
+	}
+
+	user, err := man.services.UserSvc.GetByUsername(username)
+	if err != nil {
+		return nil, "", fmt.Errorf("manager.Login: could not get user: %w", err)
+	}
+
+	hash := dummyHash
+	if user != nil {
+		hash = []byte(user.Password)
+	}
+
+	err = bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if user == nil || err != nil {
+		man.logins.fail(username, address)
+		return nil, "", nil
+	}
+	man.logins.succeed(username)
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("manager.Login: could not generate session token: %w", err)
+	}
+
+	man.sessions.mutex.Lock()
+	defer man.sessions.mutex.Unlock()
+
+	now := time.Now()
+	for key, s := range man.sessions.sessions {
+		if now.After(s.expires) {
+			delete(man.sessions.sessions, key)
+		}
+	}
+
+	man.sessions.sessions[token] = &session{
+		userID:  user.ID,
+		expires: now.Add(sessionTimeout),
+	}
+
+	return user, token, nil
+}
+
+// CheckPassword reports whether the password is the user's, as when users
+// change their password. Wrong passwords count as failed logins from the
+// address, so a session can't be used to guess the password either.
+func (man *Manager) CheckPassword(user *entity.User, password, address string) (bool, error) {
+	if !man.logins.allowed(user.Username, address) {
+		return false, ErrLoginThrottled
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		man.logins.fail(user.Username, address)
+		return false, nil
+	}
+	man.logins.succeed(user.Username)
+
+	return true, nil
+}
+
+// Logout ends the session and closes its websockets.
+func (man *Manager) Logout(token string) {
+	man.sessions.mutex.Lock()
+	delete(man.sessions.sessions, token)
+	man.sessions.mutex.Unlock()
+
+	man.closeWS(func(client *wsClient) bool {
+		return client.session == token
+	})
+}
+
+// EndSessions logs the user out everywhere but the session keep, as when the
+// user is deleted or their password changed, and closes their websockets.
+func (man *Manager) EndSessions(userID int, keep string) {
+	man.sessions.mutex.Lock()
+	for token, s := range man.sessions.sessions {
+		if s.userID == userID && token != keep {
+			delete(man.sessions.sessions, token)
+		}
+	}
+	man.sessions.mutex.Unlock()
+
+	man.closeWS(func(client *wsClient) bool {
+		return client.userID == userID && client.session != keep
+	})
+}
+
+// sessionOf reports whether the token is a session of the user that hasn't
+// expired. Unlike SessionUser it doesn't keep the session from expiring, as
+// messages sent to the user's websocket aren't the user using it.
+func (man *Manager) sessionOf(token string, userID int) bool {
+	man.sessions.mutex.Lock()
+	defer man.sessions.mutex.Unlock()
+
+	s, ok := man.sessions.sessions[token]
+	return ok && s.userID == userID && time.Now().Before(s.expires)
+}
+
+// SessionUser returns the user whose session the token is, nil if it is not a
+// session or has expired. Using a session keeps it from expiring.
+func (man *Manager) SessionUser(token string) (*entity.User, error) {
+	man.sessions.mutex.Lock()
+	s, ok := man.sessions.sessions[token]
+	if ok && time.Now().After(s.expires) {
+		delete(man.sessions.sessions, token)
+		ok = false
+	}
+	if ok {
+		s.expires = time.Now().Add(sessionTimeout)
+	}
+	man.sessions.mutex.Unlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	user, err := man.services.UserSvc.Get([]byte(strconv.Itoa(s.userID)))
+	if err != nil {
+		return nil, fmt.Errorf("manager.SessionUser: could not get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// RequestUser returns the user whose session cookie the request has, nil if it
+// has none or the session is over.
+func (man *Manager) RequestUser(r *http.Request) (*entity.User, error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+
+	return man.SessionUser(cookie.Value)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// getSetting unmarshals the value of the setting into v. It returns false if the
+// setting does not exist, leaving v untouched.
+func (man *Manager) getSetting(key string, v interface{}) (bool, error) {
+	setting, err := man.services.SettingSvc.Get([]byte(key))
+	if err != nil {
+		return false, fmt.Errorf("manager.getSetting: could not get setting %s: %w", key, err)
+	}
+
+	if setting == nil {
+		return false, nil
+	}
+
+	err = json.Unmarshal(setting.Value, v)
+	if err != nil {
+		return false, fmt.Errorf("manager.getSetting: could not parse setting %s: %w", key, err)
+	}
+
+	return true, nil
+}
+
+// setSetting stores v as the value of the setting, creating it if needed.
+func (man *Manager) setSetting(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("manager.setSetting: could not marshal setting %s: %w", key, err)
+	}
+
+	setting, err := man.services.SettingSvc.Get([]byte(key))
+	if err != nil {
+		return fmt.Errorf("manager.setSetting: could not get setting %s: %w", key, err)
+	}
+
+	if setting == nil {
+		_, err = man.services.SettingSvc.Create(&entity.Setting{Key: key, Value: value})
+	} else {
+		setting.Value = value
+		_, err = man.services.SettingSvc.Update(setting)
+	}
+	if err != nil {
+		return fmt.Errorf("manager.setSetting: could not save setting %s: %w", key, err)
+	}
+
+	return nil
+}
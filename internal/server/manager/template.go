@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+// templateData is what backup templates are rendered with.
+type templateData struct {
+	Agent  templateAgent
+	Labels map[string]string
+}
+
+// templateAgent is what templates see of the agent. Rendered sources are shown
+// to every user who can see the backup, so it leaves out the agent's secrets.
+type templateAgent struct {
+	Name   string
+	IP     string
+	Labels map[string]string
+}
+
+func templateFuncs(agent *entity.Agent) template.FuncMap {
+	return template.FuncMap{
+		"hostname": func() string {
+			if agent == nil {
+				return ""
+			}
+			return agent.Name
+		},
+		"label": func(key string) (string, error) {
+			if agent == nil {
+				return "", nil
+			}
+
+			value, ok := agent.Labels[key]
+			if !ok {
+				return "", fmt.Errorf("agent %s has no label %q", agent.Name, key)
+			}
+			return value, nil
+		},
+	}
+}
+
+// ParseTemplate checks that the source and excludes of the template parse.
+func ParseTemplate(tmpl *entity.Template) error {
+	_, err := template.New("source").Funcs(templateFuncs(nil)).Parse(tmpl.Source)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+
+	for _, exclude := range tmpl.Exclude {
+		_, err := template.New("exclude").Funcs(templateFuncs(nil)).Parse(exclude)
+		if err != nil {
+			return fmt.Errorf("invalid exclude %q: %w", exclude, err)
+		}
+	}
+
+	return nil
+}
+
+func render(text string, agent *entity.Agent) (string, error) {
+	parsed, err := template.New("").Funcs(templateFuncs(agent)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	data := templateData{
+		Agent: templateAgent{
+			Name:   agent.Name,
+			IP:     agent.IP,
+			Labels: agent.Labels,
+		},
+		Labels: agent.Labels,
+	}
+	err = parsed.Execute(&out, data)
+	if err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// RenderBackup returns a copy of the backup with its source and excludes rendered
+// for the agent. Backups not created from a template are returned as is.
+func RenderBackup(backup *entity.Backup, agent *entity.Agent) (*entity.Backup, error) {
+	if backup.TemplateID == 0 {
+		return backup, nil
+	}
+
+	rendered := *backup
+
+	source, err := render(backup.Source, agent)
+	if err != nil {
+		return nil, fmt.Errorf("could not render source: %w", err)
+	}
+	rendered.Source = source
+
+	rendered.Exclude = make([]string, 0, len(backup.Exclude))
+	for _, exclude := range backup.Exclude {
+		value, err := render(exclude, agent)
+		if err != nil {
+			return nil, fmt.Errorf("could not render exclude %q: %w", exclude, err)
+		}
+		rendered.Exclude = append(rendered.Exclude, value)
+	}
+
+	return &rendered, nil
+}
+
+// ApplyTemplate copies the definition of the template onto the backup. Schedules
+// keep their run times when the template still has one by the same name.
+func ApplyTemplate(backup *entity.Backup, tmpl *entity.Template) {
+	schedules := make([]*entity.Schedule, 0, len(tmpl.Schedules))
+	for _, sch := range tmpl.Schedules {
+		copied := *sch
+		copied.LastRun, copied.NextRun = time.Time{}, time.Time{}
+		for _, old := range backup.Schedules {
+			if old.Name == sch.Name {
+				copied.LastRun, copied.NextRun = old.LastRun, old.NextRun
+			}
+		}
+		schedules = append(schedules, &copied)
+	}
+
+	backup.TemplateID = tmpl.ID
+	backup.Target = tmpl.Target
+	backup.Source = tmpl.Source
+	backup.Exclude = append([]string{}, tmpl.Exclude...)
+	backup.Schedules = schedules
+	backup.Selector = tmpl.Selector
+}
+
+// SyncTemplate applies the template to every backup created from it and
+// reschedules them.
+func (man *Manager) SyncTemplate(tmpl *entity.Template) error {
+	// TODO: Optimize with filters.
+	backups, err := man.services.BackupSvc.GetAll()
+	if err != nil {
+		return fmt.Errorf("manager.SyncTemplate: could not get backups: %w", err)
+	}
+
+	for _, backup := range backups {
+		if backup.TemplateID != tmpl.ID {
+			continue
+		}
+
+		_, err = man.scheduler.Update(backup.ID, func(backup *entity.Backup) {
+			ApplyTemplate(backup, tmpl)
+		})
+		if err != nil {
+			return fmt.Errorf("manager.SyncTemplate: could not update backup %d: %w", backup.ID, err)
+		}
+	}
+
+	return nil
+}
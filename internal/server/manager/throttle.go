@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// loginWindow is how long failed logins count against a username or address.
+	loginWindow = 15 * time.Minute
+
+	// userFailures is how many failed logins a username gets in the window,
+	// addressFailures how many an address gets over all usernames.
+	userFailures    = 5
+	addressFailures = 20
+)
+
+// ErrLoginThrottled is returned by Login when too many logins failed for the
+// username or from the address lately.
+var ErrLoginThrottled = errors.New("manager: too many failed logins")
+
+// failures of logins for a username or from an address, counted from the
+// first in the window.
+type failures struct {
+	count int
+	since time.Time
+}
+
+type loginThrottle struct {
+	mutex     sync.Mutex
+	users     map[string]*failures
+	addresses map[string]*failures
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{
+		users:     make(map[string]*failures),
+		addresses: make(map[string]*failures),
+	}
+}
+
+// failed returns the failures counted against the key, nil if the window is
+// over.
+func failed(counts map[string]*failures, key string, now time.Time) *failures {
+	f, ok := counts[key]
+	if !ok {
+		return nil
+	}
+
+	if now.Sub(f.since) >= loginWindow {
+		delete(counts, key)
+		return nil
+	}
+
+	return f
+}
+
+// allowed reports whether a login for the username from the address may be
+// tried.
+func (t *loginThrottle) allowed(username, address string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if f := failed(t.users, username, now); f != nil && f.count >= userFailures {
+		return false
+	}
+	if f := failed(t.addresses, address, now); f != nil && f.count >= addressFailures {
+		return false
+	}
+
+	return true
+}
+
+// fail counts a failed login for the username from the address.
+func (t *loginThrottle) fail(username, address string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	for _, counts := range []map[string]*failures{t.users, t.addresses} {
+		for key := range counts {
+			failed(counts, key, now)
+		}
+	}
+
+	count := func(counts map[string]*failures, key string) {
+		f := failed(counts, key, now)
+		if f == nil {
+			f = &failures{since: now}
+			counts[key] = f
+		}
+		f.count++
+	}
+	count(t.users, username)
+	count(t.addresses, address)
+}
+
+// succeed clears the failed logins for the username. Those from the address
+// still count, so logging in to one account doesn't allow guessing another.
+func (t *loginThrottle) succeed(username string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.users, username)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/tunnel"
+)
+
+// ServeTunnel serves the tunnel opened by the agent until it closes. Requests
+// the agent sends over it are served by the handler as if they came from the
+// agent over HTTP.
+func (man *Manager) ServeTunnel(agent *entity.Agent, ws *websocket.Conn, handler http.Handler) error {
+	// Requests over the tunnel are authenticated by it, with the agent's PSK as
+	// it is at the time, as it may be rotated while the tunnel is open.
+	id := []byte(strconv.Itoa(agent.ID))
+	authed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current, err := man.services.AgentSvc.Get(id)
+		if err != nil || current == nil {
+			http.Error(w, "agent not found", http.StatusUnauthorized)
+			return
+		}
+
+		r.Header.Set("authorization", fmt.Sprintf("PSK %s", current.PSK))
+		handler.ServeHTTP(w, r)
+	})
+	conn := tunnel.New(ws, authed, nil)
+
+	if !agent.Tunnel {
+		agent.Tunnel = true
+		_, err := man.services.AgentSvc.Update(agent)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("manager.ServeTunnel: could not update agent: %w", err)
+		}
+	}
+
+	man.tunnelsMutex.Lock()
+	if old, ok := man.tunnels[agent.ID]; ok {
+		old.Close()
+	}
+	man.tunnels[agent.ID] = conn
+	man.tunnelsMutex.Unlock()
+
+	man.log.WithFields("agent", agent.ID).Info("Tunnel opened by agent", agent.Name)
+
+	// Jobs held back while the agent was away can be sent now.
+	man.wakeQueue()
+
+	err := conn.Serve()
+
+	man.tunnelsMutex.Lock()
+	if man.tunnels[agent.ID] == conn {
+		delete(man.tunnels, agent.ID)
+	}
+	man.tunnelsMutex.Unlock()
+
+	man.log.WithFields("agent", agent.ID).Info("Tunnel closed by agent", agent.Name)
+
+	return err
+}
+
+// agentTunnel returns the open tunnel of the agent, nil if there is none.
+func (man *Manager) agentTunnel(agentID int) *tunnel.Conn {
+	man.tunnelsMutex.Lock()
+	defer man.tunnelsMutex.Unlock()
+
+	return man.tunnels[agentID]
+}
+
+// reachable reports whether requests can be sent to the agent right now.
+func (man *Manager) reachable(agent *entity.Agent) bool {
+	return !agent.Tunnel || man.agentTunnel(agent.ID) != nil
+}
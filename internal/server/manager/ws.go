@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/queue"
+)
+
+const (
+	wsQueueSize = 100
+	wsWriteWait = 10 * time.Second
+)
+
+// wsClient is a websocket client of the UI, with the queue of messages waiting
+// to be written to it by its own sender. It is open for as long as the session
+// it was opened with.
+type wsClient struct {
+	queue  *queue.Queue
+	cancel context.CancelFunc
+
+	session string
+	userID  int
+}
+
+// AddWS starts sending the messages for the websocket connection of the user's
+// session, until it is removed with RemoveWS. The returned queue is where its
+// messages go.
+func (man *Manager) AddWS(c *websocket.Conn, session string, userID int) *queue.Queue {
+	ctx, cancel := context.WithCancel(man.ctx)
+	client := &wsClient{
+		queue:  queue.New("ws "+c.RemoteAddr().String(), wsQueueSize),
+		cancel: cancel,
+
+		session: session,
+		userID:  userID,
+	}
+
+	man.wsMutex.Lock()
+	man.wsClients[c] = client
+	man.wsMutex.Unlock()
+
+	go client.queue.Run(ctx, func(item interface{}) error {
+		c.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		err := c.WriteMessage(websocket.TextMessage, item.([]byte))
+		if err != nil {
+			man.log.WithFields("function", "wsSender", "client", c.RemoteAddr().String()).Error("writing message error:", err)
+			// The connection is broken, the read loop will notice and remove it.
+			c.Close()
+		}
+		return err
+	})
+
+	return client.queue
+}
+
+// RemoveWS stops sending to the websocket connection and closes it.
+func (man *Manager) RemoveWS(c *websocket.Conn) {
+	man.wsMutex.Lock()
+	client, ok := man.wsClients[c]
+	delete(man.wsClients, c)
+	man.wsMutex.Unlock()
+
+	if ok {
+		client.cancel()
+	}
+	c.Close()
+}
+
+// WriteWS queues the message for the websocket clients whose user it is for,
+// every one if for is nil. The users are looked up for each message, so changes
+// to their role or scope apply right away, and the clients of sessions that are
+// over get closed. A client that can't keep up loses its oldest messages
+// instead of holding up the others.
+func (man *Manager) WriteWS(data []byte, isFor func(user *entity.User) bool) {
+	man.wsMutex.Lock()
+	clients := make(map[*websocket.Conn]*wsClient, len(man.wsClients))
+	for c, client := range man.wsClients {
+		clients[c] = client
+	}
+	man.wsMutex.Unlock()
+
+	for c, client := range clients {
+		var user *entity.User
+		if man.sessionOf(client.session, client.userID) {
+			var err error
+			user, err = man.services.UserSvc.Get([]byte(strconv.Itoa(client.userID)))
+			if err != nil {
+				man.log.WithFields("function", "WriteWS", "client", c.RemoteAddr().String()).Error("could not get user:", err)
+				continue
+			}
+		}
+
+		if user == nil {
+			// The read loop notices and removes it.
+			c.Close()
+			continue
+		}
+
+		if isFor != nil && !isFor(user) {
+			continue
+		}
+
+		if client.queue.Push(data) {
+			man.log.WithFields("function", "WriteWS", "client", c.RemoteAddr().String()).Warn("client is too slow, dropped a message")
+		}
+	}
+}
+
+// closeWS closes the websocket connections of the clients, as when their
+// sessions end. The read loops notice and remove them.
+func (man *Manager) closeWS(match func(client *wsClient) bool) {
+	man.wsMutex.Lock()
+	defer man.wsMutex.Unlock()
+
+	for c, client := range man.wsClients {
+		if match(client) {
+			c.Close()
+		}
+	}
+}
+
+// QueueStats returns the stats of the queues of the websocket clients.
+func (man *Manager) QueueStats() []queue.Stats {
+	man.wsMutex.Lock()
+	defer man.wsMutex.Unlock()
+
+	stats := make([]queue.Stats, 0, len(man.wsClients))
+	for _, client := range man.wsClients {
+		stats = append(stats, client.queue.Stats())
+	}
+
+	return stats
+}
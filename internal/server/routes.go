@@ -3,55 +3,76 @@ package server
 import (
 	"net/http"
 
-	"github.com/gorilla/mux"
-
 	"zerosrealm.xyz/tergum/internal/server/api"
 )
 
-func corsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "*")
-}
-
-func cors(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "*")
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	srv.router.ServeHTTP(w, r)
 }
 
 func (srv *Server) routes() {
-	srv.router.NewRoute().HandlerFunc(corsHandler).Methods("OPTIONS")
+	// There are no CORS headers, the API is authenticated by the session cookie
+	// and only for the UI served by the server itself.
 	srv.router.StrictSlash(true)
 
-	api := api.New(srv.log.WithFields("component", "api"), srv.services)
+	api := api.New(srv.log.WithFields("component", "api"), srv.services, srv.conf.SecureCookies)
+
+	prefix := srv.router.PathPrefix("/api/").Subrouter()
 
-	apiRoute := srv.router.PathPrefix("/api/").Subrouter()
+	// Agents authenticate by their PSK or certificate instead of a session, and
+	// users log in here. These routes come first so the session check below never
+	// sees them.
+	publicRoute := prefix.NewRoute().Subrouter()
+	publicRoute.Handle("/login", api.Login(srv.manager)).Methods("POST")
+	publicRoute.Handle("/logout", api.Logout(srv.manager)).Methods("POST")
+	publicRoute.Handle("/register", api.RegisterAgent(srv.manager)).Methods("POST")
+	publicRoute.Handle("/agent/heartbeat", api.AgentHeartbeat(srv.manager)).Methods("POST")
+	publicRoute.Handle("/agent/certificate", api.RenewAgentCertificate(srv.manager)).Methods("POST")
+	publicRoute.Handle("/agent/tunnel", api.AgentTunnel(srv.manager, srv)).Methods("GET")
+	publicRoute.Handle("/job/{id}/progress", api.JobProgress(srv.manager, srv.restic)).Methods("POST")
+	publicRoute.Handle("/job/{id}/error", api.JobError(srv.manager)).Methods("POST")
 
-	apiRoute.Handle("/backup", api.GetBackups()).Methods("GET")
+	apiRoute := prefix.NewRoute().Subrouter()
+	apiRoute.Use(api.RequireSession(srv.manager))
+
+	apiRoute.Handle("/session", api.GetSession()).Methods("GET")
+
+	apiRoute.Handle("/user", api.GetUsers()).Methods("GET")
+	apiRoute.Handle("/user", api.CreateUser()).Methods("POST")
+	apiRoute.Handle("/user/{id}", api.UpdateUser(srv.manager)).Methods("PUT")
+	apiRoute.Handle("/user/{id}", api.DeleteUser(srv.manager)).Methods("DELETE")
+
+	apiRoute.Handle("/backup", api.GetBackups(srv.manager)).Methods("GET")
 	apiRoute.Handle("/backup", api.CreateBackup(srv.manager)).Methods("POST")
 	// apiRoute.Handle("/backup/{id}", srv.getBackup()).Methods("GET")
 	apiRoute.Handle("/backup/{id}", api.UpdateBackup(srv.manager)).Methods("PUT")
-	apiRoute.Handle("/backup/{id}", api.DeleteBackup()).Methods("DELETE")
+	apiRoute.Handle("/backup/{id}", api.DeleteBackup(srv.manager)).Methods("DELETE")
 	apiRoute.Handle("/backup/{id}/agent", api.GetBackupAgents()).Methods("GET")
 	apiRoute.Handle("/backup/{id}/agent", api.UpdateBackupAgents()).Methods("PUT")
+	apiRoute.Handle("/backup/{id}/schedule", api.GetBackupSchedule()).Methods("GET")
+	apiRoute.Handle("/backup/{id}/pause", api.PauseBackup(srv.manager)).Methods("POST")
+	apiRoute.Handle("/backup/{id}/resume", api.ResumeBackup(srv.manager)).Methods("POST")
 
-	apiRoute.Handle("/agent", api.GetAgents()).Methods("GET")
+	apiRoute.Handle("/schedule/validate", api.ValidateSchedule()).Methods("POST")
+	apiRoute.Handle("/schedule/pause", api.SetSchedulesPaused(srv.manager, true)).Methods("POST")
+	apiRoute.Handle("/schedule/resume", api.SetSchedulesPaused(srv.manager, false)).Methods("POST")
+
+	apiRoute.Handle("/agent", api.GetAgents(srv.manager)).Methods("GET")
 	apiRoute.Handle("/agent", api.CreateAgent()).Methods("POST")
 	// apiRoute.Handle("/agent/{id}", srv.getAgent()).Methods("GET")
 	apiRoute.Handle("/agent/{id}", api.UpdateAgent()).Methods("PUT")
-	apiRoute.Handle("/agent/{id}", api.DeleteAgent()).Methods("DELETE")
+	apiRoute.Handle("/agent/{id}", api.DeleteAgent(srv.manager)).Methods("DELETE")
+	apiRoute.Handle("/agent/{id}/pause", api.PauseAgent()).Methods("POST")
+	apiRoute.Handle("/agent/{id}/resume", api.ResumeAgent()).Methods("POST")
+	apiRoute.Handle("/agent/{id}/rotate", api.RotateAgentPSK(srv.manager)).Methods("POST")
+	apiRoute.Handle("/agent/{id}/approve", api.ApproveAgent(srv.manager)).Methods("POST")
 
 	apiRoute.Handle("/repo", api.GetRepos()).Methods("GET")
 	apiRoute.Handle("/repo", api.CreateRepo()).Methods("POST")
 	// apiRoute.Handle("/repo/{id}", srv.getRepo()).Methods("GET")
 	apiRoute.Handle("/repo/{id}", api.UpdateRepo()).Methods("PUT")
 	apiRoute.Handle("/repo/{id}", api.DeleteRepo()).Methods("DELETE")
+	apiRoute.Handle("/repo/{id}/forget/preview", api.PreviewRepoForget(srv.manager, srv.restic)).Methods("POST")
 	apiRoute.Handle("/repo/{id}/snapshot", api.GetSnapshots(srv.manager, srv.restic)).Methods("GET")
 	apiRoute.Handle("/repo/{id}/snapshot/{snapshot}", api.DeleteSnapshot(srv.manager, srv.restic)).Methods("DELETE")
 	apiRoute.Handle("/repo/{id}/snapshot/{snapshot}/restore", api.RestoreSnapshot(srv.manager)).Methods("POST")
@@ -61,13 +82,26 @@ func (srv *Server) routes() {
 	apiRoute.Handle("/job", api.CreateJob(srv.manager)).Methods("POST")
 	// apiRoute.Handle("/job/{id}", srv.getJob()).Methods("GET")
 	apiRoute.Handle("/job/{id}", api.StopJob(srv.manager)).Methods("DELETE")
-	apiRoute.Handle("/job/{id}/progress", api.JobProgress(srv.manager, srv.restic)).Methods("POST")
-	apiRoute.Handle("/job/{id}/error", api.JobError(srv.manager)).Methods("POST")
 
-	// apiRoute.Handle("/forget", srv.getJobs()).Methods("GET")
-	// apiRoute.Handle("/forget", srv.createForget()).Methods("POST")
+	apiRoute.Handle("/forget", api.GetForgets()).Methods("GET")
+	apiRoute.Handle("/forget", api.CreateForget()).Methods("POST")
 	apiRoute.Handle("/forget/{id}", api.GetForget()).Methods("GET")
 	apiRoute.Handle("/forget/{id}", api.UpdateForget()).Methods("PUT")
+	apiRoute.Handle("/forget/{id}", api.DeleteForget()).Methods("DELETE")
+	apiRoute.Handle("/forget/{id}/preview", api.PreviewForget(srv.manager, srv.restic)).Methods("GET")
+
+	apiRoute.Handle("/template", api.GetTemplates()).Methods("GET")
+	apiRoute.Handle("/template", api.CreateTemplate()).Methods("POST")
+	apiRoute.Handle("/template/{id}", api.GetTemplate()).Methods("GET")
+	apiRoute.Handle("/template/{id}", api.UpdateTemplate(srv.manager)).Methods("PUT")
+	apiRoute.Handle("/template/{id}", api.DeleteTemplate()).Methods("DELETE")
+	apiRoute.Handle("/template/{id}/backup", api.CreateTemplateBackup(srv.manager)).Methods("POST")
+
+	apiRoute.Handle("/blackout", api.GetBlackouts()).Methods("GET")
+	apiRoute.Handle("/blackout", api.CreateBlackout()).Methods("POST")
+	apiRoute.Handle("/blackout/{id}", api.GetBlackout()).Methods("GET")
+	apiRoute.Handle("/blackout/{id}", api.UpdateBlackout()).Methods("PUT")
+	apiRoute.Handle("/blackout/{id}", api.DeleteBlackout()).Methods("DELETE")
 
 	apiRoute.Handle("/setting/logging", api.SettingsLoggingGet()).Methods("GET")
 	apiRoute.Handle("/setting/logging", api.SettingsLoggingSet()).Methods("PUT")
@@ -79,9 +113,9 @@ func (srv *Server) routes() {
 	apiRoute.Handle("/setting/{id}", api.DeleteSetting()).Methods("DELETE")
 
 	apiRoute.Handle("/log", api.GetLogs()).Methods("GET")
+	apiRoute.Handle("/queue", api.GetQueues(srv.manager)).Methods("GET")
 
-	apiRoute.Handle("/register", api.RegisterAgent()).Methods("POST")
-
-	srv.router.Use(mux.CORSMethodMiddleware(srv.router))
-	srv.router.Use(cors)
+	apiRoute.Handle("/registration/token", api.GetRegistrationTokens()).Methods("GET")
+	apiRoute.Handle("/registration/token", api.CreateRegistrationToken()).Methods("POST")
+	apiRoute.Handle("/registration/token/{id}", api.DeleteRegistrationToken()).Methods("DELETE")
 }
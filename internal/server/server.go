@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	_ "embed"
 	"fmt"
 	"net/http"
@@ -12,13 +13,14 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
+	"zerosrealm.xyz/tergum/internal/ca"
 	"zerosrealm.xyz/tergum/internal/entity"
 	"zerosrealm.xyz/tergum/internal/log"
 	"zerosrealm.xyz/tergum/internal/restic"
 	"zerosrealm.xyz/tergum/internal/server/config"
 	manager "zerosrealm.xyz/tergum/internal/server/manager"
 	"zerosrealm.xyz/tergum/internal/server/service"
+	"zerosrealm.xyz/tergum/internal/tlsconfig"
 )
 
 type PersistentData struct {
@@ -46,6 +48,7 @@ type Server struct {
 
 	restic  *restic.Restic
 	manager *manager.Manager
+	ca      *ca.CA
 	router  *mux.Router
 
 	conf *config.Config
@@ -56,17 +59,6 @@ var savedData = PersistentData{
 	Mutex: sync.Mutex{},
 }
 
-var wsConnections = make(map[string]*websocket.Conn)
-
-func closeWS(c *websocket.Conn) {
-	key := c.RemoteAddr().String()
-	_, ok := wsConnections[key]
-	if ok {
-		delete(wsConnections, key)
-	}
-	c.Close()
-}
-
 func New(conf *config.Config, services *service.Services) (*Server, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -76,7 +68,24 @@ func New(conf *config.Config, services *service.Services) (*Server, error) {
 		cancel()
 		return nil, err
 	}
-	man := manager.NewManager(ctx, services, logger, &wsConnections)
+	authority, err := ca.Load(conf.CA)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	tlsConf, err := tlsconfig.Client(conf.TLS.CA)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	man := manager.NewManager(ctx, services, logger, authority, tlsConf)
+
+	err = man.BootstrapAdmin(conf.Admin.Username, conf.Admin.Password, conf.Admin.PasswordFile)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
 
 	var resticExe *restic.Restic
 	if conf.Restic != "" {
@@ -93,6 +102,7 @@ func New(conf *config.Config, services *service.Services) (*Server, error) {
 		ctxCancel: cancel,
 		services:  services,
 		manager:   man,
+		ca:        authority,
 		restic:    resticExe,
 		conf:      conf,
 		router:    mux.NewRouter(),
@@ -108,7 +118,7 @@ func (srv *Server) Start() {
 
 	go srv.manager.Start()
 
-	srv.manager.BuildSchedules()
+	srv.manager.Scheduler().Start()
 
 	srv.router.Handle("/", http.FileServer(http.Dir("www")))
 	srv.router.HandleFunc("/ws", srv.ws)
@@ -121,10 +131,30 @@ func (srv *Server) Start() {
 		IdleTimeout:  time.Second * 60,
 	}
 
-	srv.log.Info(fmt.Sprintf("Listening on %s:%d", srv.conf.Listen.IP, srv.conf.Listen.Port))
+	useTLS := srv.conf.TLS.Cert != ""
+	if useTLS {
+		tlsConf, err := tlsconfig.Server(srv.conf.TLS.Cert, srv.conf.TLS.Key)
+		if err != nil {
+			srv.log.Fatal(err)
+		}
+		// Agents authenticate with the certificates the CA issued them, other
+		// clients such as browsers don't need one.
+		tlsConf.ClientAuth = tls.VerifyClientCertIfGiven
+		tlsConf.ClientCAs = srv.ca.Pool()
+		listener.TLSConfig = tlsConf
+	}
+
+	srv.log.Info(fmt.Sprintf("Listening on %s:%d", srv.conf.Listen.IP, srv.conf.Listen.Port), "tls:", useTLS)
 
 	go func() {
-		if err := listener.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if useTLS {
+			// The certificate is already in the listener's TLS config.
+			err = listener.ListenAndServeTLS("", "")
+		} else {
+			err = listener.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			srv.log.Fatal(err)
 		}
 	}()
@@ -136,7 +166,7 @@ func (srv *Server) Start() {
 	srv.log.Info("shutting down")
 
 	defer srv.ctxCancel()
-	defer manager.StopSchedulers()
+	defer srv.manager.Scheduler().Stop()
 	if err := listener.Shutdown(srv.ctx); err != nil && err != context.DeadlineExceeded {
 		srv.log.Fatal(err)
 	}
@@ -126,6 +126,24 @@ func (s *MemoryStorage) Update(agent *entity.Agent) (*entity.Agent, error) {
 	return agent, nil
 }
 
+func (s *MemoryStorage) UpdateHeartbeat(agent *entity.Agent) (*entity.Agent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.agents[fmt.Sprint(agent.ID)]
+	if !ok {
+		return agent, nil
+	}
+
+	stored.LastSeen = agent.LastSeen
+	stored.AgentInfo = agent.AgentInfo
+	stored.Uptime = agent.Uptime
+	stored.RunningJobs = agent.RunningJobs
+	stored.FreeDisk = agent.FreeDisk
+
+	return agent, nil
+}
+
 func (s *MemoryStorage) Delete(id []byte) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
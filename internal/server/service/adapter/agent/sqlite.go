@@ -2,10 +2,12 @@ package agent
 
 import (
 	"database/sql"
+	"encoding/json"
 	"strconv"
 
 	_ "github.com/mattn/go-sqlite3"
 	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/server/service/adapter/migrate"
 )
 
 type sqliteStorage struct {
@@ -37,16 +39,60 @@ func initDB(db *sql.DB) error {
 	_, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS agents (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			machine_id TEXT NOT NULL DEFAULT '',
 			name TEXT NOT NULL,
 			ip TEXT NOT NULL,
 			port INTEGER NOT NULL,
-			psk TEXT NOT NULL
+			psk TEXT NOT NULL,
+			tunnel INTEGER NOT NULL DEFAULT 0,
+			tls INTEGER NOT NULL DEFAULT 0,
+			cert_serial TEXT NOT NULL DEFAULT '',
+			next_psk TEXT NOT NULL DEFAULT '',
+			psk_rotated_at TIMESTAMP,
+			pending INTEGER NOT NULL DEFAULT 0,
+			token_id INTEGER NOT NULL DEFAULT 0,
+			schedules_paused INTEGER NOT NULL DEFAULT 0,
+			paused_until TIMESTAMP,
+			labels TEXT NOT NULL DEFAULT '{}',
+			last_seen TIMESTAMP,
+			restic_version TEXT NOT NULL DEFAULT '',
+			os TEXT NOT NULL DEFAULT '',
+			arch TEXT NOT NULL DEFAULT '',
+			agent_version TEXT NOT NULL DEFAULT '',
+			uptime INTEGER NOT NULL DEFAULT 0,
+			running_jobs TEXT NOT NULL DEFAULT '[]',
+			free_disk INTEGER NOT NULL DEFAULT 0
 		);
 	`)
 	if err != nil {
 		return err
 	}
 
+	err = migrate.Run(db, "agents",
+		migrate.AddColumn("agents", "schedules_paused", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("agents", "paused_until", `TIMESTAMP`),
+		migrate.AddColumn("agents", "labels", `TEXT NOT NULL DEFAULT '{}'`),
+		migrate.AddColumn("agents", "last_seen", `TIMESTAMP`),
+		migrate.AddColumn("agents", "restic_version", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("agents", "uptime", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("agents", "running_jobs", `TEXT NOT NULL DEFAULT '[]'`),
+		migrate.AddColumn("agents", "free_disk", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("agents", "os", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("agents", "arch", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("agents", "agent_version", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("agents", "tunnel", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("agents", "tls", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("agents", "cert_serial", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("agents", "next_psk", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("agents", "psk_rotated_at", `TIMESTAMP`),
+		migrate.AddColumn("agents", "pending", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("agents", "machine_id", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("agents", "token_id", `INTEGER NOT NULL DEFAULT 0`),
+	)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -54,6 +100,32 @@ func (s *sqliteStorage) Close() error {
 	return s.db.Close()
 }
 
+func (s *sqliteStorage) labels(agent *entity.Agent) (string, error) {
+	if agent.Labels == nil {
+		return "{}", nil
+	}
+
+	labels, err := json.Marshal(agent.Labels)
+	if err != nil {
+		return "", err
+	}
+
+	return string(labels), nil
+}
+
+func (s *sqliteStorage) runningJobs(agent *entity.Agent) (string, error) {
+	if agent.RunningJobs == nil {
+		return "[]", nil
+	}
+
+	jobs, err := json.Marshal(agent.RunningJobs)
+	if err != nil {
+		return "", err
+	}
+
+	return string(jobs), nil
+}
+
 func (s *sqliteStorage) Get(id []byte) (*entity.Agent, error) {
 	var agent entity.Agent
 
@@ -71,17 +143,60 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Agent, error) {
 		return nil, nil
 	}
 
-	err = s.db.QueryRow(`SELECT id, name, ip, port, psk FROM agents WHERE id = ?`, intID).Scan(
+	var pausedUntil, lastSeen, pskRotatedAt sql.NullTime
+	var labels, runningJobs string
+	err = s.db.QueryRow(`SELECT id, machine_id, name, ip, port, psk, tunnel, tls, cert_serial, next_psk, psk_rotated_at, pending, token_id, schedules_paused, paused_until, labels, last_seen, restic_version, os, arch, agent_version, uptime, running_jobs, free_disk FROM agents WHERE id = ?`, intID).Scan(
 		&agent.ID,
+		&agent.MachineID,
 		&agent.Name,
 		&agent.IP,
 		&agent.Port,
 		&agent.PSK,
+		&agent.Tunnel,
+		&agent.TLS,
+		&agent.CertSerial,
+		&agent.NextPSK,
+		&pskRotatedAt,
+		&agent.Pending,
+		&agent.TokenID,
+		&agent.SchedulesPaused,
+		&pausedUntil,
+		&labels,
+		&lastSeen,
+		&agent.ResticVersion,
+		&agent.OS,
+		&agent.Arch,
+		&agent.AgentVersion,
+		&agent.Uptime,
+		&runningJobs,
+		&agent.FreeDisk,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	err = json.Unmarshal([]byte(labels), &agent.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(runningJobs), &agent.RunningJobs)
+	if err != nil {
+		return nil, err
+	}
+
+	if pausedUntil.Valid {
+		agent.PausedUntil = pausedUntil.Time
+	}
+
+	if lastSeen.Valid {
+		agent.LastSeen = lastSeen.Time
+	}
+
+	if pskRotatedAt.Valid {
+		agent.PSKRotatedAt = pskRotatedAt.Time
+	}
+
 	return &agent, nil
 }
 
@@ -89,7 +204,7 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Agent, error) {
 func (s *sqliteStorage) GetAll() ([]*entity.Agent, error) {
 	var agents []*entity.Agent
 
-	rows, err := s.db.Query(`SELECT id, name, ip, port, psk FROM agents`)
+	rows, err := s.db.Query(`SELECT id, machine_id, name, ip, port, psk, tunnel, tls, cert_serial, next_psk, psk_rotated_at, pending, token_id, schedules_paused, paused_until, labels, last_seen, restic_version, os, arch, agent_version, uptime, running_jobs, free_disk FROM agents`)
 	if err != nil {
 		return nil, err
 	}
@@ -98,17 +213,60 @@ func (s *sqliteStorage) GetAll() ([]*entity.Agent, error) {
 	for rows.Next() {
 		var agent entity.Agent
 
+		var pausedUntil, lastSeen, pskRotatedAt sql.NullTime
+		var labels, runningJobs string
 		err := rows.Scan(
 			&agent.ID,
+			&agent.MachineID,
 			&agent.Name,
 			&agent.IP,
 			&agent.Port,
 			&agent.PSK,
+			&agent.Tunnel,
+			&agent.TLS,
+			&agent.CertSerial,
+			&agent.NextPSK,
+			&pskRotatedAt,
+			&agent.Pending,
+			&agent.TokenID,
+			&agent.SchedulesPaused,
+			&pausedUntil,
+			&labels,
+			&lastSeen,
+			&agent.ResticVersion,
+			&agent.OS,
+			&agent.Arch,
+			&agent.AgentVersion,
+			&agent.Uptime,
+			&runningJobs,
+			&agent.FreeDisk,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		err = json.Unmarshal([]byte(labels), &agent.Labels)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(runningJobs), &agent.RunningJobs)
+		if err != nil {
+			return nil, err
+		}
+
+		if pausedUntil.Valid {
+			agent.PausedUntil = pausedUntil.Time
+		}
+
+		if lastSeen.Valid {
+			agent.LastSeen = lastSeen.Time
+		}
+
+		if pskRotatedAt.Valid {
+			agent.PSKRotatedAt = pskRotatedAt.Time
+		}
+
 		agents = append(agents, &agent)
 	}
 
@@ -116,11 +274,40 @@ func (s *sqliteStorage) GetAll() ([]*entity.Agent, error) {
 }
 
 func (s *sqliteStorage) Create(agent *entity.Agent) (*entity.Agent, error) {
-	result, err := s.db.Exec(`INSERT INTO agents (name, ip, port, psk) VALUES (?, ?, ?, ?)`,
+	labels, err := s.labels(agent)
+	if err != nil {
+		return nil, err
+	}
+
+	runningJobs, err := s.runningJobs(agent)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`INSERT INTO agents (machine_id, name, ip, port, psk, tunnel, tls, cert_serial, next_psk, psk_rotated_at, pending, token_id, schedules_paused, paused_until, labels, last_seen, restic_version, os, arch, agent_version, uptime, running_jobs, free_disk) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		agent.MachineID,
 		agent.Name,
 		agent.IP,
 		agent.Port,
 		agent.PSK,
+		agent.Tunnel,
+		agent.TLS,
+		agent.CertSerial,
+		agent.NextPSK,
+		agent.PSKRotatedAt,
+		agent.Pending,
+		agent.TokenID,
+		agent.SchedulesPaused,
+		agent.PausedUntil,
+		labels,
+		agent.LastSeen,
+		agent.ResticVersion,
+		agent.OS,
+		agent.Arch,
+		agent.AgentVersion,
+		agent.Uptime,
+		runningJobs,
+		agent.FreeDisk,
 	)
 	if err != nil {
 		return nil, err
@@ -137,11 +324,64 @@ func (s *sqliteStorage) Create(agent *entity.Agent) (*entity.Agent, error) {
 }
 
 func (s *sqliteStorage) Update(agent *entity.Agent) (*entity.Agent, error) {
-	_, err := s.db.Exec(`UPDATE agents SET name = ?, ip = ?, port = ?, psk = ? WHERE id = ?`,
+	labels, err := s.labels(agent)
+	if err != nil {
+		return nil, err
+	}
+
+	runningJobs, err := s.runningJobs(agent)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE agents SET machine_id = ?, name = ?, ip = ?, port = ?, psk = ?, tunnel = ?, tls = ?, cert_serial = ?, next_psk = ?, psk_rotated_at = ?, pending = ?, token_id = ?, schedules_paused = ?, paused_until = ?, labels = ?, last_seen = ?, restic_version = ?, os = ?, arch = ?, agent_version = ?, uptime = ?, running_jobs = ?, free_disk = ? WHERE id = ?`,
+		agent.MachineID,
 		agent.Name,
 		agent.IP,
 		agent.Port,
 		agent.PSK,
+		agent.Tunnel,
+		agent.TLS,
+		agent.CertSerial,
+		agent.NextPSK,
+		agent.PSKRotatedAt,
+		agent.Pending,
+		agent.TokenID,
+		agent.SchedulesPaused,
+		agent.PausedUntil,
+		labels,
+		agent.LastSeen,
+		agent.ResticVersion,
+		agent.OS,
+		agent.Arch,
+		agent.AgentVersion,
+		agent.Uptime,
+		runningJobs,
+		agent.FreeDisk,
+		agent.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return agent, nil
+}
+
+func (s *sqliteStorage) UpdateHeartbeat(agent *entity.Agent) (*entity.Agent, error) {
+	runningJobs, err := s.runningJobs(agent)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE agents SET last_seen = ?, restic_version = ?, os = ?, arch = ?, agent_version = ?, uptime = ?, running_jobs = ?, free_disk = ? WHERE id = ?`,
+		agent.LastSeen,
+		agent.ResticVersion,
+		agent.OS,
+		agent.Arch,
+		agent.AgentVersion,
+		agent.Uptime,
+		runningJobs,
+		agent.FreeDisk,
 		agent.ID,
 	)
 	if err != nil {
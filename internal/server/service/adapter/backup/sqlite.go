@@ -2,11 +2,13 @@ package backup
 
 import (
 	"database/sql"
+	"encoding/json"
 	"strconv"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/server/service/adapter/migrate"
 )
 
 type sqliteStorage struct {
@@ -44,15 +46,85 @@ func initDB(db *sql.DB) error {
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			target TEXT NOT NULL,
 			source TEXT NOT NULL,
-			schedule TEXT NOT NULL,
+			schedules TEXT NOT NULL DEFAULT '[]',
 			exclude TEXT,
-			last_run TIMESTAMP
+			last_run TIMESTAMP,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			paused_until TIMESTAMP,
+			selector TEXT NOT NULL DEFAULT '',
+			template_id INTEGER NOT NULL DEFAULT 0
 		);
 	`)
 	if err != nil {
 		return err
 	}
 
+	err = migrate.Run(db, "backups",
+		migrate.AddColumn("backups", "enabled", `INTEGER NOT NULL DEFAULT 1`),
+		migrate.AddColumn("backups", "paused_until", `TIMESTAMP`),
+		migrate.AddColumn("backups", "selector", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("backups", "template_id", `INTEGER NOT NULL DEFAULT 0`),
+		schedulesFromCron,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// schedulesFromCron replaces the single cron string backups had before they had
+// schedules with a schedule named "default" running on it.
+func schedulesFromCron(tx *sql.Tx) error {
+	legacy, err := migrate.HasColumn(tx, "backups", "schedule")
+	if err != nil || !legacy {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE backups RENAME COLUMN schedule TO schedules`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, schedules FROM backups`)
+	if err != nil {
+		return err
+	}
+
+	crons := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var cron string
+		err := rows.Scan(&id, &cron)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		crons[id] = cron
+	}
+	rows.Close()
+
+	type schedule struct {
+		Name string `json:"name"`
+		Cron string `json:"cron"`
+	}
+	for id, cron := range crons {
+		schedules := make([]schedule, 0, 1)
+		if cron != "" {
+			schedules = append(schedules, schedule{Name: "default", Cron: cron})
+		}
+
+		data, err := json.Marshal(schedules)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE backups SET schedules = ? WHERE id = ?`, string(data), id)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -77,21 +149,36 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Backup, error) {
 		return nil, nil
 	}
 
-	var exclude string
-	err = s.db.QueryRow(`SELECT id, target, source, schedule, exclude, last_run FROM backups WHERE id = ?`, intID).Scan(
+	var schedules, exclude string
+	var pausedUntil sql.NullTime
+	err = s.db.QueryRow(`SELECT id, target, source, schedules, exclude, last_run, enabled, paused_until, selector, template_id FROM backups WHERE id = ?`, intID).Scan(
 		&backup.ID,
 		&backup.Target,
 		&backup.Source,
-		&backup.Schedule,
+		&schedules,
 		&exclude,
 		&backup.LastRun,
+		&backup.Enabled,
+		&pausedUntil,
+		&backup.Selector,
+		&backup.TemplateID,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	err = json.Unmarshal([]byte(schedules), &backup.Schedules)
+	if err != nil {
+		return nil, err
+	}
+
 	backup.Exclude = strings.Split(exclude, s.sliceSep)
 
+	// Backups from before pausing was added have none.
+	if pausedUntil.Valid {
+		backup.PausedUntil = pausedUntil.Time
+	}
+
 	return &backup, nil
 }
 
@@ -99,7 +186,7 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Backup, error) {
 func (s *sqliteStorage) GetAll() ([]*entity.Backup, error) {
 	var backups []*entity.Backup
 
-	rows, err := s.db.Query(`SELECT id, target, source, schedule, exclude, last_run FROM backups`)
+	rows, err := s.db.Query(`SELECT id, target, source, schedules, exclude, last_run, enabled, paused_until, selector, template_id FROM backups`)
 	if err != nil {
 		return nil, err
 	}
@@ -108,20 +195,34 @@ func (s *sqliteStorage) GetAll() ([]*entity.Backup, error) {
 	for rows.Next() {
 		var backup entity.Backup
 
-		var exclude string
+		var schedules, exclude string
+		var pausedUntil sql.NullTime
 		err := rows.Scan(
 			&backup.ID,
 			&backup.Target,
 			&backup.Source,
-			&backup.Schedule,
+			&schedules,
 			&exclude,
 			&backup.LastRun,
+			&backup.Enabled,
+			&pausedUntil,
+			&backup.Selector,
+			&backup.TemplateID,
 		)
 		if err != nil {
 			return nil, err
 		}
+
+		err = json.Unmarshal([]byte(schedules), &backup.Schedules)
+		if err != nil {
+			return nil, err
+		}
 		backup.Exclude = strings.Split(exclude, s.sliceSep)
 
+		if pausedUntil.Valid {
+			backup.PausedUntil = pausedUntil.Time
+		}
+
 		backups = append(backups, &backup)
 	}
 
@@ -129,12 +230,21 @@ func (s *sqliteStorage) GetAll() ([]*entity.Backup, error) {
 }
 
 func (s *sqliteStorage) Create(backup *entity.Backup) (*entity.Backup, error) {
-	result, err := s.db.Exec(`INSERT INTO backups (target, source, schedule, exclude, last_run) VALUES (?, ?, ?, ?, ?)`,
+	schedules, err := json.Marshal(backup.Schedules)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`INSERT INTO backups (target, source, schedules, exclude, last_run, enabled, paused_until, selector, template_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		backup.Target,
 		backup.Source,
-		backup.Schedule,
+		string(schedules),
 		strings.Join(backup.Exclude, s.sliceSep),
 		backup.LastRun,
+		backup.Enabled,
+		backup.PausedUntil,
+		backup.Selector,
+		backup.TemplateID,
 	)
 	if err != nil {
 		return nil, err
@@ -151,12 +261,21 @@ func (s *sqliteStorage) Create(backup *entity.Backup) (*entity.Backup, error) {
 }
 
 func (s *sqliteStorage) Update(backup *entity.Backup) (*entity.Backup, error) {
-	_, err := s.db.Exec(`UPDATE backups SET target = ?, source = ?, schedule = ?, exclude = ?, last_run = ? WHERE id = ?`,
+	schedules, err := json.Marshal(backup.Schedules)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE backups SET target = ?, source = ?, schedules = ?, exclude = ?, last_run = ?, enabled = ?, paused_until = ?, selector = ?, template_id = ? WHERE id = ?`,
 		backup.Target,
 		backup.Source,
-		backup.Schedule,
+		string(schedules),
 		strings.Join(backup.Exclude, s.sliceSep),
 		backup.LastRun,
+		backup.Enabled,
+		backup.PausedUntil,
+		backup.Selector,
+		backup.TemplateID,
 		backup.ID,
 	)
 	if err != nil {
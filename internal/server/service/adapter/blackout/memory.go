@@ -0,0 +1,135 @@
+package blackout
+
+import (
+	"fmt"
+	"sync"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+/*
+	Cache
+*/
+
+type MemoryCache struct {
+	mutex     sync.RWMutex
+	blackouts map[string]*entity.Blackout
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		mutex:     sync.RWMutex{},
+		blackouts: make(map[string]*entity.Blackout),
+	}
+}
+
+func (s *MemoryCache) Get(id []byte) (*entity.Blackout, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blackout, ok := s.blackouts[string(id)]
+	if !ok {
+		return nil, nil
+	}
+
+	return blackout, nil
+}
+
+// TODO: Implement pagination.
+func (s *MemoryCache) GetAll() ([]*entity.Blackout, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blackouts := make([]*entity.Blackout, 0, len(s.blackouts))
+	for _, blackout := range s.blackouts {
+		blackouts = append(blackouts, blackout)
+	}
+
+	return blackouts, nil
+}
+
+func (s *MemoryCache) Add(blackout *entity.Blackout) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.blackouts[fmt.Sprint(blackout.ID)] = blackout
+	return nil
+}
+
+func (s *MemoryCache) Invalidate(id []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.blackouts, string(id))
+	return nil
+}
+
+/*
+	Storage
+*/
+
+type MemoryStorage struct {
+	mutex     sync.RWMutex
+	blackouts map[string]*entity.Blackout
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		mutex:     sync.RWMutex{},
+		blackouts: make(map[string]*entity.Blackout),
+	}
+}
+
+func (s *MemoryStorage) Get(id []byte) (*entity.Blackout, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blackout, ok := s.blackouts[string(id)]
+	if !ok {
+		return nil, nil
+	}
+
+	return blackout, nil
+}
+
+// TODO: Implement pagination.
+func (s *MemoryStorage) GetAll() ([]*entity.Blackout, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blackouts := make([]*entity.Blackout, 0, len(s.blackouts))
+	for _, blackout := range s.blackouts {
+		blackouts = append(blackouts, blackout)
+	}
+
+	return blackouts, nil
+}
+
+func (s *MemoryStorage) Create(blackout *entity.Blackout) (*entity.Blackout, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := len(s.blackouts) + 1
+	blackout.ID = id
+
+	s.blackouts[fmt.Sprint(blackout.ID)] = blackout
+
+	return blackout, nil
+}
+
+func (s *MemoryStorage) Update(blackout *entity.Blackout) (*entity.Blackout, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.blackouts[fmt.Sprint(blackout.ID)] = blackout
+
+	return blackout, nil
+}
+
+func (s *MemoryStorage) Delete(id []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.blackouts, string(id))
+	return nil
+}
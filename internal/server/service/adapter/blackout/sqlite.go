@@ -0,0 +1,194 @@
+package blackout
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	_ "github.com/mattn/go-sqlite3"
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+type sqliteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(dataSource string) (*sqliteStorage, error) {
+	db, err := sql.Open("sqlite3", dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	// Default values.
+	db.SetMaxOpenConns(0)
+	db.SetMaxIdleConns(2)
+
+	if err := initDB(db); err != nil {
+		return nil, err
+	}
+
+	return &sqliteStorage{
+		db: db,
+	}, nil
+}
+
+func initDB(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS blackouts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL DEFAULT '',
+			agent_id INTEGER NOT NULL DEFAULT 0,
+			repo_id INTEGER NOT NULL DEFAULT 0,
+			cron TEXT NOT NULL DEFAULT '',
+			time_zone TEXT NOT NULL DEFAULT '',
+			duration TEXT NOT NULL DEFAULT '',
+			start_time TIMESTAMP,
+			end_time TIMESTAMP,
+			action TEXT NOT NULL DEFAULT 'defer'
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("blackout.initDB: failed to create table: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqliteStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStorage) Get(id []byte) (*entity.Blackout, error) {
+	var blackout entity.Blackout
+
+	var exists bool
+	intID, err := strconv.Atoi(string(id))
+	if err != nil {
+		return nil, err
+	}
+	row := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM blackouts WHERE id = ?)", intID)
+	if err := row.Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	err = s.db.QueryRow(`SELECT id, name, agent_id, repo_id, cron, time_zone, duration, start_time, end_time, action FROM blackouts WHERE id = ?`, intID).Scan(
+		&blackout.ID,
+		&blackout.Name,
+		&blackout.AgentID,
+		&blackout.RepoID,
+		&blackout.Cron,
+		&blackout.TimeZone,
+		&blackout.Duration,
+		&blackout.Start,
+		&blackout.End,
+		&blackout.Action,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blackout, nil
+}
+
+// TODO: Implement pagination.
+func (s *sqliteStorage) GetAll() ([]*entity.Blackout, error) {
+	var blackouts []*entity.Blackout
+
+	rows, err := s.db.Query(`SELECT id, name, agent_id, repo_id, cron, time_zone, duration, start_time, end_time, action FROM blackouts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var blackout entity.Blackout
+
+		err := rows.Scan(
+			&blackout.ID,
+			&blackout.Name,
+			&blackout.AgentID,
+			&blackout.RepoID,
+			&blackout.Cron,
+			&blackout.TimeZone,
+			&blackout.Duration,
+			&blackout.Start,
+			&blackout.End,
+			&blackout.Action,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		blackouts = append(blackouts, &blackout)
+	}
+
+	return blackouts, nil
+}
+
+func (s *sqliteStorage) Create(blackout *entity.Blackout) (*entity.Blackout, error) {
+	result, err := s.db.Exec(`INSERT INTO blackouts (name, agent_id, repo_id, cron, time_zone, duration, start_time, end_time, action) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		blackout.Name,
+		blackout.AgentID,
+		blackout.RepoID,
+		blackout.Cron,
+		blackout.TimeZone,
+		blackout.Duration,
+		blackout.Start,
+		blackout.End,
+		blackout.Action,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	blackout.ID = int(id)
+
+	return blackout, nil
+}
+
+func (s *sqliteStorage) Update(blackout *entity.Blackout) (*entity.Blackout, error) {
+	_, err := s.db.Exec(`UPDATE blackouts SET name = ?, agent_id = ?, repo_id = ?, cron = ?, time_zone = ?, duration = ?, start_time = ?, end_time = ?, action = ? WHERE id = ?`,
+		blackout.Name,
+		blackout.AgentID,
+		blackout.RepoID,
+		blackout.Cron,
+		blackout.TimeZone,
+		blackout.Duration,
+		blackout.Start,
+		blackout.End,
+		blackout.Action,
+		blackout.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return blackout, nil
+}
+
+func (s *sqliteStorage) Delete(id []byte) error {
+	intID, err := strconv.Atoi(string(id))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`DELETE FROM blackouts WHERE id = ?`, intID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -73,10 +73,13 @@ type MemoryStorage struct {
 	forgets map[string]*entity.Forget
 }
 
+// NOTICE: Creates the default forget policy, with id = 0.
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		mutex:   sync.RWMutex{},
-		forgets: make(map[string]*entity.Forget),
+		mutex: sync.RWMutex{},
+		forgets: map[string]*entity.Forget{
+			"0": {ID: 0},
+		},
 	}
 }
 
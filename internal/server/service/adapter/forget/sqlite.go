@@ -2,11 +2,14 @@ package forget
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/server/service/adapter/migrate"
 )
 
 type sqliteStorage struct {
@@ -31,9 +34,7 @@ func NewSQLiteStorage(dataSource string) (*sqliteStorage, error) {
 		return nil, err
 	}
 
-	return &sqliteStorage{
-		db: db,
-	}, nil
+	return &sqliteStorage{db: db}, nil
 }
 
 // NOTICE: Creates the default forget policy, with id = 0.
@@ -41,19 +42,40 @@ func initDB(db *sql.DB) error {
 	_, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS forgets (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			backup_id INTEGER NOT NULL DEFAULT 0,
+			repo_id INTEGER NOT NULL DEFAULT 0,
 			enabled INTEGER NOT NULL DEFAULT 0,
 			lastx INTEGER NOT NULL DEFAULT 0,
 			hourly INTEGER NOT NULL DEFAULT 0,
 			daily INTEGER NOT NULL DEFAULT 0,
 			weekly INTEGER NOT NULL DEFAULT 0,
 			monthly INTEGER NOT NULL DEFAULT 0,
-			yearly INTEGER NOT NULL DEFAULT 0
+			yearly INTEGER NOT NULL DEFAULT 0,
+			within TEXT NOT NULL DEFAULT '',
+			keep_tags TEXT NOT NULL DEFAULT '[]',
+			group_by TEXT NOT NULL DEFAULT '',
+			hosts TEXT NOT NULL DEFAULT '[]',
+			paths TEXT NOT NULL DEFAULT '[]'
 		);
 	`)
 	if err != nil {
 		return fmt.Errorf("forget.initDB: failed to create table: %w", err)
 	}
 
+	err = migrate.Run(db, "forgets",
+		migrate.AddColumn("forgets", "backup_id", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("forgets", "repo_id", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("forgets", "within", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("forgets", "keep_tags", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("forgets", "group_by", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("forgets", "hosts", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("forgets", "paths", `TEXT NOT NULL DEFAULT ''`),
+		listsToJSON,
+	)
+	if err != nil {
+		return fmt.Errorf("forget.initDB: failed to migrate table: %w", err)
+	}
+
 	_, err = db.Exec(`
 		INSERT OR IGNORE INTO forgets(id) VALUES(0);
 	`)
@@ -68,6 +90,120 @@ func (s *sqliteStorage) Close() error {
 	return s.db.Close()
 }
 
+// listsToJSON converts the lists, which were stored comma separated, to JSON so
+// values with a comma in them survive.
+func listsToJSON(tx *sql.Tx) error {
+	type lists struct {
+		id                     int
+		keepTags, hosts, paths string
+	}
+
+	rows, err := tx.Query(`SELECT id, keep_tags, hosts, paths FROM forgets`)
+	if err != nil {
+		return err
+	}
+
+	var all []lists
+	for rows.Next() {
+		var l lists
+		err := rows.Scan(&l.id, &l.keepTags, &l.hosts, &l.paths)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, l)
+	}
+	rows.Close()
+
+	split := func(value string) string {
+		values := make([]string, 0)
+		if value != "" {
+			values = strings.Split(value, ",")
+		}
+		data, _ := json.Marshal(values)
+		return string(data)
+	}
+
+	for _, l := range all {
+		_, err := tx.Exec(`UPDATE forgets SET keep_tags = ?, hosts = ?, paths = ? WHERE id = ?`, split(l.keepTags), split(l.hosts), split(l.paths), l.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeList decodes a list stored as JSON.
+func decodeList(value string) ([]string, error) {
+	values := make([]string, 0)
+	if value == "" {
+		return values, nil
+	}
+
+	err := json.Unmarshal([]byte(value), &values)
+	if err != nil {
+		return nil, err
+	}
+
+	if values == nil {
+		values = make([]string, 0)
+	}
+
+	return values, nil
+}
+
+// encodeList encodes a list as JSON.
+func encodeList(values []string) (string, error) {
+	if values == nil {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// decodeLists sets the lists of the forget policy from their columns.
+func decodeLists(forget *entity.Forget, keepTags, hosts, paths string) error {
+	var err error
+	forget.KeepTags, err = decodeList(keepTags)
+	if err != nil {
+		return err
+	}
+
+	forget.Hosts, err = decodeList(hosts)
+	if err != nil {
+		return err
+	}
+
+	forget.Paths, err = decodeList(paths)
+	return err
+}
+
+// encodeLists returns the columns of the forget policy's lists.
+func encodeLists(forget *entity.Forget) (keepTags, hosts, paths string, err error) {
+	keepTags, err = encodeList(forget.KeepTags)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	hosts, err = encodeList(forget.Hosts)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	paths, err = encodeList(forget.Paths)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return keepTags, hosts, paths, nil
+}
+
 func (s *sqliteStorage) Get(id []byte) (*entity.Forget, error) {
 	var forget entity.Forget
 
@@ -85,8 +221,11 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Forget, error) {
 		return nil, nil
 	}
 
-	err = s.db.QueryRow(`SELECT id, enabled, lastx, hourly, daily, weekly, monthly, yearly FROM forgets WHERE id = ?`, intID).Scan(
+	var keepTags, hosts, paths string
+	err = s.db.QueryRow(`SELECT id, backup_id, repo_id, enabled, lastx, hourly, daily, weekly, monthly, yearly, within, keep_tags, group_by, hosts, paths FROM forgets WHERE id = ?`, intID).Scan(
 		&forget.ID,
+		&forget.BackupID,
+		&forget.RepoID,
 		&forget.Enabled,
 		&forget.LastX,
 		&forget.Hourly,
@@ -94,11 +233,21 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Forget, error) {
 		&forget.Weekly,
 		&forget.Monthly,
 		&forget.Yearly,
+		&forget.Within,
+		&keepTags,
+		&forget.GroupBy,
+		&hosts,
+		&paths,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	err = decodeLists(&forget, keepTags, hosts, paths)
+	if err != nil {
+		return nil, err
+	}
+
 	return &forget, nil
 }
 
@@ -106,7 +255,7 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Forget, error) {
 func (s *sqliteStorage) GetAll() ([]*entity.Forget, error) {
 	var forgets []*entity.Forget
 
-	rows, err := s.db.Query(`SELECT id, enabled, lastx, hourly, daily, weekly, monthly, yearly FROM forgets`)
+	rows, err := s.db.Query(`SELECT id, backup_id, repo_id, enabled, lastx, hourly, daily, weekly, monthly, yearly, within, keep_tags, group_by, hosts, paths FROM forgets`)
 	if err != nil {
 		return nil, err
 	}
@@ -115,8 +264,11 @@ func (s *sqliteStorage) GetAll() ([]*entity.Forget, error) {
 	for rows.Next() {
 		var forget entity.Forget
 
+		var keepTags, hosts, paths string
 		err := rows.Scan(
 			&forget.ID,
+			&forget.BackupID,
+			&forget.RepoID,
 			&forget.Enabled,
 			&forget.LastX,
 			&forget.Hourly,
@@ -124,11 +276,21 @@ func (s *sqliteStorage) GetAll() ([]*entity.Forget, error) {
 			&forget.Weekly,
 			&forget.Monthly,
 			&forget.Yearly,
+			&forget.Within,
+			&keepTags,
+			&forget.GroupBy,
+			&hosts,
+			&paths,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		err = decodeLists(&forget, keepTags, hosts, paths)
+		if err != nil {
+			return nil, err
+		}
+
 		forgets = append(forgets, &forget)
 	}
 
@@ -136,7 +298,14 @@ func (s *sqliteStorage) GetAll() ([]*entity.Forget, error) {
 }
 
 func (s *sqliteStorage) Create(forget *entity.Forget) (*entity.Forget, error) {
-	result, err := s.db.Exec(`INSERT INTO forgets (enabled, lastx, hourly, daily, weekly, monthly, yearly) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	keepTags, hosts, paths, err := encodeLists(forget)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`INSERT INTO forgets (backup_id, repo_id, enabled, lastx, hourly, daily, weekly, monthly, yearly, within, keep_tags, group_by, hosts, paths) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		forget.BackupID,
+		forget.RepoID,
 		forget.Enabled,
 		forget.LastX,
 		forget.Hourly,
@@ -144,6 +313,11 @@ func (s *sqliteStorage) Create(forget *entity.Forget) (*entity.Forget, error) {
 		forget.Weekly,
 		forget.Monthly,
 		forget.Yearly,
+		forget.Within,
+		keepTags,
+		forget.GroupBy,
+		hosts,
+		paths,
 	)
 	if err != nil {
 		return nil, err
@@ -160,7 +334,14 @@ func (s *sqliteStorage) Create(forget *entity.Forget) (*entity.Forget, error) {
 }
 
 func (s *sqliteStorage) Update(forget *entity.Forget) (*entity.Forget, error) {
-	_, err := s.db.Exec(`UPDATE forgets SET enabled = ?, lastx = ?, hourly = ?, daily = ?, weekly = ?, monthly = ?, yearly = ? WHERE id = ?`,
+	keepTags, hosts, paths, err := encodeLists(forget)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE forgets SET backup_id = ?, repo_id = ?, enabled = ?, lastx = ?, hourly = ?, daily = ?, weekly = ?, monthly = ?, yearly = ?, within = ?, keep_tags = ?, group_by = ?, hosts = ?, paths = ? WHERE id = ?`,
+		forget.BackupID,
+		forget.RepoID,
 		forget.Enabled,
 		forget.LastX,
 		forget.Hourly,
@@ -168,6 +349,11 @@ func (s *sqliteStorage) Update(forget *entity.Forget) (*entity.Forget, error) {
 		forget.Weekly,
 		forget.Monthly,
 		forget.Yearly,
+		forget.Within,
+		keepTags,
+		forget.GroupBy,
+		hosts,
+		paths,
 		forget.ID,
 	)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 
 	_ "github.com/mattn/go-sqlite3"
 	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/server/service/adapter/migrate"
 )
 
 type sqliteStorage struct {
@@ -39,9 +40,15 @@ func initDB(db *sql.DB) error {
 	_, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS jobs (
 			id TEXT PRIMARY KEY,
+			type TEXT NOT NULL DEFAULT '',
+			backup_id INTEGER NOT NULL DEFAULT 0,
 			done INTEGER NOT NULL DEFAULT 0,
 			aborted INTEGER NOT NULL DEFAULT 0,
 			progress TEXT NOT NULL DEFAULT '{}',
+			agent_id INTEGER NOT NULL DEFAULT 0,
+			not_before TIMESTAMP,
+			deferred TEXT NOT NULL DEFAULT '',
+			delivered TEXT NOT NULL DEFAULT '[]',
 
 			start_time TIMESTAMP NOT NULL,
 			end_time TIMESTAMP
@@ -51,6 +58,18 @@ func initDB(db *sql.DB) error {
 		return err
 	}
 
+	err = migrate.Run(db, "jobs",
+		migrate.AddColumn("jobs", "type", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("jobs", "backup_id", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("jobs", "agent_id", `INTEGER NOT NULL DEFAULT 0`),
+		migrate.AddColumn("jobs", "not_before", `TIMESTAMP`),
+		migrate.AddColumn("jobs", "deferred", `TEXT NOT NULL DEFAULT ''`),
+		migrate.AddColumn("jobs", "delivered", `TEXT NOT NULL DEFAULT '[]'`),
+	)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -58,6 +77,21 @@ func (s *sqliteStorage) Close() error {
 	return s.db.Close()
 }
 
+// delivered encodes the IDs of the messages delivered for the job, as an empty
+// list if there are none.
+func (s *sqliteStorage) delivered(job *entity.Job) (string, error) {
+	if job.Delivered == nil {
+		return "[]", nil
+	}
+
+	delivered, err := json.Marshal(job.Delivered)
+	if err != nil {
+		return "", err
+	}
+
+	return string(delivered), nil
+}
+
 func (s *sqliteStorage) Get(id []byte) (*entity.Job, error) {
 	var job entity.Job
 
@@ -72,12 +106,19 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Job, error) {
 	}
 
 	var progress sql.NullString
-	var endTime sql.NullTime
-	err := s.db.QueryRow(`SELECT id, done, aborted, progress, start_time, end_time FROM jobs WHERE id = ?`, string(id)).Scan(
+	var endTime, notBefore sql.NullTime
+	var deferred, delivered string
+	err := s.db.QueryRow(`SELECT id, type, backup_id, done, aborted, progress, agent_id, not_before, deferred, delivered, start_time, end_time FROM jobs WHERE id = ?`, string(id)).Scan(
 		&job.ID,
+		&job.Type,
+		&job.BackupID,
 		&job.Done,
 		&job.Aborted,
 		&progress,
+		&job.AgentID,
+		&notBefore,
+		&deferred,
+		&delivered,
 		&job.StartTime,
 		&endTime,
 	)
@@ -89,6 +130,19 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Job, error) {
 		job.EndTime = endTime.Time
 	}
 
+	if notBefore.Valid {
+		job.NotBefore = notBefore.Time
+	}
+
+	if deferred != "" {
+		job.Deferred = json.RawMessage(deferred)
+	}
+
+	err = json.Unmarshal([]byte(delivered), &job.Delivered)
+	if err != nil {
+		return nil, err
+	}
+
 	if progress.Valid {
 		job.Progress = json.RawMessage(progress.String)
 	}
@@ -100,7 +154,7 @@ func (s *sqliteStorage) Get(id []byte) (*entity.Job, error) {
 func (s *sqliteStorage) GetAll() ([]*entity.Job, error) {
 	var jobs []*entity.Job
 
-	rows, err := s.db.Query(`SELECT id, done, aborted, progress, start_time, end_time FROM jobs`)
+	rows, err := s.db.Query(`SELECT id, type, backup_id, done, aborted, progress, agent_id, not_before, deferred, delivered, start_time, end_time FROM jobs`)
 	if err != nil {
 		return nil, err
 	}
@@ -109,12 +163,19 @@ func (s *sqliteStorage) GetAll() ([]*entity.Job, error) {
 	for rows.Next() {
 		var job entity.Job
 		var progress sql.NullString
-		var endTime sql.NullTime
+		var endTime, notBefore sql.NullTime
+		var deferred, delivered string
 		err := rows.Scan(
 			&job.ID,
+			&job.Type,
+			&job.BackupID,
 			&job.Done,
 			&job.Aborted,
 			&progress,
+			&job.AgentID,
+			&notBefore,
+			&deferred,
+			&delivered,
 			&job.StartTime,
 			&endTime,
 		)
@@ -126,6 +187,19 @@ func (s *sqliteStorage) GetAll() ([]*entity.Job, error) {
 			job.EndTime = endTime.Time
 		}
 
+		if notBefore.Valid {
+			job.NotBefore = notBefore.Time
+		}
+
+		if deferred != "" {
+			job.Deferred = json.RawMessage(deferred)
+		}
+
+		err = json.Unmarshal([]byte(delivered), &job.Delivered)
+		if err != nil {
+			return nil, err
+		}
+
 		if progress.Valid {
 			job.Progress = json.RawMessage(progress.String)
 		}
@@ -137,8 +211,13 @@ func (s *sqliteStorage) GetAll() ([]*entity.Job, error) {
 }
 
 func (s *sqliteStorage) Create(job *entity.Job) (*entity.Job, error) {
-	_, err := s.db.Exec(`INSERT INTO jobs (id, start_time) VALUES (?, ?)`,
+	_, err := s.db.Exec(`INSERT INTO jobs (id, type, backup_id, agent_id, not_before, deferred, start_time) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		job.ID,
+		job.Type,
+		job.BackupID,
+		job.AgentID,
+		job.NotBefore,
+		string(job.Deferred),
 		job.StartTime,
 	)
 	if err != nil {
@@ -149,10 +228,18 @@ func (s *sqliteStorage) Create(job *entity.Job) (*entity.Job, error) {
 }
 
 func (s *sqliteStorage) Update(job *entity.Job) (*entity.Job, error) {
-	_, err := s.db.Exec(`UPDATE jobs SET done = ?, aborted = ?, progress = ?, start_time = ?, end_time = ? WHERE id = ?`,
+	delivered, err := s.delivered(job)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE jobs SET done = ?, aborted = ?, progress = ?, not_before = ?, deferred = ?, delivered = ?, start_time = ?, end_time = ? WHERE id = ?`,
 		job.Done,
 		job.Aborted,
 		job.Progress,
+		job.NotBefore,
+		string(job.Deferred),
+		delivered,
 		job.StartTime,
 		job.EndTime,
 		job.ID,
@@ -0,0 +1,120 @@
+// Package migrate upgrades the schema of databases created by earlier
+// releases, which CREATE TABLE IF NOT EXISTS leaves as they are.
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Migration changes the schema of a table from one version to the next.
+//
+// Databases created by a release whose CREATE TABLE already had a change start
+// out at version 0 as well, so migrations have to be safe to run against a
+// table that has the change already.
+type Migration func(tx *sql.Tx) error
+
+func initDB(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_versions (
+			name TEXT PRIMARY KEY,
+			version INTEGER NOT NULL DEFAULT 0
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("migrate.initDB: failed to create table: %w", err)
+	}
+
+	return nil
+}
+
+// Run brings the table up to date by running, in order, the migrations it
+// hasn't had yet. The version of each table is the number of its migrations
+// that ran, kept in the schema_versions table. New migrations are only ever
+// appended.
+func Run(db *sql.DB, table string, migrations ...Migration) error {
+	if err := initDB(db); err != nil {
+		return err
+	}
+
+	var version int
+	err := db.QueryRow(`SELECT version FROM schema_versions WHERE name = ?`, table).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("migrate.Run: could not get version of %s: %w", table, err)
+	}
+
+	for ; version < len(migrations); version++ {
+		err := run(db, table, version+1, migrations[version])
+		if err != nil {
+			return fmt.Errorf("migrate.Run: could not migrate %s to version %d: %w", table, version+1, err)
+		}
+	}
+
+	return nil
+}
+
+// run runs the migration and records the table's new version, together or not
+// at all.
+func run(db *sql.DB, table string, version int, migration Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = migration(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_versions (name, version) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET version = excluded.version`, table, version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// HasColumn reports whether the table has the column.
+func HasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			typ       string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		err := rows.Scan(&cid, &name, &typ, &notNull, &dfltValue, &pk)
+		if err != nil {
+			return false, err
+		}
+
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// AddColumn returns a migration that adds the column unless the table has it.
+// The definition is as in CREATE TABLE, and needs a default if it is NOT NULL.
+func AddColumn(table, column, definition string) Migration {
+	return func(tx *sql.Tx) error {
+		exists, err := HasColumn(tx, table, column)
+		if err != nil || exists {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+		return err
+	}
+}
@@ -0,0 +1,135 @@
+package registrationToken
+
+import (
+	"fmt"
+	"sync"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+/*
+	Cache
+*/
+
+type MemoryCache struct {
+	mutex  sync.RWMutex
+	tokens map[string]*entity.RegistrationToken
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		mutex:  sync.RWMutex{},
+		tokens: make(map[string]*entity.RegistrationToken),
+	}
+}
+
+func (s *MemoryCache) Get(id []byte) (*entity.RegistrationToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, ok := s.tokens[string(id)]
+	if !ok {
+		return nil, nil
+	}
+
+	return token, nil
+}
+
+// TODO: Implement pagination.
+func (s *MemoryCache) GetAll() ([]*entity.RegistrationToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tokens := make([]*entity.RegistrationToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func (s *MemoryCache) Add(token *entity.RegistrationToken) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tokens[fmt.Sprint(token.ID)] = token
+	return nil
+}
+
+func (s *MemoryCache) Invalidate(id []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.tokens, string(id))
+	return nil
+}
+
+/*
+	Storage
+*/
+
+type MemoryStorage struct {
+	mutex  sync.RWMutex
+	tokens map[string]*entity.RegistrationToken
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		mutex:  sync.RWMutex{},
+		tokens: make(map[string]*entity.RegistrationToken),
+	}
+}
+
+func (s *MemoryStorage) Get(id []byte) (*entity.RegistrationToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, ok := s.tokens[string(id)]
+	if !ok {
+		return nil, nil
+	}
+
+	return token, nil
+}
+
+// TODO: Implement pagination.
+func (s *MemoryStorage) GetAll() ([]*entity.RegistrationToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tokens := make([]*entity.RegistrationToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func (s *MemoryStorage) Create(token *entity.RegistrationToken) (*entity.RegistrationToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := len(s.tokens) + 1
+	token.ID = id
+
+	s.tokens[fmt.Sprint(token.ID)] = token
+
+	return token, nil
+}
+
+func (s *MemoryStorage) Update(token *entity.RegistrationToken) (*entity.RegistrationToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tokens[fmt.Sprint(token.ID)] = token
+
+	return token, nil
+}
+
+func (s *MemoryStorage) Delete(id []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.tokens, string(id))
+	return nil
+}
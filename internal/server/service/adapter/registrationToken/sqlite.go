@@ -0,0 +1,225 @@
+package registrationToken
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	_ "github.com/mattn/go-sqlite3"
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+type sqliteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(dataSource string) (*sqliteStorage, error) {
+	db, err := sql.Open("sqlite3", dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	// Default values.
+	db.SetMaxOpenConns(0)
+	db.SetMaxIdleConns(2)
+
+	if err := initDB(db); err != nil {
+		return nil, err
+	}
+
+	return &sqliteStorage{
+		db: db,
+	}, nil
+}
+
+func initDB(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS registration_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL DEFAULT '',
+			token TEXT NOT NULL UNIQUE,
+			labels TEXT NOT NULL DEFAULT '{}',
+			one_time INTEGER NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP,
+			created_at TIMESTAMP,
+			used_by INTEGER NOT NULL DEFAULT 0,
+			used_at TIMESTAMP
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("registrationToken.initDB: failed to create table: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqliteStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStorage) labels(token *entity.RegistrationToken) (string, error) {
+	if token.Labels == nil {
+		return "{}", nil
+	}
+
+	labels, err := json.Marshal(token.Labels)
+	if err != nil {
+		return "", err
+	}
+
+	return string(labels), nil
+}
+
+// scan reads a token from the row, in the column order of the queries below.
+func scan(row interface{ Scan(...interface{}) error }) (*entity.RegistrationToken, error) {
+	var token entity.RegistrationToken
+	var labels string
+	var expiresAt, createdAt, usedAt sql.NullTime
+
+	err := row.Scan(
+		&token.ID,
+		&token.Name,
+		&token.Token,
+		&labels,
+		&token.OneTime,
+		&expiresAt,
+		&createdAt,
+		&token.UsedBy,
+		&usedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(labels), &token.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		token.ExpiresAt = expiresAt.Time
+	}
+
+	if createdAt.Valid {
+		token.CreatedAt = createdAt.Time
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = usedAt.Time
+	}
+
+	return &token, nil
+}
+
+func (s *sqliteStorage) Get(id []byte) (*entity.RegistrationToken, error) {
+	var exists bool
+	intID, err := strconv.Atoi(string(id))
+	if err != nil {
+		return nil, err
+	}
+	row := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM registration_tokens WHERE id = ?)", intID)
+	if err := row.Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	return scan(s.db.QueryRow(`SELECT id, name, token, labels, one_time, expires_at, created_at, used_by, used_at FROM registration_tokens WHERE id = ?`, intID))
+}
+
+// TODO: Implement pagination.
+func (s *sqliteStorage) GetAll() ([]*entity.RegistrationToken, error) {
+	var tokens []*entity.RegistrationToken
+
+	rows, err := s.db.Query(`SELECT id, name, token, labels, one_time, expires_at, created_at, used_by, used_at FROM registration_tokens`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		token, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func (s *sqliteStorage) Create(token *entity.RegistrationToken) (*entity.RegistrationToken, error) {
+	labels, err := s.labels(token)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`INSERT INTO registration_tokens (name, token, labels, one_time, expires_at, created_at, used_by, used_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		token.Name,
+		token.Token,
+		labels,
+		token.OneTime,
+		token.ExpiresAt,
+		token.CreatedAt,
+		token.UsedBy,
+		token.UsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	token.ID = int(id)
+
+	return token, nil
+}
+
+func (s *sqliteStorage) Update(token *entity.RegistrationToken) (*entity.RegistrationToken, error) {
+	labels, err := s.labels(token)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE registration_tokens SET name = ?, token = ?, labels = ?, one_time = ?, expires_at = ?, created_at = ?, used_by = ?, used_at = ? WHERE id = ?`,
+		token.Name,
+		token.Token,
+		labels,
+		token.OneTime,
+		token.ExpiresAt,
+		token.CreatedAt,
+		token.UsedBy,
+		token.UsedAt,
+		token.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *sqliteStorage) Delete(id []byte) error {
+	intID, err := strconv.Atoi(string(id))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`DELETE FROM registration_tokens WHERE id = ?`, intID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
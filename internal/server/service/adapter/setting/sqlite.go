@@ -70,6 +70,46 @@ func initDB(db *sql.DB) error {
 		return fmt.Errorf("setting.initDB: failed to create default: %w", err)
 	}
 
+	_, err = db.Exec("INSERT OR IGNORE INTO settings(key, value) VALUES(?, ?);", "registration-approval", "false")
+	if err != nil {
+		return fmt.Errorf("setting.initDB: failed to create default: %w", err)
+	}
+
+	_, err = db.Exec("INSERT OR IGNORE INTO settings(key, value) VALUES(?, ?);", "trusted-proxies", "[]")
+	if err != nil {
+		return fmt.Errorf("setting.initDB: failed to create default: %w", err)
+	}
+
+	_, err = db.Exec("INSERT OR IGNORE INTO settings(key, value) VALUES(?, ?);", "repo-concurrency", "0")
+	if err != nil {
+		return fmt.Errorf("setting.initDB: failed to create default: %w", err)
+	}
+
+	_, err = db.Exec("INSERT OR IGNORE INTO settings(key, value) VALUES(?, ?);", "schedules-paused", "false")
+	if err != nil {
+		return fmt.Errorf("setting.initDB: failed to create default: %w", err)
+	}
+
+	_, err = db.Exec("INSERT OR IGNORE INTO settings(key, value) VALUES(?, ?);", "agent-offline-after", `"90s"`)
+	if err != nil {
+		return fmt.Errorf("setting.initDB: failed to create default: %w", err)
+	}
+
+	_, err = db.Exec("INSERT OR IGNORE INTO settings(key, value) VALUES(?, ?);", "offline-agents", `"flag"`)
+	if err != nil {
+		return fmt.Errorf("setting.initDB: failed to create default: %w", err)
+	}
+
+	_, err = db.Exec("INSERT OR IGNORE INTO settings(key, value) VALUES(?, ?);", "unsupported-options", `"drop"`)
+	if err != nil {
+		return fmt.Errorf("setting.initDB: failed to create default: %w", err)
+	}
+
+	_, err = db.Exec("INSERT OR IGNORE INTO settings(key, value) VALUES(?, ?);", "psk-rotation-interval", `""`)
+	if err != nil {
+		return fmt.Errorf("setting.initDB: failed to create default: %w", err)
+	}
+
 	return nil
 }
 
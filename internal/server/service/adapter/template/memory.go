@@ -0,0 +1,135 @@
+package template
+
+import (
+	"fmt"
+	"sync"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+/*
+	Cache
+*/
+
+type MemoryCache struct {
+	mutex     sync.RWMutex
+	templates map[string]*entity.Template
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		mutex:     sync.RWMutex{},
+		templates: make(map[string]*entity.Template),
+	}
+}
+
+func (s *MemoryCache) Get(id []byte) (*entity.Template, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	template, ok := s.templates[string(id)]
+	if !ok {
+		return nil, nil
+	}
+
+	return template, nil
+}
+
+// TODO: Implement pagination.
+func (s *MemoryCache) GetAll() ([]*entity.Template, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	templates := make([]*entity.Template, 0, len(s.templates))
+	for _, template := range s.templates {
+		templates = append(templates, template)
+	}
+
+	return templates, nil
+}
+
+func (s *MemoryCache) Add(template *entity.Template) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.templates[fmt.Sprint(template.ID)] = template
+	return nil
+}
+
+func (s *MemoryCache) Invalidate(id []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.templates, string(id))
+	return nil
+}
+
+/*
+	Storage
+*/
+
+type MemoryStorage struct {
+	mutex     sync.RWMutex
+	templates map[string]*entity.Template
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		mutex:     sync.RWMutex{},
+		templates: make(map[string]*entity.Template),
+	}
+}
+
+func (s *MemoryStorage) Get(id []byte) (*entity.Template, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	template, ok := s.templates[string(id)]
+	if !ok {
+		return nil, nil
+	}
+
+	return template, nil
+}
+
+// TODO: Implement pagination.
+func (s *MemoryStorage) GetAll() ([]*entity.Template, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	templates := make([]*entity.Template, 0, len(s.templates))
+	for _, template := range s.templates {
+		templates = append(templates, template)
+	}
+
+	return templates, nil
+}
+
+func (s *MemoryStorage) Create(template *entity.Template) (*entity.Template, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := len(s.templates) + 1
+	template.ID = id
+
+	s.templates[fmt.Sprint(template.ID)] = template
+
+	return template, nil
+}
+
+func (s *MemoryStorage) Update(template *entity.Template) (*entity.Template, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.templates[fmt.Sprint(template.ID)] = template
+
+	return template, nil
+}
+
+func (s *MemoryStorage) Delete(id []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.templates, string(id))
+	return nil
+}
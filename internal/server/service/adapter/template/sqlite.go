@@ -0,0 +1,214 @@
+package template
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+type sqliteStorage struct {
+	db       *sql.DB
+	sliceSep string
+}
+
+func NewSQLiteStorage(dataSource string) (*sqliteStorage, error) {
+	db, err := sql.Open("sqlite3", dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	// Default values.
+	db.SetMaxOpenConns(0)
+	db.SetMaxIdleConns(2)
+
+	if err := initDB(db); err != nil {
+		return nil, err
+	}
+
+	return &sqliteStorage{
+		db:       db,
+		sliceSep: ",",
+	}, nil
+}
+
+func initDB(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			target INTEGER NOT NULL,
+			source TEXT NOT NULL,
+			exclude TEXT NOT NULL DEFAULT '',
+			schedules TEXT NOT NULL DEFAULT '[]',
+			selector TEXT NOT NULL DEFAULT ''
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("template.initDB: failed to create table: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqliteStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStorage) split(value string) []string {
+	if value == "" {
+		return make([]string, 0)
+	}
+	return strings.Split(value, s.sliceSep)
+}
+
+func (s *sqliteStorage) Get(id []byte) (*entity.Template, error) {
+	var template entity.Template
+
+	var exists bool
+	intID, err := strconv.Atoi(string(id))
+	if err != nil {
+		return nil, err
+	}
+	row := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM templates WHERE id = ?)", intID)
+	if err := row.Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	var exclude, schedules string
+	err = s.db.QueryRow(`SELECT id, name, target, source, exclude, schedules, selector FROM templates WHERE id = ?`, intID).Scan(
+		&template.ID,
+		&template.Name,
+		&template.Target,
+		&template.Source,
+		&exclude,
+		&schedules,
+		&template.Selector,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(schedules), &template.Schedules)
+	if err != nil {
+		return nil, err
+	}
+	template.Exclude = s.split(exclude)
+
+	return &template, nil
+}
+
+// TODO: Implement pagination.
+func (s *sqliteStorage) GetAll() ([]*entity.Template, error) {
+	var templates []*entity.Template
+
+	rows, err := s.db.Query(`SELECT id, name, target, source, exclude, schedules, selector FROM templates`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var template entity.Template
+
+		var exclude, schedules string
+		err := rows.Scan(
+			&template.ID,
+			&template.Name,
+			&template.Target,
+			&template.Source,
+			&exclude,
+			&schedules,
+			&template.Selector,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(schedules), &template.Schedules)
+		if err != nil {
+			return nil, err
+		}
+		template.Exclude = s.split(exclude)
+
+		templates = append(templates, &template)
+	}
+
+	return templates, nil
+}
+
+func (s *sqliteStorage) Create(template *entity.Template) (*entity.Template, error) {
+	schedules, err := json.Marshal(template.Schedules)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`INSERT INTO templates (name, target, source, exclude, schedules, selector) VALUES (?, ?, ?, ?, ?, ?)`,
+		template.Name,
+		template.Target,
+		template.Source,
+		strings.Join(template.Exclude, s.sliceSep),
+		string(schedules),
+		template.Selector,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	template.ID = int(id)
+
+	return template, nil
+}
+
+func (s *sqliteStorage) Update(template *entity.Template) (*entity.Template, error) {
+	schedules, err := json.Marshal(template.Schedules)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE templates SET name = ?, target = ?, source = ?, exclude = ?, schedules = ?, selector = ? WHERE id = ?`,
+		template.Name,
+		template.Target,
+		template.Source,
+		strings.Join(template.Exclude, s.sliceSep),
+		string(schedules),
+		template.Selector,
+		template.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (s *sqliteStorage) Delete(id []byte) error {
+	intID, err := strconv.Atoi(string(id))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`DELETE FROM templates WHERE id = ?`, intID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package user
+
+import (
+	"fmt"
+	"sync"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+/*
+	Cache
+*/
+
+type MemoryCache struct {
+	mutex sync.RWMutex
+	users map[string]*entity.User
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		mutex: sync.RWMutex{},
+		users: make(map[string]*entity.User),
+	}
+}
+
+func (s *MemoryCache) Get(id []byte) (*entity.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, ok := s.users[string(id)]
+	if !ok {
+		return nil, nil
+	}
+
+	return user, nil
+}
+
+// TODO: Implement pagination.
+func (s *MemoryCache) GetAll() ([]*entity.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	users := make([]*entity.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+func (s *MemoryCache) Add(user *entity.User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.users[fmt.Sprint(user.ID)] = user
+	return nil
+}
+
+func (s *MemoryCache) Invalidate(id []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.users, string(id))
+	return nil
+}
+
+/*
+	Storage
+*/
+
+type MemoryStorage struct {
+	mutex sync.RWMutex
+	users map[string]*entity.User
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		mutex: sync.RWMutex{},
+		users: make(map[string]*entity.User),
+	}
+}
+
+func (s *MemoryStorage) Get(id []byte) (*entity.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, ok := s.users[string(id)]
+	if !ok {
+		return nil, nil
+	}
+
+	return user, nil
+}
+
+// TODO: Implement pagination.
+func (s *MemoryStorage) GetAll() ([]*entity.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	users := make([]*entity.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+func (s *MemoryStorage) GetByUsername(username string) (*entity.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *MemoryStorage) Create(user *entity.User) (*entity.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := len(s.users) + 1
+	user.ID = id
+
+	s.users[fmt.Sprint(user.ID)] = user
+
+	return user, nil
+}
+
+func (s *MemoryStorage) Update(user *entity.User) (*entity.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.users[fmt.Sprint(user.ID)] = user
+
+	return user, nil
+}
+
+func (s *MemoryStorage) Delete(id []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.users, string(id))
+	return nil
+}
@@ -0,0 +1,265 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	_ "github.com/mattn/go-sqlite3"
+	"zerosrealm.xyz/tergum/internal/entity"
+	"zerosrealm.xyz/tergum/internal/server/service/adapter/migrate"
+)
+
+type sqliteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(dataSource string) (*sqliteStorage, error) {
+	db, err := sql.Open("sqlite3", dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	// Default values.
+	db.SetMaxOpenConns(0)
+	db.SetMaxIdleConns(2)
+
+	if err := initDB(db); err != nil {
+		return nil, err
+	}
+
+	return &sqliteStorage{
+		db: db,
+	}, nil
+}
+
+func initDB(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL UNIQUE,
+			password TEXT NOT NULL,
+			created_at TIMESTAMP,
+			role TEXT NOT NULL DEFAULT 'viewer',
+			scope TEXT NOT NULL DEFAULT 'null'
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("user.initDB: failed to create table: %w", err)
+	}
+
+	err = migrate.Run(db, "users",
+		addRole,
+		migrate.AddColumn("users", "scope", `TEXT NOT NULL DEFAULT 'null'`),
+	)
+	if err != nil {
+		return fmt.Errorf("user.initDB: %w", err)
+	}
+
+	return nil
+}
+
+// addRole adds the role column. Users from before roles could do everything,
+// so they stay admins, while users added after default to the least access.
+func addRole(tx *sql.Tx) error {
+	exists, err := migrate.HasColumn(tx, "users", "role")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer'`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET role = ?`, entity.RoleAdmin)
+	return err
+}
+
+func (s *sqliteStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStorage) Get(id []byte) (*entity.User, error) {
+	var user entity.User
+
+	var exists bool
+	intID, err := strconv.Atoi(string(id))
+	if err != nil {
+		return nil, err
+	}
+	row := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", intID)
+	if err := row.Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	var createdAt sql.NullTime
+	var scope string
+	err = s.db.QueryRow(`SELECT id, username, password, created_at, role, scope FROM users WHERE id = ?`, intID).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&createdAt,
+		&user.Role,
+		&scope,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if createdAt.Valid {
+		user.CreatedAt = createdAt.Time
+	}
+
+	err = json.Unmarshal([]byte(scope), &user.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// TODO: Implement pagination.
+func (s *sqliteStorage) GetAll() ([]*entity.User, error) {
+	var users []*entity.User
+
+	rows, err := s.db.Query(`SELECT id, username, password, created_at, role, scope FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user entity.User
+		var createdAt sql.NullTime
+		var scope string
+
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Password,
+			&createdAt,
+			&user.Role,
+			&scope,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if createdAt.Valid {
+			user.CreatedAt = createdAt.Time
+		}
+
+		err = json.Unmarshal([]byte(scope), &user.Scope)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, nil
+}
+
+func (s *sqliteStorage) GetByUsername(username string) (*entity.User, error) {
+	var user entity.User
+	var createdAt sql.NullTime
+	var scope string
+
+	err := s.db.QueryRow(`SELECT id, username, password, created_at, role, scope FROM users WHERE username = ?`, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&createdAt,
+		&user.Role,
+		&scope,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if createdAt.Valid {
+		user.CreatedAt = createdAt.Time
+	}
+
+	err = json.Unmarshal([]byte(scope), &user.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *sqliteStorage) Create(user *entity.User) (*entity.User, error) {
+	scope, err := json.Marshal(user.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`INSERT INTO users (username, password, created_at, role, scope) VALUES (?, ?, ?, ?, ?)`,
+		user.Username,
+		user.Password,
+		user.CreatedAt,
+		user.Role,
+		string(scope),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	user.ID = int(id)
+
+	return user, nil
+}
+
+func (s *sqliteStorage) Update(user *entity.User) (*entity.User, error) {
+	scope, err := json.Marshal(user.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE users SET username = ?, password = ?, created_at = ?, role = ?, scope = ? WHERE id = ?`,
+		user.Username,
+		user.Password,
+		user.CreatedAt,
+		user.Role,
+		string(scope),
+		user.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *sqliteStorage) Delete(id []byte) error {
+	intID, err := strconv.Atoi(string(id))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`DELETE FROM users WHERE id = ?`, intID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
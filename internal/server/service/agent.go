@@ -20,6 +20,9 @@ type AgentStorage interface {
 	GetAll() ([]*entity.Agent, error)
 	Create(agent *entity.Agent) (*entity.Agent, error)
 	Update(agent *entity.Agent) (*entity.Agent, error)
+	// UpdateHeartbeat stores only what the agent reports with its heartbeats and
+	// when it was last seen, leaving changes made since it was read in place.
+	UpdateHeartbeat(agent *entity.Agent) (*entity.Agent, error)
 	Delete(id []byte) error
 }
 
@@ -121,6 +124,23 @@ func (svc *AgentService) Update(agent *entity.Agent) (*entity.Agent, error) {
 	return agent, nil
 }
 
+func (svc *AgentService) UpdateHeartbeat(agent *entity.Agent) (*entity.Agent, error) {
+	agent, err := svc.storage.UpdateHeartbeat(agent)
+	if err != nil {
+		return nil, fmt.Errorf("agentSvc.UpdateHeartbeat: could not update agent: %w", err)
+	}
+
+	if svc.cache != nil {
+		id := strconv.Itoa(agent.ID)
+		err = svc.cache.Invalidate([]byte(id))
+		if err != nil {
+			return nil, fmt.Errorf("agentSvc.UpdateHeartbeat: could not invalidate agent in cache: %w", err)
+		}
+	}
+
+	return agent, nil
+}
+
 func (svc *AgentService) Delete(id []byte) error {
 	err := svc.storage.Delete(id)
 	if err != nil {
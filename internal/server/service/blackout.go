@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+type BlackoutCache interface {
+	Get(id []byte) (*entity.Blackout, error)
+	GetAll() ([]*entity.Blackout, error)
+
+	Add(blackout *entity.Blackout) error
+	Invalidate(id []byte) error
+}
+
+type BlackoutStorage interface {
+	Get(id []byte) (*entity.Blackout, error)
+	GetAll() ([]*entity.Blackout, error)
+	Create(blackout *entity.Blackout) (*entity.Blackout, error)
+	Update(blackout *entity.Blackout) (*entity.Blackout, error)
+	Delete(id []byte) error
+}
+
+type BlackoutService struct {
+	cache   BlackoutCache
+	storage BlackoutStorage
+}
+
+func NewBlackoutService(cache *BlackoutCache, storage *BlackoutStorage) *BlackoutService {
+	return &BlackoutService{
+		cache:   *cache,
+		storage: *storage,
+	}
+}
+
+func (svc *BlackoutService) Get(id []byte) (*entity.Blackout, error) {
+	if svc.cache != nil {
+		blackout, err := svc.cache.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("blackoutSvc.Get: could not get blackout from cache: %w", err)
+		}
+
+		if blackout != nil {
+			return blackout, nil
+		}
+	}
+
+	blackout, err := svc.storage.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("blackoutSvc.Get: could not get blackout from storage: %w", err)
+	}
+	return blackout, nil
+}
+
+func (svc *BlackoutService) GetAll() ([]*entity.Blackout, error) {
+	if svc.cache != nil {
+		blackouts, err := svc.cache.GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("blackoutSvc.GetAll: could not get blackouts from cache: %w", err)
+		}
+
+		if len(blackouts) > 0 {
+			return blackouts, nil
+		}
+	}
+
+	blackouts, err := svc.storage.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("blackoutSvc.GetAll: could not get blackouts from cache: %w", err)
+	}
+	return blackouts, nil
+}
+
+func (svc *BlackoutService) Create(blackout *entity.Blackout) (*entity.Blackout, error) {
+	blackout, err := svc.storage.Create(blackout)
+	if err != nil {
+		return nil, fmt.Errorf("blackoutSvc.Create: could not create blackout: %w", err)
+	}
+
+	if svc.cache != nil {
+		err = svc.cache.Add(blackout)
+		if err != nil {
+			return nil, fmt.Errorf("blackoutSvc.Create: could not add blackout to cache: %w", err)
+		}
+	}
+
+	return blackout, nil
+}
+
+func (svc *BlackoutService) Update(blackout *entity.Blackout) (*entity.Blackout, error) {
+	blackout, err := svc.storage.Update(blackout)
+	if err != nil {
+		return nil, fmt.Errorf("blackoutSvc.Update: could not update blackout: %w", err)
+	}
+
+	if svc.cache != nil {
+		id := strconv.Itoa(blackout.ID)
+		err = svc.cache.Invalidate([]byte(id))
+		if err != nil {
+			return nil, fmt.Errorf("blackoutSvc.Create: could not invalidate blackout in cache: %w", err)
+		}
+	}
+
+	return blackout, nil
+}
+
+func (svc *BlackoutService) Delete(id []byte) error {
+	err := svc.storage.Delete(id)
+	if err != nil {
+		return fmt.Errorf("blackoutSvc.Delete: could not delete blackout: %w", err)
+	}
+
+	if svc.cache != nil {
+		err = svc.cache.Invalidate(id)
+		if err != nil {
+			return fmt.Errorf("blackoutSvc.Delete: could not invalidate blackout in cache: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+type RegistrationTokenCache interface {
+	Get(id []byte) (*entity.RegistrationToken, error)
+	GetAll() ([]*entity.RegistrationToken, error)
+
+	Add(token *entity.RegistrationToken) error
+	Invalidate(id []byte) error
+}
+
+type RegistrationTokenStorage interface {
+	Get(id []byte) (*entity.RegistrationToken, error)
+	GetAll() ([]*entity.RegistrationToken, error)
+	Create(token *entity.RegistrationToken) (*entity.RegistrationToken, error)
+	Update(token *entity.RegistrationToken) (*entity.RegistrationToken, error)
+	Delete(id []byte) error
+}
+
+type RegistrationTokenService struct {
+	cache   RegistrationTokenCache
+	storage RegistrationTokenStorage
+}
+
+func NewRegistrationTokenService(cache *RegistrationTokenCache, storage *RegistrationTokenStorage) *RegistrationTokenService {
+	return &RegistrationTokenService{
+		cache:   *cache,
+		storage: *storage,
+	}
+}
+
+func (svc *RegistrationTokenService) Get(id []byte) (*entity.RegistrationToken, error) {
+	if svc.cache != nil {
+		token, err := svc.cache.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("registrationTokenSvc.Get: could not get token from cache: %w", err)
+		}
+
+		if token != nil {
+			return token, nil
+		}
+	}
+
+	token, err := svc.storage.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("registrationTokenSvc.Get: could not get token from storage: %w", err)
+	}
+	return token, nil
+}
+
+func (svc *RegistrationTokenService) GetAll() ([]*entity.RegistrationToken, error) {
+	if svc.cache != nil {
+		tokens, err := svc.cache.GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("registrationTokenSvc.GetAll: could not get tokens from cache: %w", err)
+		}
+
+		if len(tokens) > 0 {
+			return tokens, nil
+		}
+	}
+
+	tokens, err := svc.storage.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("registrationTokenSvc.GetAll: could not get tokens from cache: %w", err)
+	}
+	return tokens, nil
+}
+
+func (svc *RegistrationTokenService) Create(token *entity.RegistrationToken) (*entity.RegistrationToken, error) {
+	token, err := svc.storage.Create(token)
+	if err != nil {
+		return nil, fmt.Errorf("registrationTokenSvc.Create: could not create token: %w", err)
+	}
+
+	if svc.cache != nil {
+		err = svc.cache.Add(token)
+		if err != nil {
+			return nil, fmt.Errorf("registrationTokenSvc.Create: could not add token to cache: %w", err)
+		}
+	}
+
+	return token, nil
+}
+
+func (svc *RegistrationTokenService) Update(token *entity.RegistrationToken) (*entity.RegistrationToken, error) {
+	token, err := svc.storage.Update(token)
+	if err != nil {
+		return nil, fmt.Errorf("registrationTokenSvc.Update: could not update token: %w", err)
+	}
+
+	if svc.cache != nil {
+		id := strconv.Itoa(token.ID)
+		err = svc.cache.Invalidate([]byte(id))
+		if err != nil {
+			return nil, fmt.Errorf("registrationTokenSvc.Update: could not invalidate token in cache: %w", err)
+		}
+	}
+
+	return token, nil
+}
+
+func (svc *RegistrationTokenService) Delete(id []byte) error {
+	err := svc.storage.Delete(id)
+	if err != nil {
+		return fmt.Errorf("registrationTokenSvc.Delete: could not delete token: %w", err)
+	}
+
+	if svc.cache != nil {
+		err = svc.cache.Invalidate(id)
+		if err != nil {
+			return fmt.Errorf("registrationTokenSvc.Delete: could not invalidate token in cache: %w", err)
+		}
+	}
+	return nil
+}
@@ -6,18 +6,26 @@ type Services struct {
 	BackupSvc    BackupService
 	BackupSubSvc BackupSubscriberService
 	ForgetSvc    ForgetService
+	BlackoutSvc  BlackoutService
+	TemplateSvc  TemplateService
 	JobSvc       JobService
 	SettingSvc   SettingService
+	TokenSvc     RegistrationTokenService
+	UserSvc      UserService
 }
 
-func NewServices(repoSvc *RepoService, agentSvc *AgentService, backupSvc *BackupService, backupSubSvc *BackupSubscriberService, forgetSvc *ForgetService, jobSvc *JobService, settingSvc *SettingService) *Services {
+func NewServices(repoSvc *RepoService, agentSvc *AgentService, backupSvc *BackupService, backupSubSvc *BackupSubscriberService, forgetSvc *ForgetService, blackoutSvc *BlackoutService, templateSvc *TemplateService, jobSvc *JobService, settingSvc *SettingService, tokenSvc *RegistrationTokenService, userSvc *UserService) *Services {
 	return &Services{
 		RepoSvc:      *repoSvc,
 		AgentSvc:     *agentSvc,
 		BackupSvc:    *backupSvc,
 		BackupSubSvc: *backupSubSvc,
 		ForgetSvc:    *forgetSvc,
+		BlackoutSvc:  *blackoutSvc,
+		TemplateSvc:  *templateSvc,
 		JobSvc:       *jobSvc,
 		SettingSvc:   *settingSvc,
+		TokenSvc:     *tokenSvc,
+		UserSvc:      *userSvc,
 	}
 }
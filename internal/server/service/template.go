@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+type TemplateCache interface {
+	Get(id []byte) (*entity.Template, error)
+	GetAll() ([]*entity.Template, error)
+
+	Add(template *entity.Template) error
+	Invalidate(id []byte) error
+}
+
+type TemplateStorage interface {
+	Get(id []byte) (*entity.Template, error)
+	GetAll() ([]*entity.Template, error)
+	Create(template *entity.Template) (*entity.Template, error)
+	Update(template *entity.Template) (*entity.Template, error)
+	Delete(id []byte) error
+}
+
+type TemplateService struct {
+	cache   TemplateCache
+	storage TemplateStorage
+}
+
+func NewTemplateService(cache *TemplateCache, storage *TemplateStorage) *TemplateService {
+	return &TemplateService{
+		cache:   *cache,
+		storage: *storage,
+	}
+}
+
+func (svc *TemplateService) Get(id []byte) (*entity.Template, error) {
+	if svc.cache != nil {
+		template, err := svc.cache.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("templateSvc.Get: could not get template from cache: %w", err)
+		}
+
+		if template != nil {
+			return template, nil
+		}
+	}
+
+	template, err := svc.storage.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("templateSvc.Get: could not get template from storage: %w", err)
+	}
+	return template, nil
+}
+
+func (svc *TemplateService) GetAll() ([]*entity.Template, error) {
+	if svc.cache != nil {
+		templates, err := svc.cache.GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("templateSvc.GetAll: could not get templates from cache: %w", err)
+		}
+
+		if len(templates) > 0 {
+			return templates, nil
+		}
+	}
+
+	templates, err := svc.storage.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("templateSvc.GetAll: could not get templates from cache: %w", err)
+	}
+	return templates, nil
+}
+
+func (svc *TemplateService) Create(template *entity.Template) (*entity.Template, error) {
+	template, err := svc.storage.Create(template)
+	if err != nil {
+		return nil, fmt.Errorf("templateSvc.Create: could not create template: %w", err)
+	}
+
+	if svc.cache != nil {
+		err = svc.cache.Add(template)
+		if err != nil {
+			return nil, fmt.Errorf("templateSvc.Create: could not add template to cache: %w", err)
+		}
+	}
+
+	return template, nil
+}
+
+func (svc *TemplateService) Update(template *entity.Template) (*entity.Template, error) {
+	template, err := svc.storage.Update(template)
+	if err != nil {
+		return nil, fmt.Errorf("templateSvc.Update: could not update template: %w", err)
+	}
+
+	if svc.cache != nil {
+		id := strconv.Itoa(template.ID)
+		err = svc.cache.Invalidate([]byte(id))
+		if err != nil {
+			return nil, fmt.Errorf("templateSvc.Create: could not invalidate template in cache: %w", err)
+		}
+	}
+
+	return template, nil
+}
+
+func (svc *TemplateService) Delete(id []byte) error {
+	err := svc.storage.Delete(id)
+	if err != nil {
+		return fmt.Errorf("templateSvc.Delete: could not delete template: %w", err)
+	}
+
+	if svc.cache != nil {
+		err = svc.cache.Invalidate(id)
+		if err != nil {
+			return fmt.Errorf("templateSvc.Delete: could not invalidate template in cache: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+
+	"zerosrealm.xyz/tergum/internal/entity"
+)
+
+type UserCache interface {
+	Get(id []byte) (*entity.User, error)
+	GetAll() ([]*entity.User, error)
+
+	Add(user *entity.User) error
+	Invalidate(id []byte) error
+}
+
+type UserStorage interface {
+	Get(id []byte) (*entity.User, error)
+	GetAll() ([]*entity.User, error)
+	GetByUsername(username string) (*entity.User, error)
+	Create(user *entity.User) (*entity.User, error)
+	Update(user *entity.User) (*entity.User, error)
+	Delete(id []byte) error
+}
+
+type UserService struct {
+	cache   UserCache
+	storage UserStorage
+}
+
+func NewUserService(cache *UserCache, storage *UserStorage) *UserService {
+	return &UserService{
+		cache:   *cache,
+		storage: *storage,
+	}
+}
+
+func (svc *UserService) Get(id []byte) (*entity.User, error) {
+	if svc.cache != nil {
+		user, err := svc.cache.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("userSvc.Get: could not get user from cache: %w", err)
+		}
+
+		if user != nil {
+			return user, nil
+		}
+	}
+
+	user, err := svc.storage.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("userSvc.Get: could not get user from storage: %w", err)
+	}
+	return user, nil
+}
+
+func (svc *UserService) GetAll() ([]*entity.User, error) {
+	if svc.cache != nil {
+		users, err := svc.cache.GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("userSvc.GetAll: could not get users from cache: %w", err)
+		}
+
+		if len(users) > 0 {
+			return users, nil
+		}
+	}
+
+	users, err := svc.storage.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("userSvc.GetAll: could not get users from cache: %w", err)
+	}
+	return users, nil
+}
+
+// GetByUsername returns the user with the username, nil if there is none. It
+// always reads from storage, as the cache only knows users by ID.
+func (svc *UserService) GetByUsername(username string) (*entity.User, error) {
+	user, err := svc.storage.GetByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("userSvc.GetByUsername: could not get user from storage: %w", err)
+	}
+	return user, nil
+}
+
+func (svc *UserService) Create(user *entity.User) (*entity.User, error) {
+	user, err := svc.storage.Create(user)
+	if err != nil {
+		return nil, fmt.Errorf("userSvc.Create: could not create user: %w", err)
+	}
+
+	if svc.cache != nil {
+		err = svc.cache.Add(user)
+		if err != nil {
+			return nil, fmt.Errorf("userSvc.Create: could not add user to cache: %w", err)
+		}
+	}
+
+	return user, nil
+}
+
+func (svc *UserService) Update(user *entity.User) (*entity.User, error) {
+	user, err := svc.storage.Update(user)
+	if err != nil {
+		return nil, fmt.Errorf("userSvc.Update: could not update user: %w", err)
+	}
+
+	if svc.cache != nil {
+		id := strconv.Itoa(user.ID)
+		err = svc.cache.Invalidate([]byte(id))
+		if err != nil {
+			return nil, fmt.Errorf("userSvc.Update: could not invalidate user in cache: %w", err)
+		}
+	}
+
+	return user, nil
+}
+
+func (svc *UserService) Delete(id []byte) error {
+	err := svc.storage.Delete(id)
+	if err != nil {
+		return fmt.Errorf("userSvc.Delete: could not delete user: %w", err)
+	}
+
+	if svc.cache != nil {
+		err = svc.cache.Invalidate(id)
+		if err != nil {
+			return fmt.Errorf("userSvc.Delete: could not invalidate user in cache: %w", err)
+		}
+	}
+	return nil
+}
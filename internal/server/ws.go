@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/gorilla/websocket"
+	manager "zerosrealm.xyz/tergum/internal/server/manager"
 )
 
 var upgrader = websocket.Upgrader{
@@ -13,15 +14,31 @@ var upgrader = websocket.Upgrader{
 } // use default options
 
 func (srv *Server) ws(w http.ResponseWriter, req *http.Request) {
+	// Like the API, the websocket is only for users who are logged in.
+	user, err := srv.manager.RequestUser(req)
+	if err != nil {
+		srv.log.Error("ws: error getting session", err)
+		http.Error(w, "could not get session", http.StatusInternalServerError)
+		return
+	}
+
+	if user == nil {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	// RequestUser found the session, so the cookie is there.
+	cookie, _ := req.Cookie(manager.SessionCookie)
+
 	c, err := upgrader.Upgrade(w, req, nil)
 	if err != nil {
 		srv.log.Error("ws: error upgrading connection", err)
 		return
 	}
-	wsConnections[c.RemoteAddr().String()] = c
-	defer closeWS(c)
+	out := srv.manager.AddWS(c, cookie.Value, user.ID)
+	defer srv.manager.RemoveWS(c)
 	for {
-		mt, msg, err := c.ReadMessage()
+		_, msg, err := c.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				srv.log.Error("ws: error reading message", err)
@@ -52,10 +69,8 @@ func (srv *Server) ws(w http.ResponseWriter, req *http.Request) {
 			resp = msg
 		}
 
-		err = c.WriteMessage(mt, resp)
-		if err != nil {
-			srv.log.Error("ws: error writing message", err)
-			break
-		}
+		// Replies go through the same queue as everything else, as only its
+		// sender may write to the connection.
+		out.Push(resp)
 	}
 }
@@ -0,0 +1,68 @@
+// Package tlsconfig builds the TLS settings shared by the server and the
+// agents.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Client returns the TLS config for connecting to a peer. Its certificate is
+// verified against the CA certificates in the PEM file at ca, or against the
+// system's when ca is empty.
+func Client(ca string) (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if ca == "" {
+		return conf, nil
+	}
+
+	pool, err := loadCA(ca)
+	if err != nil {
+		return nil, err
+	}
+	conf.RootCAs = pool
+
+	return conf, nil
+}
+
+// Server returns the TLS config for serving with the certificate and key in the
+// PEM files at cert and key.
+func Server(cert, key string) (*tls.Config, error) {
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("tlsconfig: could not load certificate: %w", err)
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{pair},
+	}, nil
+}
+
+// HTTPClient returns an HTTP client connecting with the TLS config.
+func HTTPClient(conf *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+
+	return &http.Client{Transport: transport}
+}
+
+func loadCA(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tlsconfig: could not read CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("tlsconfig: no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
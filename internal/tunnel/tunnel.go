@@ -0,0 +1,280 @@
+// Package tunnel carries HTTP requests in both directions over a single
+// websocket, so agents that can't be reached by the server can keep a connection
+// open to it instead.
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
+)
+
+const (
+	pingInterval = 30 * time.Second
+	pongWait     = 2 * pingInterval
+	writeWait    = 10 * time.Second
+)
+
+// ErrClosed is returned for requests that were pending when the connection
+// closed, or made after it closed.
+var ErrClosed = errors.New("tunnel: connection closed")
+
+// Message sent over the tunnel. Requests are answered by a response with the
+// same ID.
+type Message struct {
+	ID     string      `json:"id"`
+	Type   string      `json:"type"`
+	Method string      `json:"method,omitempty"`
+	Path   string      `json:"path,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Status int         `json:"status,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Message types.
+const (
+	TypeRequest  = "request"
+	TypeResponse = "response"
+)
+
+// Conn is one end of a tunnel. Requests from the other end are served by the
+// handler with the given headers added, which is how they are authenticated.
+type Conn struct {
+	ws      *websocket.Conn
+	handler http.Handler
+	header  http.Header
+
+	writeMutex sync.Mutex
+
+	pendingMutex sync.Mutex
+	pending      map[string]chan *Message
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// New tunnel over the websocket connection.
+func New(ws *websocket.Conn, handler http.Handler, header http.Header) *Conn {
+	return &Conn{
+		ws:      ws,
+		handler: handler,
+		header:  header,
+
+		pending: make(map[string]chan *Message),
+		done:    make(chan struct{}),
+	}
+}
+
+// Serve reads from the connection until it closes, serving requests and
+// delivering responses to Do.
+func (c *Conn) Serve() error {
+	defer c.Close()
+
+	c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go c.ping()
+
+	for {
+		var msg Message
+		err := c.ws.ReadJSON(&msg)
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+
+		switch msg.Type {
+		case TypeRequest:
+			go c.serve(&msg)
+		case TypeResponse:
+			c.pendingMutex.Lock()
+			resp, ok := c.pending[msg.ID]
+			delete(c.pending, msg.ID)
+			c.pendingMutex.Unlock()
+
+			if ok {
+				resp <- &msg
+			}
+		}
+	}
+}
+
+// Do sends the request to the other end and waits for its response. The header
+// is optional.
+func (c *Conn) Do(ctx context.Context, method, path string, header http.Header, body []byte) (int, []byte, error) {
+	id := xid.New().String()
+	resp := make(chan *Message, 1)
+
+	c.pendingMutex.Lock()
+	c.pending[id] = resp
+	c.pendingMutex.Unlock()
+
+	defer func() {
+		c.pendingMutex.Lock()
+		delete(c.pending, id)
+		c.pendingMutex.Unlock()
+	}()
+
+	err := c.write(&Message{
+		ID:     id,
+		Type:   TypeRequest,
+		Method: method,
+		Path:   path,
+		Header: header,
+		Body:   body,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	select {
+	case msg := <-resp:
+		return msg.Status, msg.Body, nil
+	case <-c.done:
+		return 0, nil, ErrClosed
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+}
+
+// Done is closed once the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close the connection, failing pending requests with ErrClosed.
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		c.writeMutex.Lock()
+		c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+		c.writeMutex.Unlock()
+
+		err = c.ws.Close()
+	})
+
+	return err
+}
+
+func (c *Conn) write(msg *Message) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	err := c.ws.WriteJSON(msg)
+	if err != nil {
+		c.ws.Close()
+		return fmt.Errorf("tunnel: could not write message: %w", err)
+	}
+
+	return nil
+}
+
+// ping keeps the connection alive, and lets Serve notice a dead peer once its
+// pongs stop.
+func (c *Conn) ping() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		c.writeMutex.Lock()
+		err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		c.writeMutex.Unlock()
+		if err != nil {
+			c.ws.Close()
+			return
+		}
+	}
+}
+
+// serve the request with the handler and send back its response.
+func (c *Conn) serve(msg *Message) {
+	resp := &Message{
+		ID:   msg.ID,
+		Type: TypeResponse,
+	}
+
+	req, err := http.NewRequest(msg.Method, msg.Path, bytes.NewReader(msg.Body))
+	if err != nil {
+		resp.Status = http.StatusBadRequest
+		resp.Body = []byte(fmt.Sprintf(`{"code":400,"error":%q,"message":"Invalid request."}`, err.Error()))
+		c.write(resp)
+		return
+	}
+
+	// The connection's own headers go last, so the other end can't override how
+	// it is authenticated.
+	for key, values := range msg.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	for key, values := range c.header {
+		req.Header.Del(key)
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.RemoteAddr = c.ws.RemoteAddr().String()
+
+	w := &responseWriter{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+	c.handler.ServeHTTP(w, req)
+
+	resp.Status = w.status
+	resp.Body = w.body.Bytes()
+	c.write(resp)
+}
+
+// responseWriter records the response of a handler to send it back over the
+// tunnel.
+type responseWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
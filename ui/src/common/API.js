@@ -1,3 +1,4 @@
+import router from 'page';
 import { addToast } from './toasts.js';
 
 export async function callAPI(endpoint, parameters) {
@@ -7,6 +8,10 @@ export async function callAPI(endpoint, parameters) {
             if (response.status == 204) {
                 return {}
             }
+            // The session is over, log in again.
+            if (response.status == 401 && endpoint != '/login') {
+                router('/login');
+            }
             return response.json()
         })
         .then(data => {